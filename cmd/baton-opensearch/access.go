@@ -0,0 +1,161 @@
+//go:build !generate
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	cfg "github.com/conductorone/baton-opensearch/pkg/config"
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	"github.com/conductorone/baton-sdk/pkg/cli"
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newAccessCommand returns the access subcommand, which answers effective access queries against a cluster
+// without running a sync: who can access an index, or what a user or backend role can do.
+func newAccessCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "access",
+		Short: "Show effective access to an index, or of a user or backend role",
+		Long: `Show effective access, with the chain that grants it: the user or backend role, the role mapping,
+the role, the action groups and the concrete action or index pattern.
+
+  baton-opensearch access --index 'payments-*' --level read
+  baton-opensearch access --user alice --output json
+  baton-opensearch access --backend-role ops`,
+		Args: cobra.NoArgs,
+	}
+	index := cmd.Flags().String("index", "", "Index name or pattern to show access to")
+	level := cmd.Flags().String("level", "", "Limit --index to an access level: read, write or admin")
+	user := cmd.Flags().String("user", "", "User to show the access of")
+	backendRole := cmd.Flags().String("backend-role", "", "Backend role to show the access of")
+	clusterName := cmd.Flags().String("cluster", "", "Cluster of the clusters file to query")
+	output := cmd.Flags().String("output", "table", "Output format: table or json")
+	cmd.MarkFlagsMutuallyExclusive("index", "user", "backend-role")
+	cmd.MarkFlagsOneRequired("index", "user", "backend-role")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if err := v.BindPFlags(cmd.Flags()); err != nil {
+			return err
+		}
+		osc, err := cli.MakeGenericConfiguration[*cfg.Opensearch](v)
+		if err != nil {
+			return err
+		}
+		if err := field.Validate(cfg.Config, osc); err != nil {
+			return err
+		}
+		if err := cfg.ValidateAuthMode(osc); err != nil {
+			return err
+		}
+		if *output != "table" && *output != "json" {
+			return fmt.Errorf("unknown output format %q, expected table or json", *output)
+		}
+
+		c, err := accessClient(ctx, osc, *clusterName)
+		if err != nil {
+			return err
+		}
+		model, err := client.LoadAccessModel(ctx, c)
+		if err != nil {
+			return fmt.Errorf("failed to load the security configuration: %w", err)
+		}
+
+		var paths []client.AccessPath
+		switch {
+		case *index != "":
+			if paths, err = model.IndexAccess(*index, *level); err != nil {
+				return err
+			}
+		case *user != "":
+			paths = model.UserAccess(*user)
+		default:
+			paths = model.BackendRoleAccess(*backendRole)
+		}
+
+		if *output == "json" {
+			return writeAccessJSON(cmd.OutOrStdout(), paths)
+		}
+		return writeAccessTable(cmd.OutOrStdout(), paths)
+	}
+
+	return cmd
+}
+
+// accessClient connects to the configured cluster, or to the named cluster of the clusters file.
+func accessClient(ctx context.Context, osc *cfg.Opensearch, clusterName string) (*client.Client, error) {
+	if osc.AossRegion != "" {
+		return nil, fmt.Errorf("effective access queries are not supported for OpenSearch Serverless")
+	}
+
+	clusterConfig := cfg.Cluster{Address: osc.Address, Addresses: osc.Addresses}
+	if osc.ClustersFile != "" {
+		clusterConfigs, err := cfg.LoadClusters(osc.ClustersFile)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(clusterConfigs))
+		found := false
+		for _, c := range clusterConfigs {
+			names = append(names, c.Name)
+			if c.Name == clusterName {
+				clusterConfig, found = c, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("--cluster must name a cluster of the clusters file: %s", strings.Join(names, ", "))
+		}
+	}
+
+	cluster, err := clusterSettings(ctx, osc, clusterConfig)
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.NewClient(ctx, cluster.Address, cluster.Username, cluster.Password, cluster.UserMatchKey,
+		cluster.InsecureSkipVerify, cluster.Credentials, cluster.Options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.DetectionError(); err != nil {
+		return nil, fmt.Errorf("failed to find a security API on the cluster: %w", err)
+	}
+	return c, nil
+}
+
+func writeAccessJSON(w io.Writer, paths []client.AccessPath) error {
+	if paths == nil {
+		paths = []client.AccessPath{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(paths)
+}
+
+func writeAccessTable(w io.Writer, paths []client.AccessPath) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PRINCIPAL\tVIA\tROLE\tSCOPE\tINDEX PATTERN\tPERMISSION\tACTION GROUPS\tACTION\tRESTRICTIONS")
+	for _, p := range paths {
+		pattern := p.IndexPattern
+		if p.Partial {
+			pattern += " (partial)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Principal, p.Via, p.Role, p.Scope, dash(pattern), p.Permission, dash(strings.Join(p.ActionGroups, " > ")), p.Action, dash(p.Restrictions))
+	}
+	return tw.Flush()
+}
+
+// dash fills empty table cells.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
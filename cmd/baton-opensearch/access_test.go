@@ -0,0 +1,117 @@
+//go:build !generate
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	cfg "github.com/conductorone/baton-opensearch/pkg/config"
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPaths = []client.AccessPath{
+	{
+		Principal:    "backend_role:finance",
+		Via:          "role_mapping",
+		Role:         "payments_read",
+		Scope:        client.ScopeIndex,
+		IndexPattern: "payments-*",
+		Permission:   "read",
+		ActionGroups: []string{"read"},
+		Action:       "indices:data/read*",
+		Restrictions: "masked ssn",
+		Partial:      true,
+	},
+	{
+		Principal:  "user:alice",
+		Via:        "user",
+		Role:       "monitor",
+		Scope:      client.ScopeCluster,
+		Permission: "cluster:monitor/health",
+		Action:     "cluster:monitor/health",
+	},
+}
+
+func TestWriteAccessTable(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, writeAccessTable(&out, testPaths))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, []string{"PRINCIPAL", "VIA", "ROLE", "SCOPE", "INDEX", "PATTERN", "PERMISSION", "ACTION", "GROUPS", "ACTION", "RESTRICTIONS"},
+			strings.Fields(lines[0]))
+		// Partial patterns are marked, and action group chains are joined outermost first.
+		assert.Equal(t, []string{"backend_role:finance", "role_mapping", "payments_read", "index", "payments-*", "(partial)", "read", "read",
+			"indices:data/read*", "masked", "ssn"}, strings.Fields(lines[1]))
+		// Empty cells are filled with a dash so that columns stay aligned.
+		assert.Equal(t, []string{"user:alice", "user", "monitor", "cluster", "-", "cluster:monitor/health", "-", "cluster:monitor/health", "-"},
+			strings.Fields(lines[2]))
+	}
+}
+
+func TestWriteAccessJSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, writeAccessJSON(&out, testPaths))
+	var decoded []client.AccessPath
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, testPaths, decoded)
+
+	// No access is an empty list rather than null.
+	out.Reset()
+	assert.NoError(t, writeAccessJSON(&out, nil))
+	assert.Equal(t, "[]", strings.TrimSpace(out.String()))
+}
+
+func TestAccessClientSelectsCluster(t *testing.T) {
+	ctx := context.Background()
+	newCluster := func(hits *atomic.Int32) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"version":{"distribution":"opensearch","number":"2.11.0"}}`))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	var prodHits, stagingHits atomic.Int32
+	prod := newCluster(&prodHits)
+	staging := newCluster(&stagingHits)
+
+	clustersFile := filepath.Join(t.TempDir(), "clusters.yaml")
+	assert.NoError(t, os.WriteFile(clustersFile, []byte(`clusters:
+  - name: prod
+    address: `+prod.URL+`
+  - name: staging
+    address: `+staging.URL+`
+`), 0o600))
+	osc := &cfg.Opensearch{ClustersFile: clustersFile, Username: "admin", Password: "admin", UserMatchKey: "username"}
+
+	_, err := accessClient(ctx, osc, "staging")
+	assert.NoError(t, err)
+	assert.Zero(t, prodHits.Load())
+	assert.NotZero(t, stagingHits.Load())
+
+	// A missing or unknown cluster name lists the clusters of the file.
+	_, err = accessClient(ctx, osc, "")
+	assert.ErrorContains(t, err, "--cluster must name a cluster of the clusters file: prod, staging")
+	_, err = accessClient(ctx, osc, "dev")
+	assert.ErrorContains(t, err, "prod, staging")
+
+	// Without a clusters file the configured address is used.
+	_, err = accessClient(ctx, &cfg.Opensearch{Address: prod.URL, Username: "admin", Password: "admin", UserMatchKey: "username"}, "")
+	assert.NoError(t, err)
+	assert.NotZero(t, prodHits.Load())
+
+	_, err = accessClient(ctx, &cfg.Opensearch{AossRegion: "us-east-1"}, "")
+	assert.ErrorContains(t, err, "not supported for OpenSearch Serverless")
+}
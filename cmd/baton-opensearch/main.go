@@ -6,9 +6,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	cfg "github.com/conductorone/baton-opensearch/pkg/config"
 	"github.com/conductorone/baton-opensearch/pkg/connector"
+	"github.com/conductorone/baton-opensearch/pkg/connector/aoss"
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/conductorone/baton-sdk/pkg/config"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/field"
@@ -22,7 +26,7 @@ var version = "dev"
 func main() {
 	ctx := context.Background()
 
-	_, cmd, err := config.DefineConfiguration(
+	v, cmd, err := config.DefineConfiguration(
 		ctx,
 		"baton-opensearch",
 		getConnector,
@@ -33,6 +37,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if _, err := cli.AddCommand(cmd, v, &cfg.Config, newAccessCommand(ctx, v)); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
 	cmd.Version = version
 
 	err = cmd.Execute()
@@ -47,31 +56,175 @@ func getConnector(ctx context.Context, osc *cfg.Opensearch) (types.ConnectorServ
 	if err := field.Validate(cfg.Config, osc); err != nil {
 		return nil, err
 	}
+	if err := cfg.ValidateAuthMode(osc); err != nil {
+		return nil, err
+	}
+
+	if osc.AossRegion != "" {
+		return getServerlessConnector(ctx, osc)
+	}
+
+	var cb *connector.Connector
+	if osc.ClustersFile != "" {
+		clusterConfigs, err := cfg.LoadClusters(osc.ClustersFile)
+		if err != nil {
+			return nil, err
+		}
+		clusters := make([]connector.Cluster, 0, len(clusterConfigs))
+		for _, c := range clusterConfigs {
+			cluster, err := clusterSettings(ctx, osc, c)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: %w", c.Name, err)
+			}
+			clusters = append(clusters, cluster)
+		}
+
+		cb, err = connector.NewMultiCluster(ctx, clusters)
+		if err != nil {
+			l.Error("error creating connector", zap.Error(err))
+			return nil, err
+		}
+	} else {
+		cluster, err := clusterSettings(ctx, osc, cfg.Cluster{Address: osc.Address, Addresses: osc.Addresses})
+		if err != nil {
+			return nil, err
+		}
+
+		cb, err = connector.New(ctx, cluster.Address, cluster.Username, cluster.Password, cluster.UserMatchKey,
+			cluster.InsecureSkipVerify, cluster.Credentials, cluster.Options...)
+		if err != nil {
+			l.Error("error creating connector", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	if osc.ClassificationsFile != "" {
+		classifications, err := cfg.LoadClassifications(osc.ClassificationsFile)
+		if err != nil {
+			return nil, err
+		}
+		cb.SetClassifications(client.NewClassifications(classifications.Levels, classifications.Indices))
+	}
+
+	connector, err := connectorbuilder.NewConnector(ctx, cb)
+	if err != nil {
+		l.Error("error creating connector", zap.Error(err))
+		return nil, err
+	}
+	return connector, nil
+}
 
-	var address, username, password string
-	address = osc.Address
-	username = osc.Username
-	password = osc.Password
-	userMatchKey := osc.UserMatchKey
+// clusterSettings combines a cluster's own settings with the top-level configuration, which supplies every
+// setting the cluster leaves unset.
+func clusterSettings(ctx context.Context, osc *cfg.Opensearch, c cfg.Cluster) (connector.Cluster, error) {
+	l := ctxzap.Extract(ctx)
+
+	username, password := osc.Username, osc.Password
+	if c.Username != "" {
+		username, password = c.Username, c.Password
+	}
 	insecureSkipVerify := osc.InsecureSkipVerify
-	caCertPath := osc.CaCertPath
+	if c.InsecureSkipVerify != nil {
+		insecureSkipVerify = *c.InsecureSkipVerify
+	}
+	caCert, caCertPath := osc.CaCert, osc.CaCertPath
+	if c.CaCert != "" || c.CaCertPath != "" {
+		caCert, caCertPath = c.CaCert, c.CaCertPath
+	}
 
 	// Process certificates if provided and not skipping verification
 	var credentials []byte
 	if !insecureSkipVerify {
-		if caCertPath != "" {
+		if caCert != "" {
+			// Inline PEM, typically injected from a secret manager as an environment variable
+			l.Debug("using inline certificate")
+			credentials = []byte(caCert)
+		} else if caCertPath != "" {
 			// Read certificate from file path
 			l.Debug("reading certificate from file", zap.String("caCertPath", caCertPath))
 			fileContent, err := os.ReadFile(caCertPath)
 			if err != nil {
-				return nil, fmt.Errorf("failed to read certificate file %s: %w", caCertPath, err)
+				return connector.Cluster{}, fmt.Errorf("failed to read certificate file %s: %w", caCertPath, err)
 			}
 			l.Debug("successfully read certificate file")
 			credentials = fileContent
 		}
 	}
 
-	cb, err := connector.New(ctx, address, username, password, userMatchKey, insecureSkipVerify, credentials)
+	tlsServerName := firstNonEmpty(c.TlsServerName, osc.TlsServerName)
+	securityAPIFlavor := firstNonEmpty(c.SecurityApiFlavor, osc.SecurityApiFlavor)
+
+	clientOpts := []client.Option{
+		client.WithAddresses(c.Addresses...),
+		client.WithNodeDiscovery(osc.DiscoverNodes),
+		client.WithMaxRetries(osc.MaxRetries),
+		client.WithRequestsPerSecond(osc.RequestsPerSecond),
+		client.WithConnectTimeout(time.Duration(osc.ConnectTimeout) * time.Second),
+		client.WithReadTimeout(time.Duration(osc.ReadTimeout) * time.Second),
+		client.WithRequestTimeout(time.Duration(osc.RequestTimeout) * time.Second),
+		client.WithTLSServerName(tlsServerName),
+		client.WithMinTLSVersion(osc.TlsMinVersion),
+		client.WithPinnedPublicKeys(osc.TlsPinnedPublicKeys...),
+		client.WithSecurityFlavor(securityAPIFlavor),
+	}
+	if osc.AuthMode == "proxy" {
+		clientOpts = append(clientOpts, client.WithProxyAuth(osc.ProxyUser, osc.ProxyRoles, osc.ProxyUserHeader, osc.ProxyRolesHeader))
+		username, password = "", ""
+	}
+	if osc.ClientCertPath != "" {
+		l.Debug("reading client certificate", zap.String("clientCertPath", osc.ClientCertPath))
+		certPEM, err := os.ReadFile(osc.ClientCertPath)
+		if err != nil {
+			return connector.Cluster{}, fmt.Errorf("failed to read client certificate file %s: %w", osc.ClientCertPath, err)
+		}
+		keyPEM, err := os.ReadFile(osc.ClientKeyPath)
+		if err != nil {
+			return connector.Cluster{}, fmt.Errorf("failed to read client key file %s: %w", osc.ClientKeyPath, err)
+		}
+		clientOpts = append(clientOpts, client.WithClientCertificate(certPEM, keyPEM))
+	}
+	switch {
+	case c.WriteUsername != "":
+		clientOpts = append(clientOpts, client.WithWriteCredentials(c.WriteUsername, c.WritePassword))
+	case osc.WriteUsername != "":
+		clientOpts = append(clientOpts, client.WithWriteCredentials(osc.WriteUsername, osc.WritePassword))
+	}
+
+	return connector.Cluster{
+		Name:               c.Name,
+		Address:            c.Address,
+		Username:           username,
+		Password:           password,
+		UserMatchKey:       osc.UserMatchKey,
+		InsecureSkipVerify: insecureSkipVerify,
+		Credentials:        credentials,
+		Options:            clientOpts,
+	}, nil
+}
+
+// firstNonEmpty returns the first non-empty value.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// getServerlessConnector builds a connector for the data access policies of OpenSearch Serverless collections.
+func getServerlessConnector(ctx context.Context, osc *cfg.Opensearch) (types.ConnectorServer, error) {
+	l := ctxzap.Extract(ctx)
+
+	aossOpts := []aoss.Option{
+		aoss.WithTimeouts(time.Duration(osc.ConnectTimeout)*time.Second, time.Duration(osc.ReadTimeout)*time.Second),
+		aoss.WithMinTLSVersion(osc.TlsMinVersion),
+	}
+	if osc.AossEndpoint != "" {
+		aossOpts = append(aossOpts, aoss.WithEndpoint(osc.AossEndpoint))
+	}
+
+	cb, err := connector.NewServerless(ctx, osc.AossRegion, osc.UserMatchKey, aossOpts...)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
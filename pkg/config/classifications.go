@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultClassificationLevels are the data classifications used when the classifications file lists none, in
+// increasing order of sensitivity.
+var DefaultClassificationLevels = []string{"public", "internal", "confidential", "restricted"}
+
+// Classifications is the classifications file: the classification levels, and the level of the indices each
+// index pattern names.
+type Classifications struct {
+	Levels  []string          `yaml:"levels"`
+	Indices map[string]string `yaml:"indices"`
+}
+
+// LoadClassifications reads the classifications file, a YAML or JSON document that maps index patterns to
+// classification levels. levels is optional and lists the levels in increasing order of sensitivity:
+//
+//	levels: [public, internal, confidential, restricted]
+//	indices:
+//	  pii-*: restricted
+//	  logs-*: internal
+func LoadClassifications(path string) (*Classifications, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read classifications file %s: %w", path, err)
+	}
+
+	classifications, err := ParseClassifications(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid classifications file %s: %w", path, err)
+	}
+	return classifications, nil
+}
+
+// ParseClassifications decodes and validates a classifications document. Every index pattern must name one of
+// the levels.
+func ParseClassifications(data []byte) (*Classifications, error) {
+	var doc Classifications
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(doc.Levels) == 0 {
+		doc.Levels = DefaultClassificationLevels
+	}
+	for i, level := range doc.Levels {
+		switch {
+		case level == "":
+			return nil, fmt.Errorf("level %d is empty", i+1)
+		case slices.Contains(doc.Levels[:i], level):
+			return nil, fmt.Errorf("level %q is listed more than once", level)
+		}
+	}
+
+	if len(doc.Indices) == 0 {
+		return nil, fmt.Errorf("no indices classified")
+	}
+	for pattern, level := range doc.Indices {
+		switch {
+		case pattern == "":
+			return nil, fmt.Errorf("empty index pattern")
+		case !slices.Contains(doc.Levels, level):
+			return nil, fmt.Errorf("index pattern %s has unknown level %q", pattern, level)
+		}
+	}
+
+	return &doc, nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Cluster is one entry of the clusters file. Unset credentials and TLS settings fall back to the top-level
+// configuration, so clusters that share them only need a name and an address.
+type Cluster struct {
+	Name               string   `yaml:"name"`
+	Address            string   `yaml:"address"`
+	Addresses          []string `yaml:"addresses"`
+	Username           string   `yaml:"username"`
+	Password           string   `yaml:"password"`
+	WriteUsername      string   `yaml:"write-username"`
+	WritePassword      string   `yaml:"write-password"`
+	CaCertPath         string   `yaml:"ca-cert-path"`
+	CaCert             string   `yaml:"ca-cert"`
+	InsecureSkipVerify *bool    `yaml:"insecure-skip-verify"`
+	TlsServerName      string   `yaml:"tls-server-name"`
+	SecurityApiFlavor  string   `yaml:"security-api-flavor"`
+}
+
+// LoadClusters reads the clusters file, a YAML or JSON document with a list of clusters:
+//
+//	clusters:
+//	  - name: prod
+//	    address: https://prod.example.com:9200
+//	  - name: staging
+//	    address: https://staging.example.com:9200
+//	    username: baton
+//	    password: secret
+func LoadClusters(path string) ([]Cluster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clusters file %s: %w", path, err)
+	}
+
+	clusters, err := ParseClusters(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clusters file %s: %w", path, err)
+	}
+	return clusters, nil
+}
+
+// ParseClusters decodes and validates a clusters document. Names must be unique and free of "/", because they
+// prefix resource IDs.
+func ParseClusters(data []byte) ([]Cluster, error) {
+	var doc struct {
+		Clusters []Cluster `yaml:"clusters"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(doc.Clusters) == 0 {
+		return nil, fmt.Errorf("no clusters defined")
+	}
+
+	seen := map[string]bool{}
+	for i, c := range doc.Clusters {
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("cluster %d has no name", i+1)
+		case strings.Contains(c.Name, "/"):
+			return nil, fmt.Errorf("cluster name %q must not contain /", c.Name)
+		case seen[c.Name]:
+			return nil, fmt.Errorf("cluster name %q is used more than once", c.Name)
+		case c.Address == "":
+			return nil, fmt.Errorf("cluster %s has no address", c.Name)
+		case c.CaCert != "" && c.CaCertPath != "":
+			return nil, fmt.Errorf("cluster %s sets both ca-cert and ca-cert-path", c.Name)
+		case (c.Username == "") != (c.Password == ""):
+			return nil, fmt.Errorf("cluster %s needs username and password together", c.Name)
+		case (c.WriteUsername == "") != (c.WritePassword == ""):
+			return nil, fmt.Errorf("cluster %s needs write-username and write-password together", c.Name)
+		}
+		seen[c.Name] = true
+	}
+
+	return doc.Clusters, nil
+}
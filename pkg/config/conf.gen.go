@@ -5,11 +5,36 @@ import "reflect"
 
 type Opensearch struct {
 	Address string `mapstructure:"address"`
+	Addresses []string `mapstructure:"addresses"`
+	ClustersFile string `mapstructure:"clusters-file"`
+	ClassificationsFile string `mapstructure:"classifications-file"`
+	DiscoverNodes bool `mapstructure:"discover-nodes"`
+	MaxRetries int `mapstructure:"max-retries"`
+	RequestsPerSecond int `mapstructure:"requests-per-second"`
+	ConnectTimeout int `mapstructure:"connect-timeout"`
+	ReadTimeout int `mapstructure:"read-timeout"`
+	RequestTimeout int `mapstructure:"request-timeout"`
+	SecurityApiFlavor string `mapstructure:"security-api-flavor"`
+	AossRegion string `mapstructure:"aoss-region"`
+	AossEndpoint string `mapstructure:"aoss-endpoint"`
+	AuthMode string `mapstructure:"auth-mode"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	WriteUsername string `mapstructure:"write-username"`
+	WritePassword string `mapstructure:"write-password"`
+	ProxyUser string `mapstructure:"proxy-user"`
+	ProxyRoles []string `mapstructure:"proxy-roles"`
+	ProxyUserHeader string `mapstructure:"proxy-user-header"`
+	ProxyRolesHeader string `mapstructure:"proxy-roles-header"`
+	ClientCertPath string `mapstructure:"client-cert-path"`
+	ClientKeyPath string `mapstructure:"client-key-path"`
 	UserMatchKey string `mapstructure:"user-match-key"`
 	InsecureSkipVerify bool `mapstructure:"insecure-skip-verify"`
 	CaCertPath string `mapstructure:"ca-cert-path"`
+	CaCert string `mapstructure:"ca-cert"`
+	TlsServerName string `mapstructure:"tls-server-name"`
+	TlsMinVersion string `mapstructure:"tls-min-version"`
+	TlsPinnedPublicKeys []string `mapstructure:"tls-pinned-public-keys"`
 }
 
 func (c* Opensearch) findFieldByTag(tagValue string) (any, bool) {
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/conductorone/baton-sdk/pkg/field"
 )
 
@@ -8,23 +10,162 @@ var (
 	// Add the SchemaFields for the Config.
 	addressField = field.StringField(
 		"address",
-		field.WithDescription("OpenSearch server address"),
-		field.WithRequired(true),
+		field.WithDescription("OpenSearch server address. Required unless aoss-region or clusters-file is set."),
+		field.WithRequired(false),
 		field.WithDisplayName("Address"),
 	)
+	addressesField = field.StringSliceField(
+		"addresses",
+		field.WithDescription("Additional OpenSearch node addresses to fail over to when the primary address is unreachable"),
+		field.WithRequired(false),
+		field.WithDisplayName("Additional Addresses"),
+	)
+	clustersFileField = field.StringField(
+		"clusters-file",
+		field.WithDescription("Path to a YAML or JSON file listing named clusters to sync instead of a single address. Unset credentials and TLS settings of a cluster fall back to the top-level values."),
+		field.WithRequired(false),
+		field.WithDisplayName("Clusters File"),
+	)
+	classificationsFileField = field.StringField(
+		"classifications-file",
+		field.WithDescription("Path to a YAML or JSON file that maps index patterns to data classifications such as restricted or internal. Roles and their holders are rated by the highest classification they can reach."),
+		field.WithRequired(false),
+		field.WithDisplayName("Classifications File"),
+	)
+	discoverNodesField = field.BoolField(
+		"discover-nodes",
+		field.WithDescription("Discover the cluster's HTTP-enabled nodes from _nodes/http and use them instead of the configured addresses"),
+		field.WithRequired(false),
+		field.WithDefaultValue(false),
+		field.WithDisplayName("Discover Nodes"),
+	)
+	maxRetriesField = field.IntField(
+		"max-retries",
+		field.WithDescription("Maximum number of retries for throttled (429) or transiently failing (502, 503, 504) requests"),
+		field.WithRequired(false),
+		field.WithDefaultValue(3),
+		field.WithDisplayName("Max Retries"),
+	)
+	requestsPerSecondField = field.IntField(
+		"requests-per-second",
+		field.WithDescription("Maximum number of requests per second sent to OpenSearch. 0 disables the limit."),
+		field.WithRequired(false),
+		field.WithDefaultValue(0),
+		field.WithDisplayName("Requests Per Second"),
+	)
+	connectTimeoutField = field.IntField(
+		"connect-timeout",
+		field.WithDescription("Timeout in seconds for connecting to a node and completing the TLS handshake"),
+		field.WithRequired(false),
+		field.WithDefaultValue(10),
+		field.WithDisplayName("Connect Timeout"),
+	)
+	readTimeoutField = field.IntField(
+		"read-timeout",
+		field.WithDescription("Timeout in seconds for a node to answer a single request"),
+		field.WithRequired(false),
+		field.WithDefaultValue(60),
+		field.WithDisplayName("Read Timeout"),
+	)
+	requestTimeoutField = field.IntField(
+		"request-timeout",
+		field.WithDescription("Deadline in seconds for a whole API call, including retries and failover"),
+		field.WithRequired(false),
+		field.WithDefaultValue(300),
+		field.WithDisplayName("Request Timeout"),
+	)
+	securityAPIFlavorField = field.SelectField(
+		"security-api-flavor",
+		[]string{"auto", "opensearch", "opendistro", "elasticsearch", "searchguard"},
+		field.WithDescription("Security API to use. 'auto' probes the cluster for a responding security API."),
+		field.WithRequired(false),
+		field.WithDefaultValue("auto"),
+		field.WithDisplayName("Security API Flavor"),
+	)
+	aossRegionField = field.StringField(
+		"aoss-region",
+		field.WithDescription("AWS region of OpenSearch Serverless collections. Setting it syncs data access policies instead of a cluster's security API."),
+		field.WithRequired(false),
+		field.WithDisplayName("OpenSearch Serverless Region"),
+	)
+	aossEndpointField = field.StringField(
+		"aoss-endpoint",
+		field.WithDescription("Override for the OpenSearch Serverless API endpoint, e.g. a VPC endpoint"),
+		field.WithRequired(false),
+		field.WithDisplayName("OpenSearch Serverless Endpoint"),
+	)
+	authModeField = field.SelectField(
+		"auth-mode",
+		[]string{"basic", "proxy"},
+		field.WithDescription("How the connector authenticates: 'basic' with username and password, or 'proxy' with trusted proxy headers"),
+		field.WithRequired(false),
+		field.WithDefaultValue("basic"),
+		field.WithDisplayName("Authentication Mode"),
+	)
 	usernameField = field.StringField(
 		"username",
-		field.WithDescription("OpenSearch username"),
-		field.WithRequired(true),
+		field.WithDescription("OpenSearch username, required for basic authentication"),
+		field.WithRequired(false),
 		field.WithDisplayName("Username"),
 	)
 	passwordField = field.StringField(
 		"password",
-		field.WithDescription("OpenSearch password"),
-		field.WithRequired(true),
+		field.WithDescription("OpenSearch password, required for basic authentication"),
+		field.WithRequired(false),
 		field.WithIsSecret(true),
 		field.WithDisplayName("Password"),
 	)
+	writeUsernameField = field.StringField(
+		"write-username",
+		field.WithDescription("Optional OpenSearch username used only for provisioning. When unset, provisioning uses the sync credential."),
+		field.WithRequired(false),
+		field.WithDisplayName("Provisioning Username"),
+	)
+	writePasswordField = field.StringField(
+		"write-password",
+		field.WithDescription("Password for the provisioning username"),
+		field.WithRequired(false),
+		field.WithIsSecret(true),
+		field.WithDisplayName("Provisioning Password"),
+	)
+	proxyUserField = field.StringField(
+		"proxy-user",
+		field.WithDescription("User asserted in the proxy user header, required for proxy authentication"),
+		field.WithRequired(false),
+		field.WithDisplayName("Proxy User"),
+	)
+	proxyRolesField = field.StringSliceField(
+		"proxy-roles",
+		field.WithDescription("Backend roles asserted in the proxy roles header"),
+		field.WithRequired(false),
+		field.WithDisplayName("Proxy Roles"),
+	)
+	proxyUserHeaderField = field.StringField(
+		"proxy-user-header",
+		field.WithDescription("Header carrying the proxy user, as configured in the security plugin's proxy auth domain"),
+		field.WithRequired(false),
+		field.WithDefaultValue("x-proxy-user"),
+		field.WithDisplayName("Proxy User Header"),
+	)
+	proxyRolesHeaderField = field.StringField(
+		"proxy-roles-header",
+		field.WithDescription("Header carrying the proxy roles, as configured in the security plugin's proxy auth domain"),
+		field.WithRequired(false),
+		field.WithDefaultValue("x-proxy-roles"),
+		field.WithDisplayName("Proxy Roles Header"),
+	)
+	clientCertPathField = field.StringField(
+		"client-cert-path",
+		field.WithDescription("Path to a PEM-encoded client certificate presented during the TLS handshake"),
+		field.WithRequired(false),
+		field.WithDisplayName("Client Certificate"),
+	)
+	clientKeyPathField = field.StringField(
+		"client-key-path",
+		field.WithDescription("Path to the PEM-encoded private key of the client certificate"),
+		field.WithRequired(false),
+		field.WithDisplayName("Client Key"),
+	)
 	userMatchKeyField = field.StringField(
 		"user-match-key",
 		field.WithDescription("The field name to use for matching users (e.g. 'email', 'name', 'id'). Default is 'email'."),
@@ -45,18 +186,77 @@ var (
 		field.WithRequired(false),
 		field.WithDisplayName("CA Certificate"),
 	)
+	caCertField = field.StringField(
+		"ca-cert",
+		field.WithDescription("PEM-encoded CA certificate for TLS connections, as an alternative to ca-cert-path"),
+		field.WithRequired(false),
+		field.WithDisplayName("CA Certificate PEM"),
+	)
+	tlsServerNameField = field.StringField(
+		"tls-server-name",
+		field.WithDescription("Server name used to verify the node certificate, for clusters reached by IP address"),
+		field.WithRequired(false),
+		field.WithDisplayName("TLS Server Name"),
+	)
+	tlsMinVersionField = field.SelectField(
+		"tls-min-version",
+		[]string{"1.2", "1.3"},
+		field.WithDescription("Minimum TLS version"),
+		field.WithRequired(false),
+		field.WithDefaultValue("1.2"),
+		field.WithDisplayName("Minimum TLS Version"),
+	)
+	tlsPinnedPublicKeysField = field.StringSliceField(
+		"tls-pinned-public-keys",
+		field.WithDescription("Base64 SHA-256 SPKI fingerprints. When set, only nodes whose verified certificate chain contains one of these keys are trusted, or whose own certificate has one when insecure-skip-verify is set."),
+		field.WithRequired(false),
+		field.WithDisplayName("Pinned Public Keys"),
+	)
 
 	fieldRelationships = []field.SchemaFieldRelationship{
-		field.FieldsAtLeastOneUsed(insecureSkipVerifyField, caCertPathField),
+		field.FieldsMutuallyExclusive(caCertField, caCertPathField),
+		field.FieldsRequiredTogether(writeUsernameField, writePasswordField),
+		field.FieldsAtLeastOneUsed(addressField, aossRegionField, clustersFileField),
+		field.FieldsMutuallyExclusive(addressField, aossRegionField, clustersFileField),
+		field.FieldsDependentOn([]field.SchemaField{aossEndpointField}, []field.SchemaField{aossRegionField}),
+		field.FieldsMutuallyExclusive(aossRegionField, classificationsFileField),
+		field.FieldsAtLeastOneUsed(usernameField, proxyUserField, aossRegionField, clustersFileField),
+		field.FieldsRequiredTogether(usernameField, passwordField),
+		field.FieldsRequiredTogether(clientCertPathField, clientKeyPathField),
 	}
 
 	ConfigurationFields = []field.SchemaField{
 		addressField,
+		addressesField,
+		clustersFileField,
+		classificationsFileField,
+		discoverNodesField,
+		maxRetriesField,
+		requestsPerSecondField,
+		connectTimeoutField,
+		readTimeoutField,
+		requestTimeoutField,
+		securityAPIFlavorField,
+		aossRegionField,
+		aossEndpointField,
+		authModeField,
 		usernameField,
 		passwordField,
+		writeUsernameField,
+		writePasswordField,
+		proxyUserField,
+		proxyRolesField,
+		proxyUserHeaderField,
+		proxyRolesHeaderField,
+		clientCertPathField,
+		clientKeyPathField,
 		userMatchKeyField,
 		insecureSkipVerifyField,
 		caCertPathField,
+		caCertField,
+		tlsServerNameField,
+		tlsMinVersionField,
+		tlsPinnedPublicKeysField,
 	}
 )
 
@@ -70,3 +270,23 @@ var Config = field.NewConfiguration(
 	field.WithSupportsExternalResources(true),
 	field.WithRequiresExternalConnector(true),
 )
+
+// ValidateAuthMode checks the credentials against auth-mode, which field relationships cannot express because
+// they depend on the field's value: basic authentication takes username and password, and proxy authentication
+// takes proxy-user and proxy-roles. Credentials of the other mode would be silently ignored, so they are rejected.
+func ValidateAuthMode(c *Opensearch) error {
+	switch c.AuthMode {
+	case "proxy":
+		if c.Username != "" || c.Password != "" {
+			return fmt.Errorf("username and password are not used with auth-mode proxy, set proxy-user instead")
+		}
+		if c.ProxyUser == "" && c.AossRegion == "" {
+			return fmt.Errorf("proxy-user is required with auth-mode proxy")
+		}
+	case "", "basic":
+		if c.ProxyUser != "" || len(c.ProxyRoles) > 0 {
+			return fmt.Errorf("proxy-user and proxy-roles are only used with auth-mode proxy")
+		}
+	}
+	return nil
+}
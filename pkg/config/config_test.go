@@ -20,7 +20,7 @@ func TestValidateConfig(t *testing.T) {
 				Address: "http://localhost:9200",
 			},
 			wantErr:         true,
-			wantErrContains: []string{"username of type string is marked as required but it has a zero-value", "password of type string is marked as required but it has a zero-value"},
+			wantErrContains: []string{"at least one field was expected", "username", "proxy-user"},
 		},
 		{
 			name: "valid config with ca_cert_path",
@@ -43,14 +43,167 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "invalid config - neither ca_cert_path nor insecure_skip_verify provided",
+			name: "valid config - system certificate pool",
 			config: &Opensearch{
 				Address:  "http://localhost:9200",
 				Username: "admin",
 				Password: "admin",
 			},
+			wantErr: false,
+		},
+		{
+			name: "valid config with inline ca_cert, server name, min version and pins",
+			config: &Opensearch{
+				Address:             "https://10.0.0.1:9200",
+				Username:            "admin",
+				Password:            "admin",
+				CaCert:              "-----BEGIN CERTIFICATE-----",
+				TlsServerName:       "opensearch.internal",
+				TlsMinVersion:       "1.3",
+				TlsPinnedPublicKeys: []string{"sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid config - ca_cert and ca_cert_path both provided",
+			config: &Opensearch{
+				Address:    "http://localhost:9200",
+				Username:   "admin",
+				Password:   "admin",
+				CaCert:     "-----BEGIN CERTIFICATE-----",
+				CaCertPath: "/path/to/ca.pem",
+			},
+			wantErr:         true,
+			wantErrContains: []string{"ca-cert", "ca-cert-path"},
+		},
+		{
+			name: "valid config with separate write credentials",
+			config: &Opensearch{
+				Address:       "http://localhost:9200",
+				Username:      "reader",
+				Password:      "reader",
+				WriteUsername: "admin",
+				WritePassword: "admin",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid config - write_username without write_password",
+			config: &Opensearch{
+				Address:       "http://localhost:9200",
+				Username:      "reader",
+				Password:      "reader",
+				WriteUsername: "admin",
+			},
+			wantErr:         true,
+			wantErrContains: []string{"needed together", "write-password"},
+		},
+		{
+			name: "valid config with proxy authentication and client certificate",
+			config: &Opensearch{
+				Address:        "https://localhost:9200",
+				AuthMode:       "proxy",
+				ProxyUser:      "baton",
+				ProxyRoles:     []string{"security_reader"},
+				ClientCertPath: "/path/to/client.pem",
+				ClientKeyPath:  "/path/to/client-key.pem",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid config - username without password",
+			config: &Opensearch{
+				Address:  "http://localhost:9200",
+				Username: "admin",
+			},
+			wantErr:         true,
+			wantErrContains: []string{"needed together", "password"},
+		},
+		{
+			name: "invalid config - unsupported tls_min_version",
+			config: &Opensearch{
+				Address:       "http://localhost:9200",
+				Username:      "admin",
+				Password:      "admin",
+				TlsMinVersion: "1.0",
+			},
+			wantErr:         true,
+			wantErrContains: []string{"tls-min-version"},
+		},
+		{
+			name: "valid config - explicit security API flavor",
+			config: &Opensearch{
+				Address:           "http://localhost:9200",
+				Username:          "admin",
+				Password:          "admin",
+				SecurityApiFlavor: "searchguard",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid config - unknown security API flavor",
+			config: &Opensearch{
+				Address:           "http://localhost:9200",
+				Username:          "admin",
+				Password:          "admin",
+				SecurityApiFlavor: "xpack",
+			},
+			wantErr:         true,
+			wantErrContains: []string{"security-api-flavor"},
+		},
+		{
+			name: "valid config - OpenSearch Serverless",
+			config: &Opensearch{
+				AossRegion:   "us-east-1",
+				AossEndpoint: "https://aoss.us-east-1.amazonaws.com",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid config - address and OpenSearch Serverless region",
+			config: &Opensearch{
+				Address:    "http://localhost:9200",
+				Username:   "admin",
+				Password:   "admin",
+				AossRegion: "us-east-1",
+			},
+			wantErr:         true,
+			wantErrContains: []string{"address", "aoss-region"},
+		},
+		{
+			name:            "invalid config - neither address nor OpenSearch Serverless region",
+			config:          &Opensearch{},
+			wantErr:         true,
+			wantErrContains: []string{"address", "aoss-region"},
+		},
+		{
+			name: "invalid config - OpenSearch Serverless endpoint without region",
+			config: &Opensearch{
+				Address:      "http://localhost:9200",
+				Username:     "admin",
+				Password:     "admin",
+				AossEndpoint: "http://localhost:8080",
+			},
+			wantErr:         true,
+			wantErrContains: []string{"aoss-endpoint"},
+		},
+		{
+			name: "valid config - clusters file with shared credentials",
+			config: &Opensearch{
+				ClustersFile: "/path/to/clusters.yaml",
+				Username:     "admin",
+				Password:     "admin",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid config - address and clusters file",
+			config: &Opensearch{
+				Address:      "http://localhost:9200",
+				ClustersFile: "/path/to/clusters.yaml",
+			},
 			wantErr:         true,
-			wantErrContains: []string{"at least one field was expected", "insecure-skip-verify", "ca-cert-path"},
+			wantErrContains: []string{"address", "clusters-file"},
 		},
 	}
 
@@ -70,3 +223,181 @@ func TestValidateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateAuthMode(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          *Opensearch
+		wantErrContains string
+	}{
+		{
+			name:   "basic",
+			config: &Opensearch{AuthMode: "basic", Username: "admin", Password: "admin"},
+		},
+		{
+			name:   "proxy",
+			config: &Opensearch{AuthMode: "proxy", ProxyUser: "baton", ProxyRoles: []string{"security_reader"}, ProxyUserHeader: "x-proxy-user"},
+		},
+		{
+			name:   "serverless",
+			config: &Opensearch{AuthMode: "basic", AossRegion: "us-east-1"},
+		},
+		{
+			name:            "proxy user with basic",
+			config:          &Opensearch{AuthMode: "basic", Username: "admin", Password: "admin", ProxyUser: "baton"},
+			wantErrContains: "only used with auth-mode proxy",
+		},
+		{
+			name:            "proxy roles without auth mode",
+			config:          &Opensearch{Username: "admin", Password: "admin", ProxyRoles: []string{"security_reader"}},
+			wantErrContains: "only used with auth-mode proxy",
+		},
+		{
+			name:            "username with proxy",
+			config:          &Opensearch{AuthMode: "proxy", Username: "admin", Password: "admin", ProxyUser: "baton"},
+			wantErrContains: "not used with auth-mode proxy",
+		},
+		{
+			name:            "proxy without proxy user",
+			config:          &Opensearch{AuthMode: "proxy", ClustersFile: "/path/to/clusters.yaml"},
+			wantErrContains: "proxy-user is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAuthMode(tt.config)
+			if tt.wantErrContains == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErrContains)
+			}
+		})
+	}
+}
+
+func TestParseClusters(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		wantNames       []string
+		wantErrContains string
+	}{
+		{
+			name: "yaml",
+			data: `
+clusters:
+  - name: prod
+    address: https://prod.example.com:9200
+    security-api-flavor: opensearch
+  - name: staging
+    address: https://staging.example.com:9200
+    username: baton
+    password: secret
+    insecure-skip-verify: true
+`,
+			wantNames: []string{"prod", "staging"},
+		},
+		{
+			name:      "json",
+			data:      `{"clusters": [{"name": "eu", "address": "https://eu.example.com:9200", "addresses": ["https://eu-2.example.com:9200"]}]}`,
+			wantNames: []string{"eu"},
+		},
+		{
+			name:            "empty",
+			data:            `clusters: []`,
+			wantErrContains: "no clusters",
+		},
+		{
+			name:            "duplicate name",
+			data:            `{"clusters": [{"name": "a", "address": "https://a:9200"}, {"name": "a", "address": "https://b:9200"}]}`,
+			wantErrContains: "more than once",
+		},
+		{
+			name:            "slash in name",
+			data:            `{"clusters": [{"name": "eu/west", "address": "https://a:9200"}]}`,
+			wantErrContains: "must not contain /",
+		},
+		{
+			name:            "missing address",
+			data:            `{"clusters": [{"name": "a"}]}`,
+			wantErrContains: "no address",
+		},
+		{
+			name:            "username without password",
+			data:            `{"clusters": [{"name": "a", "address": "https://a:9200", "username": "baton"}]}`,
+			wantErrContains: "username and password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters, err := ParseClusters([]byte(tt.data))
+			if tt.wantErrContains != "" {
+				assert.ErrorContains(t, err, tt.wantErrContains)
+				return
+			}
+			assert.NoError(t, err)
+			var names []string
+			for _, c := range clusters {
+				names = append(names, c.Name)
+			}
+			assert.Equal(t, tt.wantNames, names)
+		})
+	}
+}
+
+func TestParseClassifications(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		wantLevels      []string
+		wantIndices     map[string]string
+		wantErrContains string
+	}{
+		{
+			name: "default levels",
+			data: `
+indices:
+  pii-*: restricted
+  logs-*: internal
+`,
+			wantLevels:  DefaultClassificationLevels,
+			wantIndices: map[string]string{"pii-*": "restricted", "logs-*": "internal"},
+		},
+		{
+			name:        "custom levels",
+			data:        `{"levels": ["low", "high"], "indices": {"payments-*": "high"}}`,
+			wantLevels:  []string{"low", "high"},
+			wantIndices: map[string]string{"payments-*": "high"},
+		},
+		{
+			name:            "unknown level",
+			data:            `{"indices": {"pii-*": "secret"}}`,
+			wantErrContains: "unknown level",
+		},
+		{
+			name:            "duplicate level",
+			data:            `{"levels": ["low", "low"], "indices": {"pii-*": "low"}}`,
+			wantErrContains: "more than once",
+		},
+		{
+			name:            "no indices",
+			data:            `levels: [low, high]`,
+			wantErrContains: "no indices",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classifications, err := ParseClassifications([]byte(tt.data))
+			if tt.wantErrContains != "" {
+				assert.ErrorContains(t, err, tt.wantErrContains)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLevels, classifications.Levels)
+			assert.Equal(t, tt.wantIndices, classifications.Indices)
+		})
+	}
+}
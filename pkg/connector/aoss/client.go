@@ -0,0 +1,333 @@
+package aoss
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	// signingName is the SigV4 service name of the OpenSearch Serverless control plane.
+	signingName = "aoss"
+	// targetPrefix prefixes the operation name in the X-Amz-Target header.
+	targetPrefix = "OpenSearchServerless."
+	// contentType is the AWS JSON 1.0 protocol content type.
+	contentType = "application/x-amz-json-1.0"
+
+	// policyTypeData selects data access policies, as opposed to network or encryption policies.
+	policyTypeData = "data"
+)
+
+// Client calls the OpenSearch Serverless control plane API, signing every request with SigV4.
+type Client struct {
+	httpClient  *uhttp.BaseHttpClient
+	endpoint    *url.URL
+	region      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+}
+
+// Option configures optional behaviour of a Client.
+type Option func(*options)
+
+type options struct {
+	endpoint       string
+	credentials    aws.CredentialsProvider
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	tlsMinVersion  string
+}
+
+// WithEndpoint sends requests to endpoint instead of https://aoss.{region}.amazonaws.com, e.g. a VPC endpoint
+// or a local fake.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithCredentials signs requests with the given credentials instead of the default AWS credential chain.
+func WithCredentials(credentials aws.CredentialsProvider) Option {
+	return func(o *options) {
+		o.credentials = credentials
+	}
+}
+
+// WithTimeouts bounds dialing and the TLS handshake by connect, and waiting for a response by read, as for the
+// cluster client. Zero keeps the cluster client's defaults.
+func WithTimeouts(connect, read time.Duration) Option {
+	return func(o *options) {
+		o.connectTimeout = connect
+		o.readTimeout = read
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version, either "1.2" or "1.3".
+func WithMinTLSVersion(version string) Option {
+	return func(o *options) {
+		o.tlsMinVersion = version
+	}
+}
+
+// NewClient creates a client for the OpenSearch Serverless API in region. Credentials come from the default AWS
+// credential chain unless WithCredentials is used.
+func NewClient(ctx context.Context, region string, opts ...Option) (*Client, error) {
+	if region == "" {
+		return nil, fmt.Errorf("an AWS region is required for OpenSearch Serverless")
+	}
+
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.endpoint == "" {
+		o.endpoint = fmt.Sprintf("https://aoss.%s.amazonaws.com", region)
+	}
+	endpoint, err := url.Parse(o.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint %s: %w", o.endpoint, err)
+	}
+
+	if o.credentials == nil {
+		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+		}
+		o.credentials = cfg.Credentials
+	}
+
+	baseClient, err := client.NewHTTPClient(o.connectTimeout, o.readTimeout, o.tlsMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := uhttp.NewBaseHttpClientWithContext(ctx, baseClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client: %w", err)
+	}
+
+	return &Client{
+		httpClient:  httpClient,
+		endpoint:    endpoint,
+		region:      region,
+		credentials: o.credentials,
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// apiError is the error body of the AWS JSON protocol.
+type apiError struct {
+	Type    string `json:"__type"`
+	Msg     string `json:"message"`
+	MsgCaps string `json:"Message"`
+}
+
+func (e *apiError) Message() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.MsgCaps
+	}
+	return fmt.Sprintf("%s: %s", e.Type, msg)
+}
+
+// call invokes an API operation with input as the JSON body and decodes the result into output.
+func (c *Client) call(ctx context.Context, operation string, input, output interface{}) (*v2.RateLimitDescription, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", operation, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Target", targetPrefix+operation)
+
+	credentials, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	payloadHash := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(payloadHash[:]), signingName, c.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	rl := &v2.RateLimitDescription{}
+	resp, err := c.httpClient.Do(req,
+		uhttp.WithJSONResponse(output),
+		uhttp.WithErrorResponse(&apiError{}),
+		uhttp.WithRatelimitData(rl),
+	)
+	if err != nil {
+		return rl, fmt.Errorf("%s failed: %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	return rl, nil
+}
+
+// ListCollections lists the collections in the region.
+func (c *Client) ListCollections(ctx context.Context) ([]Collection, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	var collections []Collection
+	var rl *v2.RateLimitDescription
+	nextToken := ""
+	for {
+		input := map[string]interface{}{}
+		if nextToken != "" {
+			input["nextToken"] = nextToken
+		}
+
+		var page struct {
+			CollectionSummaries []Collection `json:"collectionSummaries"`
+			NextToken           string       `json:"nextToken"`
+		}
+		pageRl, err := c.call(ctx, "ListCollections", input, &page)
+		rl = mostRestrictive(rl, pageRl)
+		if err != nil {
+			return nil, rl, fmt.Errorf("failed to list collections: %w", err)
+		}
+
+		collections = append(collections, page.CollectionSummaries...)
+		if page.NextToken == "" {
+			break
+		}
+		nextToken = page.NextToken
+	}
+
+	l.Debug("retrieved collections", zap.Int("count", len(collections)))
+	return collections, rl, nil
+}
+
+// GetDataAccessPolicies lists the data access policies in the region together with their documents.
+func (c *Client) GetDataAccessPolicies(ctx context.Context) ([]AccessPolicy, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	var names []string
+	var rl *v2.RateLimitDescription
+	nextToken := ""
+	for {
+		input := map[string]interface{}{"type": policyTypeData}
+		if nextToken != "" {
+			input["nextToken"] = nextToken
+		}
+
+		var page struct {
+			AccessPolicySummaries []struct {
+				Name string `json:"name"`
+			} `json:"accessPolicySummaries"`
+			NextToken string `json:"nextToken"`
+		}
+		pageRl, err := c.call(ctx, "ListAccessPolicies", input, &page)
+		rl = mostRestrictive(rl, pageRl)
+		if err != nil {
+			return nil, rl, fmt.Errorf("failed to list data access policies: %w", err)
+		}
+
+		for _, summary := range page.AccessPolicySummaries {
+			names = append(names, summary.Name)
+		}
+		if page.NextToken == "" {
+			break
+		}
+		nextToken = page.NextToken
+	}
+
+	policies := make([]AccessPolicy, 0, len(names))
+	for _, name := range names {
+		policy, policyRl, err := c.GetDataAccessPolicy(ctx, name)
+		rl = mostRestrictive(rl, policyRl)
+		if err != nil {
+			return nil, rl, err
+		}
+		policies = append(policies, *policy)
+	}
+
+	l.Debug("retrieved data access policies", zap.Int("count", len(policies)))
+	return policies, rl, nil
+}
+
+// GetDataAccessPolicy reads a data access policy and parses its document.
+func (c *Client) GetDataAccessPolicy(ctx context.Context, name string) (*AccessPolicy, *v2.RateLimitDescription, error) {
+	var out struct {
+		AccessPolicyDetail struct {
+			Name          string          `json:"name"`
+			Description   string          `json:"description"`
+			PolicyVersion string          `json:"policyVersion"`
+			Policy        json.RawMessage `json:"policy"`
+		} `json:"accessPolicyDetail"`
+	}
+	rl, err := c.call(ctx, "GetAccessPolicy", map[string]string{"name": name, "type": policyTypeData}, &out)
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get data access policy %s: %w", name, err)
+	}
+
+	detail := out.AccessPolicyDetail
+	statements, err := parsePolicyDocument(detail.Policy)
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to parse data access policy %s: %w", name, err)
+	}
+
+	return &AccessPolicy{
+		Name:          detail.Name,
+		Description:   detail.Description,
+		PolicyVersion: detail.PolicyVersion,
+		Statements:    statements,
+	}, rl, nil
+}
+
+// mostRestrictive returns the rate limit description of two calls that leaves the least headroom: an exceeded
+// limit over one that is not, and otherwise the one with fewer requests remaining.
+func mostRestrictive(a, b *v2.RateLimitDescription) *v2.RateLimitDescription {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case (a.GetStatus() == v2.RateLimitDescription_STATUS_OVERLIMIT) != (b.GetStatus() == v2.RateLimitDescription_STATUS_OVERLIMIT):
+		if b.GetStatus() == v2.RateLimitDescription_STATUS_OVERLIMIT {
+			return b
+		}
+		return a
+	case b.GetLimit() > 0 && (a.GetLimit() == 0 || b.GetRemaining() < a.GetRemaining()):
+		return b
+	default:
+		return a
+	}
+}
+
+// parsePolicyDocument decodes a policy document. The API returns it as a JSON document, but it is also accepted
+// as a string holding the JSON, which is how it is written.
+func parsePolicyDocument(raw json.RawMessage) ([]PolicyStatement, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		raw = json.RawMessage(s)
+	}
+
+	var statements []PolicyStatement
+	if err := json.Unmarshal(raw, &statements); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
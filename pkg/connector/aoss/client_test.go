@@ -0,0 +1,208 @@
+package aoss
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newFakeServerless serves the OpenSearch Serverless operations used by the client. Policies are keyed by name.
+func newFakeServerless(t *testing.T, collections []Collection, policies map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"), "request is not SigV4 signed")
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/aoss/aws4_request")
+
+		body, _ := io.ReadAll(r.Body)
+		var input map[string]string
+		_ = json.Unmarshal(body, &input)
+
+		w.Header().Set("Content-Type", contentType)
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), targetPrefix) {
+		case "ListCollections":
+			// Serve one collection per page to exercise pagination.
+			idx := 0
+			if input["nextToken"] != "" {
+				idx = int(input["nextToken"][0] - '0')
+			}
+			page := map[string]interface{}{"collectionSummaries": collections[idx : idx+1]}
+			if idx+1 < len(collections) {
+				page["nextToken"] = string(rune('0' + idx + 1))
+			}
+			_ = json.NewEncoder(w).Encode(page)
+		case "ListAccessPolicies":
+			assert.Equal(t, "data", input["type"])
+			var summaries []map[string]string
+			for name := range policies {
+				summaries = append(summaries, map[string]string{"name": name, "type": "data"})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"accessPolicySummaries": summaries})
+		case "GetAccessPolicy":
+			policy, ok := policies[input["name"]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"policy not found"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"accessPolicyDetail":{"name":"` + input["name"] + `","type":"data","policyVersion":"v1","policy":` + policy + `}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"UnknownOperationException"}`))
+		}
+	}))
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	client, err := NewClient(context.Background(), "us-east-1",
+		WithEndpoint(server.URL),
+		WithCredentials(credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")),
+	)
+	assert.NoError(t, err)
+	return client
+}
+
+func TestListCollections(t *testing.T) {
+	server := newFakeServerless(t, []Collection{
+		{ID: "1", Name: "logs", ARN: "arn:aws:aoss:us-east-1:123456789012:collection/1", Status: "ACTIVE"},
+		{ID: "2", Name: "metrics", ARN: "arn:aws:aoss:us-east-1:123456789012:collection/2", Status: "ACTIVE"},
+	}, nil)
+	defer server.Close()
+
+	collections, _, err := newTestClient(t, server).ListCollections(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, collections, 2)
+	assert.Equal(t, "logs", collections[0].Name)
+	assert.Equal(t, "metrics", collections[1].Name)
+}
+
+func TestGetDataAccessPolicies(t *testing.T) {
+	server := newFakeServerless(t, nil, map[string]string{
+		// The document is returned either inline or as a JSON string.
+		"logs-read": `[{"Rules":[{"ResourceType":"index","Resource":["index/logs/*"],"Permission":["aoss:ReadDocument","aoss:DescribeIndex"]}],` +
+			`"Principal":["arn:aws:iam::123456789012:role/analyst","saml/123456789012/okta/group/analysts"]}]`,
+		"admins": `"[{\"Rules\":[{\"ResourceType\":\"collection\",\"Resource\":[\"collection/*\"],\"Permission\":[\"aoss:*\"]}],\"Principal\":[\"saml/123456789012/okta/user/alice\"]}]"`,
+	})
+	defer server.Close()
+
+	policies, _, err := newTestClient(t, server).GetDataAccessPolicies(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	byName := map[string]AccessPolicy{}
+	for _, p := range policies {
+		byName[p.Name] = p
+	}
+
+	logs := byName["logs-read"].Statements[0]
+	assert.Equal(t, []string{"index/logs/*"}, logs.Rules[0].Resource)
+	assert.Len(t, logs.Principal, 2)
+
+	admins := byName["admins"].Statements[0]
+	assert.Equal(t, []string{"saml/123456789012/okta/user/alice"}, admins.Principal)
+	assert.True(t, admins.Rules[0].MatchesCollection("logs"))
+}
+
+func TestGetDataAccessPolicyNotFound(t *testing.T) {
+	server := newFakeServerless(t, nil, nil)
+	defer server.Close()
+
+	_, _, err := newTestClient(t, server).GetDataAccessPolicy(context.Background(), "missing")
+	assert.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, err.Error(), "ResourceNotFoundException")
+}
+
+func TestReadTimeout(t *testing.T) {
+	// The endpoint accepts the request but does not answer until the test ends.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewClient(context.Background(), "us-east-1",
+		WithEndpoint(server.URL),
+		WithCredentials(credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")),
+		WithTimeouts(time.Second, 100*time.Millisecond),
+	)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	_, _, err = client.ListCollections(context.Background())
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestPolicyRuleMatching(t *testing.T) {
+	collectionRule := PolicyRule{
+		ResourceType: "collection",
+		Resource:     []string{"collection/logs-*"},
+		Permission:   []string{"aoss:DescribeCollectionItems"},
+	}
+	assert.True(t, collectionRule.MatchesCollection("logs-prod"))
+	assert.False(t, collectionRule.MatchesCollection("metrics"))
+	assert.True(t, collectionRule.Allows("DescribeCollectionItems"))
+	assert.False(t, collectionRule.Allows("CreateCollectionItems"))
+
+	indexRule := PolicyRule{
+		ResourceType: "index",
+		Resource:     []string{"index/logs-*/app-*", "index/metrics/*"},
+		Permission:   []string{"aoss:*"},
+	}
+	assert.False(t, indexRule.MatchesCollection("logs-prod"))
+	assert.Equal(t, []string{"app-*"}, indexRule.IndexPatterns("logs-prod"))
+	assert.Equal(t, []string{"*"}, indexRule.IndexPatterns("metrics"))
+	assert.Empty(t, indexRule.IndexPatterns("traces"))
+	assert.True(t, indexRule.Allows("WriteDocument"))
+}
+
+func TestParsePrincipal(t *testing.T) {
+	tests := []struct {
+		principal string
+		want      Principal
+		ok        bool
+	}{
+		{"arn:aws:iam::123456789012:role/admin", Principal{Kind: PrincipalIAM, Name: "arn:aws:iam::123456789012:role/admin"}, true},
+		{"saml/123456789012/okta/user/alice@example.com", Principal{Kind: PrincipalUser, Name: "alice@example.com"}, true},
+		{"saml/123456789012/okta/group/analysts", Principal{Kind: PrincipalGroup, Name: "analysts"}, true},
+		{"iamidentitycenter/ssoins-1234/group/abcd-1234", Principal{Kind: PrincipalGroup, Name: "abcd-1234"}, true},
+		{"saml/123456789012/okta", Principal{}, false},
+		{"everyone", Principal{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			got, ok := ParsePrincipal(tt.principal)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMostRestrictive(t *testing.T) {
+	ok := &v2.RateLimitDescription{Status: v2.RateLimitDescription_STATUS_OK, Limit: 100, Remaining: 40}
+	low := &v2.RateLimitDescription{Status: v2.RateLimitDescription_STATUS_OK, Limit: 100, Remaining: 5}
+	over := &v2.RateLimitDescription{Status: v2.RateLimitDescription_STATUS_OVERLIMIT}
+	unknown := &v2.RateLimitDescription{}
+
+	assert.Equal(t, ok, mostRestrictive(nil, ok))
+	assert.Equal(t, ok, mostRestrictive(ok, nil))
+	assert.Equal(t, low, mostRestrictive(ok, low))
+	assert.Equal(t, low, mostRestrictive(low, ok))
+	assert.Equal(t, over, mostRestrictive(low, over))
+	assert.Equal(t, over, mostRestrictive(over, low))
+	assert.Equal(t, ok, mostRestrictive(ok, unknown))
+	assert.Equal(t, ok, mostRestrictive(unknown, ok))
+}
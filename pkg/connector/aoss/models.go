@@ -0,0 +1,153 @@
+package aoss
+
+import (
+	"path"
+	"strings"
+)
+
+// Resource types used in data access policy rules.
+const (
+	ResourceTypeCollection = "collection"
+	ResourceTypeIndex      = "index"
+)
+
+// CollectionPermissions are the data access permissions that apply to collections, without the aoss: prefix.
+var CollectionPermissions = []string{
+	"CreateCollectionItems",
+	"DeleteCollectionItems",
+	"UpdateCollectionItems",
+	"DescribeCollectionItems",
+}
+
+// IndexPermissions are the data access permissions that apply to indexes, without the aoss: prefix.
+var IndexPermissions = []string{
+	"CreateIndex",
+	"DeleteIndex",
+	"UpdateIndex",
+	"DescribeIndex",
+	"ReadDocument",
+	"WriteDocument",
+}
+
+// Collection is a serverless collection as listed by ListCollections.
+type Collection struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	ARN    string `json:"arn"`
+	Status string `json:"status"`
+}
+
+// AccessPolicy is a data access policy and its parsed document.
+type AccessPolicy struct {
+	Name          string
+	Description   string
+	PolicyVersion string
+	Statements    []PolicyStatement
+}
+
+// PolicyStatement grants the permissions of its rules to each of its principals.
+type PolicyStatement struct {
+	Rules       []PolicyRule `json:"Rules"`
+	Principal   []string     `json:"Principal"`
+	Description string       `json:"Description,omitempty"`
+}
+
+// PolicyRule grants permissions on collections or indexes. Resources are "collection/<name>" or
+// "index/<collection>/<index>", where names may contain * wildcards.
+type PolicyRule struct {
+	ResourceType string   `json:"ResourceType"`
+	Resource     []string `json:"Resource"`
+	Permission   []string `json:"Permission"`
+}
+
+// Allows reports whether the rule grants permission, given without the aoss: prefix. Rule permissions may use
+// wildcards such as aoss:*.
+func (r PolicyRule) Allows(permission string) bool {
+	want := strings.ToLower("aoss:" + permission)
+	for _, p := range r.Permission {
+		if matchPattern(strings.ToLower(p), want) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesCollection reports whether a collection rule applies to the named collection.
+func (r PolicyRule) MatchesCollection(name string) bool {
+	if !strings.EqualFold(r.ResourceType, ResourceTypeCollection) {
+		return false
+	}
+	for _, resource := range r.Resource {
+		pattern, ok := strings.CutPrefix(resource, "collection/")
+		if ok && matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexPatterns returns the index patterns an index rule grants within the named collection.
+func (r PolicyRule) IndexPatterns(collection string) []string {
+	if !strings.EqualFold(r.ResourceType, ResourceTypeIndex) {
+		return nil
+	}
+	var patterns []string
+	for _, resource := range r.Resource {
+		rest, ok := strings.CutPrefix(resource, "index/")
+		if !ok {
+			continue
+		}
+		collectionPattern, indexPattern, ok := strings.Cut(rest, "/")
+		if ok && matchPattern(collectionPattern, collection) {
+			patterns = append(patterns, indexPattern)
+		}
+	}
+	return patterns
+}
+
+// matchPattern matches a policy resource or permission against a value. * matches any run of characters.
+func matchPattern(pattern, value string) bool {
+	if pattern == "*" {
+		return true
+	}
+	// Policy names cannot contain /, so path matching is exact for everything but *.
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
+
+// PrincipalKind classifies a data access policy principal.
+type PrincipalKind string
+
+const (
+	// PrincipalIAM is an IAM user or role ARN.
+	PrincipalIAM PrincipalKind = "iam"
+	// PrincipalUser is a SAML or IAM Identity Center user.
+	PrincipalUser PrincipalKind = "user"
+	// PrincipalGroup is a SAML or IAM Identity Center group.
+	PrincipalGroup PrincipalKind = "group"
+)
+
+// Principal is a parsed data access policy principal.
+type Principal struct {
+	Kind PrincipalKind
+	// Name is the ARN of IAM principals and the user or group name otherwise.
+	Name string
+}
+
+// ParsePrincipal classifies a principal such as "arn:aws:iam::123456789012:role/admin",
+// "saml/123456789012/myprovider/user/alice" or "iamidentitycenter/ssoins-1234/group/abcd".
+func ParsePrincipal(principal string) (Principal, bool) {
+	if strings.HasPrefix(principal, "arn:") {
+		return Principal{Kind: PrincipalIAM, Name: principal}, true
+	}
+	if !strings.HasPrefix(principal, "saml/") && !strings.HasPrefix(principal, "iamidentitycenter/") {
+		return Principal{}, false
+	}
+	if _, name, ok := strings.Cut(principal, "/user/"); ok && name != "" {
+		return Principal{Kind: PrincipalUser, Name: name}, true
+	}
+	if _, name, ok := strings.Cut(principal, "/group/"); ok && name != "" {
+		return Principal{Kind: PrincipalGroup, Name: name}, true
+	}
+	return Principal{}, false
+}
@@ -0,0 +1,146 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	batonResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type apiKeyBuilder struct {
+	clusters     *clusterSet
+	resourceType *v2.ResourceType
+}
+
+func (o *apiKeyBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *apiKeyBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	cl := o.clusters.forParent(parentResourceID)
+	if cl == nil || !cl.client.Supports(client.CapabilityAPIKeys) {
+		return nil, "", nil, nil
+	}
+
+	var resources []*v2.Resource
+	var annos annotations.Annotations
+	keys, rl, err := cl.client.GetAPIKeys(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("failed to get API keys: %w", err)
+	}
+
+	for _, key := range keys {
+		traitOpts := []batonResource.SecretTraitOption{
+			batonResource.WithSecretCreatedAt(key.CreatedAt),
+		}
+		if !key.ExpiresAt.IsZero() {
+			traitOpts = append(traitOpts, batonResource.WithSecretExpiresAt(key.ExpiresAt))
+		}
+		if key.Owner != "" {
+			ownerID, err := batonResource.NewResourceID(userResourceType, cl.id(key.Owner))
+			if err != nil {
+				return nil, "", annos, fmt.Errorf("error creating user resource ID: %w", err)
+			}
+			traitOpts = append(traitOpts,
+				batonResource.WithSecretCreatedByID(ownerID),
+				batonResource.WithSecretIdentityID(ownerID),
+			)
+		}
+
+		name := key.Name
+		if name == "" {
+			name = key.ID
+		}
+
+		keyResource, err := batonResource.NewSecretResource(
+			name,
+			o.resourceType,
+			cl.id(key.ID),
+			traitOpts,
+			append(cl.parentOptions(), batonResource.WithDescription(apiKeyDescription(key)))...,
+		)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("failed to create API key resource: %w", err)
+		}
+
+		resources = append(resources, keyResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+func (o *apiKeyBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *apiKeyBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Delete invalidates the API key.
+func (o *apiKeyBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	cl, id, err := o.clusters.forID(resourceId.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := cl.client.CheckAPIKeyInvalidation(ctx); err != nil {
+		return nil, fmt.Errorf("cannot invalidate API key %s: %w", id, err)
+	}
+
+	var annos annotations.Annotations
+	rl, err := cl.client.InvalidateAPIKey(ctx, id)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			ctxzap.Extract(ctx).Debug("API key already invalidated", zap.String("id", id))
+			return annos, nil
+		}
+		return annos, fmt.Errorf("failed to invalidate API key: %w", err)
+	}
+
+	return annos, nil
+}
+
+// apiKeyDescription summarizes an API key's owner and role descriptors.
+func apiKeyDescription(key client.APIKey) string {
+	parts := []string{fmt.Sprintf("owner: %s (%s)", key.Owner, key.Realm)}
+	if len(key.RoleDescriptors) == 0 {
+		parts = append(parts, "role descriptors: none, inherits the owner's privileges")
+	} else {
+		parts = append(parts, "role descriptors: "+describeRoles(key.RoleDescriptors))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// describeRoles renders role descriptors compactly, e.g. "reader [cluster: monitor; logs-*: read]".
+func describeRoles(roles []client.Role) string {
+	rendered := make([]string, 0, len(roles))
+	for _, role := range roles {
+		var privileges []string
+		if len(role.ClusterPermissions) > 0 {
+			privileges = append(privileges, "cluster: "+strings.Join(role.ClusterPermissions, ", "))
+		}
+		for _, index := range role.IndexPermissions {
+			privileges = append(privileges, strings.Join(index.IndexPatterns, ", ")+": "+strings.Join(index.AllowedActions, ", "))
+		}
+		rendered = append(rendered, fmt.Sprintf("%s [%s]", role.Name, strings.Join(privileges, "; ")))
+	}
+	return strings.Join(rendered, ", ")
+}
+
+func newAPIKeyBuilder(clusters *clusterSet) *apiKeyBuilder {
+	return &apiKeyBuilder{
+		clusters:     clusters,
+		resourceType: apiKeyResourceType,
+	}
+}
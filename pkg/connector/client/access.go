@@ -0,0 +1,342 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Principal prefixes of AccessPath.Principal.
+const (
+	PrincipalUser        = "user:"
+	PrincipalBackendRole = "backend_role:"
+)
+
+// Scopes of AccessPath.Scope.
+const (
+	ScopeCluster = "cluster"
+	ScopeIndex   = "index"
+)
+
+// AccessPath is one chain through which a principal is allowed an action: the principal, how it holds the
+// role, the role, the permission the role lists, the action groups the permission expands through and the
+// concrete action.
+type AccessPath struct {
+	// Principal is a user or backend role, such as "user:alice" or "backend_role:ops". Mapped users and backend
+	// roles can be patterns, and backend roles required together are joined with "+".
+	Principal string `json:"principal"`
+	// Via is "role_mapping" when the role mapping names the principal, "user" when the role is assigned on the
+	// user and "backend_role:<name>" when a user holds the role through one of its backend roles.
+	Via          string   `json:"via"`
+	Role         string   `json:"role"`
+	Scope        string   `json:"scope"`
+	IndexPattern string   `json:"index_pattern,omitempty"`
+	Permission   string   `json:"permission"`
+	ActionGroups []string `json:"action_groups,omitempty"`
+	Action       string   `json:"action"`
+	// Restrictions summarizes the document and field level security of an index permission.
+	Restrictions string `json:"restrictions,omitempty"`
+	// Partial is set when an index query is broader than the role's index pattern, so the role only covers
+	// some of the queried indices.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// AccessModel is a snapshot of a cluster's security configuration that answers effective access queries.
+type AccessModel struct {
+	Roles    []Role
+	Mappings []RoleMapping
+	Users    []User
+	// ClusterGroups and IndexGroups resolve the cluster and index permissions of roles. They differ on
+	// Elasticsearch, whose cluster and index privileges share names.
+	ClusterGroups ActionGroups
+	IndexGroups   ActionGroups
+	// DirectRoles is set when users' own roles are not part of Mappings, which is the case for the security
+	// plugin but not for Elasticsearch.
+	DirectRoles bool
+	Now         time.Time
+}
+
+// LoadAccessModel reads the roles, role mappings, users and action groups of the cluster. When the action groups
+// cannot be read, the built-in ones are used.
+func LoadAccessModel(ctx context.Context, c *Client) (*AccessModel, error) {
+	roles, _, err := c.GetRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mappings, _, err := c.GetRoleMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users, _, err := c.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Without the cluster's action groups, permissions are still resolved through the built-in ones.
+	clusterGroups, indexGroups, _, err := c.RoleActionGroups(ctx)
+	if err != nil {
+		ctxzap.Extract(ctx).Warn("failed to get action groups, using the built-in ones", zap.Error(err))
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	sort.Slice(users, func(i, j int) bool { return users[i].UserIdentifier < users[j].UserIdentifier })
+
+	return &AccessModel{
+		Roles:         roles,
+		Mappings:      mappings,
+		Users:         users,
+		ClusterGroups: clusterGroups,
+		IndexGroups:   indexGroups,
+		DirectRoles:   c.Flavor() != FlavorElasticsearch,
+		Now:           time.Now(),
+	}, nil
+}
+
+func (m *AccessModel) role(name string) (Role, bool) {
+	for _, role := range m.Roles {
+		if role.Name == name {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
+
+func (m *AccessModel) user(name string) (User, bool) {
+	for _, user := range m.Users {
+		if user.UserIdentifier == name {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// userRoles returns the roles a user holds. Elasticsearch users' own roles are already part of the mappings.
+func (m *AccessModel) userRoles(user User) []RoleAssignment {
+	if !m.DirectRoles {
+		user.OpendistroSecurityRoles = nil
+	}
+	return UserRoles(user, m.Mappings)
+}
+
+// UserAccess returns everything a user is allowed, with the user's variables substituted into templated index
+// permissions. Users that are not internal users, such as LDAP or SAML users, are evaluated by name against the
+// role mappings only.
+func (m *AccessModel) UserAccess(name string) []AccessPath {
+	user, ok := m.user(name)
+	if !ok {
+		user = User{UserIdentifier: name}
+	}
+	if user.Enabled != nil && !*user.Enabled {
+		return nil
+	}
+
+	assignments := m.userRoles(user)
+	securityRoles := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		securityRoles = append(securityRoles, assignment.Role)
+	}
+	userContext := NewUserContext(user, securityRoles)
+
+	var paths []AccessPath
+	for _, assignment := range assignments {
+		role, ok := m.role(assignment.Role)
+		if !ok {
+			continue
+		}
+		for _, via := range assignment.Sources {
+			base := AccessPath{Principal: PrincipalUser + name, Via: via, Role: role.Name}
+			paths = append(paths, m.rolePaths(base, role, func(perm IndexPermission) IndexPermission {
+				return userContext.Apply(perm)
+			})...)
+		}
+	}
+	return paths
+}
+
+// BackendRoleAccess returns everything the role mappings allow a backend role. Templated index permissions are
+// reported with their variables, since they depend on the user.
+func (m *AccessModel) BackendRoleAccess(backendRole string) []AccessPath {
+	var paths []AccessPath
+	for _, mapping := range m.Mappings {
+		for _, pattern := range mapping.BackendRoles {
+			if !MatchPattern(pattern, backendRole) {
+				continue
+			}
+			role, ok := m.role(mapping.Name)
+			if !ok {
+				continue
+			}
+			base := AccessPath{Principal: PrincipalBackendRole + pattern, Via: "role_mapping", Role: role.Name}
+			paths = append(paths, m.rolePaths(base, role, nil)...)
+		}
+	}
+	return paths
+}
+
+// rolePaths returns the paths for every action of a role, starting from base. apply adapts index permissions
+// to the principal and may be nil.
+func (m *AccessModel) rolePaths(base AccessPath, role Role, apply func(IndexPermission) IndexPermission) []AccessPath {
+	var paths []AccessPath
+	for _, permission := range role.ClusterPermissions {
+		for _, resolved := range m.ClusterGroups.Resolve(permission) {
+			path := base
+			path.Scope = ScopeCluster
+			path.Permission = permission
+			path.ActionGroups = resolved.Groups
+			path.Action = resolved.Action
+			paths = append(paths, path)
+		}
+	}
+
+	for _, perm := range role.IndexPermissions {
+		if apply != nil {
+			perm = apply(perm)
+		}
+		for _, pattern := range perm.IndexPatterns {
+			paths = append(paths, m.indexPaths(base, perm, pattern, "", false)...)
+		}
+	}
+	return paths
+}
+
+// indexPaths returns the paths for the actions that perm allows on pattern, limited to an access level unless
+// level is empty.
+func (m *AccessModel) indexPaths(base AccessPath, perm IndexPermission, pattern, level string, partial bool) []AccessPath {
+	var paths []AccessPath
+	for _, permission := range perm.AllowedActions {
+		for _, resolved := range m.IndexGroups.Resolve(permission) {
+			if level != "" && !slices.Contains(ActionAccessLevels([]string{resolved.Action}), level) {
+				continue
+			}
+			path := base
+			path.Scope = ScopeIndex
+			path.IndexPattern = pattern
+			path.Permission = permission
+			path.ActionGroups = resolved.Groups
+			path.Action = resolved.Action
+			path.Restrictions = perm.DescribeRestrictions()
+			path.Partial = partial
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// IndexAccess answers who is allowed an access level (read, write or admin) on the indices named by index, an
+// index name or pattern. All index actions are reported when level is empty. Roles whose patterns cover index
+// are reported in full; roles whose patterns only cover some of the indices index names are marked partial.
+func (m *AccessModel) IndexAccess(index, level string) ([]AccessPath, error) {
+	if level != "" && !slices.Contains(AccessLevels, level) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown access level %q, expected one of %s", level, strings.Join(AccessLevels, ", "))
+	}
+
+	var paths []AccessPath
+	for _, role := range m.Roles {
+		for _, perm := range role.IndexPermissions {
+			if perm.Templated() {
+				continue
+			}
+			for _, pattern := range perm.IndexPatterns {
+				partial, ok := m.covers(pattern, index)
+				if !ok {
+					continue
+				}
+				for _, holder := range m.holders(role.Name) {
+					paths = append(paths, m.indexPaths(holder, perm, pattern, level, partial)...)
+				}
+			}
+		}
+	}
+
+	// Templated permissions are evaluated for each internal user that holds the role.
+	for _, user := range m.Users {
+		if user.Enabled != nil && !*user.Enabled {
+			continue
+		}
+		assignments := m.userRoles(user)
+		securityRoles := make([]string, 0, len(assignments))
+		for _, assignment := range assignments {
+			securityRoles = append(securityRoles, assignment.Role)
+		}
+		userContext := NewUserContext(user, securityRoles)
+
+		for _, assignment := range assignments {
+			role, ok := m.role(assignment.Role)
+			if !ok {
+				continue
+			}
+			for _, perm := range role.IndexPermissions {
+				if !perm.Templated() {
+					continue
+				}
+				applied := userContext.Apply(perm)
+				for _, pattern := range applied.IndexPatterns {
+					partial, ok := m.covers(pattern, index)
+					if !ok {
+						continue
+					}
+					for _, via := range assignment.Sources {
+						base := AccessPath{Principal: PrincipalUser + user.UserIdentifier, Via: via, Role: role.Name}
+						paths = append(paths, m.indexPaths(base, applied, pattern, level, partial)...)
+					}
+				}
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// covers reports whether a role's index pattern applies to the queried index name or pattern: fully when the
+// pattern matches the query, and partially when the query, read as a pattern, matches the role's pattern.
+func (m *AccessModel) covers(pattern, query string) (partial bool, ok bool) {
+	if MatchIndexPattern(pattern, query, m.Now) {
+		return false, true
+	}
+	resolved, err := ResolveDateMath(pattern, m.Now)
+	if err != nil {
+		return false, false
+	}
+	if MatchPattern(query, resolved) {
+		return true, true
+	}
+	return false, false
+}
+
+// holders returns the principals that hold a role, as the start of their access paths.
+func (m *AccessModel) holders(roleName string) []AccessPath {
+	var holders []AccessPath
+	for _, mapping := range m.Mappings {
+		if mapping.Name != roleName {
+			continue
+		}
+		for _, user := range mapping.Users {
+			holders = append(holders, AccessPath{Principal: PrincipalUser + user, Via: "role_mapping", Role: roleName})
+		}
+		for _, backendRole := range mapping.BackendRoles {
+			holders = append(holders, AccessPath{Principal: PrincipalBackendRole + backendRole, Via: "role_mapping", Role: roleName})
+		}
+		if len(mapping.AndBackendRoles) > 0 {
+			holders = append(holders, AccessPath{
+				Principal: PrincipalBackendRole + strings.Join(mapping.AndBackendRoles, "+"),
+				Via:       "role_mapping",
+				Role:      roleName,
+			})
+		}
+	}
+
+	if m.DirectRoles {
+		for _, user := range m.Users {
+			if slices.Contains(user.OpendistroSecurityRoles, roleName) {
+				holders = append(holders, AccessPath{Principal: PrincipalUser + user.UserIdentifier, Via: "user", Role: roleName})
+			}
+		}
+	}
+	return holders
+}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// ActionGroup is a named set of actions and other action groups that roles can grant instead of listing
+// transport actions.
+type ActionGroup struct {
+	Name           string   `json:"-"`
+	AllowedActions []string `json:"allowed_actions"`
+	Type           string   `json:"type,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Reserved       bool     `json:"reserved,omitempty"`
+	Static         bool     `json:"static,omitempty"`
+}
+
+// UnmarshalJSON also accepts the legacy formats of Open Distro and Search Guard 6, which list the actions
+// directly or under "permissions".
+func (g *ActionGroup) UnmarshalJSON(data []byte) error {
+	var actions []string
+	if err := json.Unmarshal(data, &actions); err == nil {
+		g.AllowedActions = actions
+		return nil
+	}
+
+	type actionGroup ActionGroup
+	var raw struct {
+		actionGroup
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*g = ActionGroup(raw.actionGroup)
+	if len(g.AllowedActions) == 0 {
+		g.AllowedActions = raw.Permissions
+	}
+	return nil
+}
+
+// builtinActionGroups are the static action groups of the OpenSearch security plugin. Clusters return them
+// along with custom groups, so they only apply to names the cluster does not define itself.
+var builtinActionGroups = map[string][]string{
+	"unlimited":   {"*"},
+	"indices_all": {"indices:*"},
+	"cluster_all": {"cluster:*"},
+	"read":        {"indices:data/read*", "indices:admin/mappings/fields/get*", "indices:admin/resolve/index"},
+	"write":       {"indices:data/write*", "indices:admin/mapping/put"},
+	"delete":      {"indices:data/write/delete*"},
+	"crud":        {"read", "index", "delete"},
+	"search":      {"indices:data/read/search*", "indices:data/read/msearch*", "suggest"},
+	"suggest":     {"indices:data/read/suggest*"},
+	"get":         {"indices:data/read/get*", "indices:data/read/mget*"},
+	"index": {
+		"indices:data/write/index*", "indices:data/write/update*", "indices:admin/mapping/put", "indices:data/write/bulk*",
+	},
+	"create_index":    {"indices:admin/create", "indices:admin/mapping/put", "indices:admin/auto_create"},
+	"manage_aliases":  {"indices:admin/aliases*"},
+	"indices_monitor": {"indices:monitor/*"},
+	"data_access":     {"indices:data/*", "crud"},
+	"manage":          {"indices:monitor/*", "indices:admin/*"},
+	"cluster_monitor": {"cluster:monitor/*"},
+	"cluster_composite_ops_ro": {
+		"indices:data/read/mget", "indices:data/read/msearch", "indices:data/read/mtv", "indices:admin/aliases/exists*",
+		"indices:admin/aliases/get*", "indices:data/read/scroll", "indices:admin/resolve/index",
+	},
+	"cluster_composite_ops": {
+		"indices:data/write/bulk", "indices:admin/aliases*", "indices:data/write/reindex", "cluster_composite_ops_ro",
+	},
+	"manage_snapshots": {"cluster:admin/snapshot/*", "cluster:admin/repository/*"},
+	"cluster_manage_index_templates": {
+		"indices:admin/template/*", "indices:admin/index_template/*", "cluster:admin/component_template/*",
+	},
+	"cluster_manage_pipelines": {"cluster:admin/ingest/pipeline/*"},
+}
+
+// ActionGroups resolves action group names to the concrete action patterns they allow.
+type ActionGroups map[string][]string
+
+// NewActionGroups returns the built-in action groups overridden and extended by groups.
+func NewActionGroups(groups []ActionGroup) ActionGroups {
+	rv := make(ActionGroups, len(builtinActionGroups)+len(groups))
+	for name, actions := range builtinActionGroups {
+		rv[name] = actions
+	}
+	for _, group := range groups {
+		rv[group.Name] = group.AllowedActions
+	}
+	return rv
+}
+
+// Expand replaces action group names in actions, including groups nested in other groups, with the action
+// patterns they allow. Names that are not action groups, such as transport actions and wildcard patterns, are
+// kept as they are. A group that contains itself, directly or through other groups, is expanded once. The
+// result is sorted and free of duplicates.
+func (a ActionGroups) Expand(actions []string) []string {
+	seen := map[string]bool{}
+	var expand func(actions []string, path map[string]bool)
+	expand = func(actions []string, path map[string]bool) {
+		for _, action := range actions {
+			members, ok := a[action]
+			if !ok {
+				seen[action] = true
+				continue
+			}
+			if path[action] {
+				continue
+			}
+			path[action] = true
+			expand(members, path)
+			delete(path, action)
+		}
+	}
+	expand(actions, map[string]bool{})
+
+	rv := make([]string, 0, len(seen))
+	for action := range seen {
+		rv = append(rv, action)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// GetActionGroups returns the action groups defined on the cluster, including static ones. Elasticsearch has
+// no action groups.
+func (c *Client) GetActionGroups(ctx context.Context) ([]ActionGroup, *v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityActionGroups); err != nil {
+		return nil, nil, err
+	}
+
+	l := ctxzap.Extract(ctx)
+
+	raw := map[string]ActionGroup{}
+	rl, err := c.securityGet(ctx, &raw, "actiongroups")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get action groups: %w", err)
+	}
+
+	var groups []ActionGroup
+	for name, group := range raw {
+		if isSearchGuardMeta(name) {
+			continue
+		}
+		group.Name = name
+		groups = append(groups, group)
+	}
+
+	l.Debug("retrieved action groups", zap.Int("count", len(groups)))
+	return groups, rl, nil
+}
+
+// esIndexPrivilegeActions are the Elasticsearch index privileges, as the action patterns they allow.
+var esIndexPrivilegeActions = ActionGroups{
+	"all":                 {"indices:*"},
+	"read":                {"indices:data/read/*"},
+	"read_cross_cluster":  {"indices:data/read/*"},
+	"view_index_metadata": {"indices:admin/get", "indices:admin/mappings/get", "indices:admin/aliases/get", "indices:monitor/settings/get"},
+	"write":               {"indices:data/write/*"},
+	"index":               {"indices:data/write/index*", "indices:data/write/update*", "indices:data/write/bulk*"},
+	"create":              {"indices:data/write/index*", "indices:data/write/bulk*"},
+	"create_doc":          {"indices:data/write/index*", "indices:data/write/bulk*"},
+	"delete":              {"indices:data/write/delete*", "indices:data/write/bulk*"},
+	"create_index":        {"indices:admin/create"},
+	"auto_configure":      {"indices:admin/auto_create"},
+	"delete_index":        {"indices:admin/delete"},
+	"manage":              {"indices:admin/*", "indices:monitor/*"},
+	"monitor":             {"indices:monitor/*"},
+	"maintenance":         {"indices:admin/refresh*", "indices:admin/flush*", "indices:admin/forcemerge*"},
+}
+
+// IndexActionGroups returns the action groups that resolve the allowed actions of index permissions: the
+// cluster's action groups, or the index privileges of Elasticsearch.
+func (c *Client) IndexActionGroups(ctx context.Context) (ActionGroups, *v2.RateLimitDescription, error) {
+	if c.Flavor() == FlavorElasticsearch {
+		return esIndexPrivilegeActions, nil, nil
+	}
+
+	groups, rl, err := c.GetActionGroups(ctx)
+	if err != nil {
+		return nil, rl, err
+	}
+	return NewActionGroups(groups), rl, nil
+}
+
+// ResolvedAction is a concrete action pattern and the chain of action groups through which a permission
+// reaches it, outermost first. The chain is empty when the permission is the action itself.
+type ResolvedAction struct {
+	Action string   `json:"action"`
+	Groups []string `json:"action_groups,omitempty"`
+}
+
+// Resolve expands a permission like Expand and records, for each action, the action groups it was reached
+// through. An action reachable through several chains is reported with the first one found. The result is
+// sorted by action.
+func (a ActionGroups) Resolve(permission string) []ResolvedAction {
+	chains := map[string][]string{}
+	var resolve func(action string, path []string)
+	resolve = func(action string, path []string) {
+		members, ok := a[action]
+		if !ok {
+			if _, seen := chains[action]; !seen {
+				chains[action] = slices.Clone(path)
+			}
+			return
+		}
+		if slices.Contains(path, action) {
+			return
+		}
+		path = append(path, action)
+		for _, member := range members {
+			resolve(member, path)
+		}
+	}
+	resolve(permission, nil)
+
+	rv := make([]ResolvedAction, 0, len(chains))
+	for action, groups := range chains {
+		rv = append(rv, ResolvedAction{Action: action, Groups: groups})
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Action < rv[j].Action })
+	return rv
+}
+
+// esClusterPrivilegeActions are the Elasticsearch cluster privileges that grant broad or security access, as the
+// action patterns they allow. Other cluster privileges are kept as they are.
+var esClusterPrivilegeActions = ActionGroups{
+	"all":             {"cluster:*"},
+	"monitor":         {"cluster:monitor/*"},
+	"manage_security": {"cluster:admin/xpack/security/*"},
+}
+
+// ClusterActionGroups returns the action groups that resolve the cluster permissions of roles: the cluster's
+// action groups, or the cluster privileges of Elasticsearch.
+func (c *Client) ClusterActionGroups(ctx context.Context) (ActionGroups, *v2.RateLimitDescription, error) {
+	if c.Flavor() == FlavorElasticsearch {
+		return esClusterPrivilegeActions, nil, nil
+	}
+	return c.IndexActionGroups(ctx)
+}
+
+// RoleActionGroups returns the action groups that resolve the cluster and index permissions of roles. Clusters
+// without action groups only have the built-in ones. When the cluster's action groups cannot be read, for
+// example because the credential may not read them, the built-in ones are returned along with the error, so that
+// callers can report it and still resolve the permissions those cover.
+func (c *Client) RoleActionGroups(ctx context.Context) (ActionGroups, ActionGroups, *v2.RateLimitDescription, error) {
+	builtin := NewActionGroups(nil)
+	if !c.Supports(CapabilityActionGroups) && c.Flavor() != FlavorElasticsearch {
+		return builtin, builtin, nil, nil
+	}
+
+	clusterGroups, rl, err := c.ClusterActionGroups(ctx)
+	if err != nil {
+		return builtin, builtin, rl, err
+	}
+	indexGroups, rl, err := c.IndexActionGroups(ctx)
+	if err != nil {
+		return builtin, builtin, rl, err
+	}
+	return clusterGroups, indexGroups, rl, nil
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// esAPIKey is an API key as returned by GET /_security/api_key. Times are epoch milliseconds.
+type esAPIKey struct {
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Type            string                 `json:"type"`
+	Creation        int64                  `json:"creation"`
+	Expiration      int64                  `json:"expiration"`
+	Invalidated     bool                   `json:"invalidated"`
+	Username        string                 `json:"username"`
+	Realm           string                 `json:"realm"`
+	RoleDescriptors map[string]esRole      `json:"role_descriptors"`
+	Metadata        map[string]interface{} `json:"metadata"`
+}
+
+// esServiceAccount is a service account as returned by GET /_security/service.
+type esServiceAccount struct {
+	RoleDescriptor esRole `json:"role_descriptor"`
+}
+
+// esServiceCredentials is the response of GET /_security/service/{namespace}/{service}/credential.
+type esServiceCredentials struct {
+	Tokens           map[string]interface{} `json:"tokens"`
+	NodesCredentials struct {
+		FileTokens map[string]interface{} `json:"file_tokens"`
+	} `json:"nodes_credentials"`
+}
+
+// GetAPIKeys lists the API keys that have not been invalidated.
+func (c *Client) GetAPIKeys(ctx context.Context) ([]APIKey, *v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityAPIKeys); err != nil {
+		return nil, nil, err
+	}
+	l := ctxzap.Extract(ctx)
+
+	var raw struct {
+		APIKeys []esAPIKey `json:"api_keys"`
+	}
+	rl, err := c.securityGet(ctx, &raw, "api_key")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get API keys: %w", err)
+	}
+
+	var keys []APIKey
+	for _, k := range raw.APIKeys {
+		if k.Invalidated {
+			continue
+		}
+
+		key := APIKey{
+			ID:        k.ID,
+			Name:      k.Name,
+			Type:      k.Type,
+			Owner:     k.Username,
+			Realm:     k.Realm,
+			CreatedAt: time.UnixMilli(k.Creation),
+			Metadata:  k.Metadata,
+		}
+		if k.Expiration > 0 {
+			key.ExpiresAt = time.UnixMilli(k.Expiration)
+		}
+		key.RoleDescriptors = roleDescriptors(k.RoleDescriptors)
+		keys = append(keys, key)
+	}
+
+	l.Debug("retrieved API keys", zap.Int("count", len(keys)))
+	return keys, rl, nil
+}
+
+// InvalidateAPIKey revokes an API key by ID.
+func (c *Client) InvalidateAPIKey(ctx context.Context, id string) (*v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityAPIKeys); err != nil {
+		return nil, err
+	}
+
+	apiKeyUrl, err := getPath(c.baseURL.String(), c.securityPath, "api_key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key url: %w", err)
+	}
+
+	body := map[string][]string{"ids": {id}}
+	req, err := c.httpClient.NewRequest(ctx, http.MethodDelete, apiKeyUrl, uhttp.WithJSONBody(body), uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opWrite)
+
+	var result struct {
+		InvalidatedAPIKeys        []string `json:"invalidated_api_keys"`
+		PreviouslyInvalidatedKeys []string `json:"previously_invalidated_api_keys"`
+		ErrorCount                int      `json:"error_count"`
+	}
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(&result))
+	if err != nil {
+		return rl, fmt.Errorf("failed to invalidate API key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if result.ErrorCount > 0 {
+		return rl, fmt.Errorf("failed to invalidate API key %s", id)
+	}
+	if len(result.InvalidatedAPIKeys) == 0 && len(result.PreviouslyInvalidatedKeys) == 0 {
+		return rl, status.Errorf(codes.NotFound, "API key %s not found", id)
+	}
+
+	return rl, nil
+}
+
+// GetServiceAccounts lists the service accounts known to the cluster.
+func (c *Client) GetServiceAccounts(ctx context.Context) ([]ServiceAccount, *v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityServiceAccounts); err != nil {
+		return nil, nil, err
+	}
+
+	raw := map[string]esServiceAccount{}
+	rl, err := c.securityGet(ctx, &raw, "service")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get service accounts: %w", err)
+	}
+
+	var accounts []ServiceAccount
+	for principal, account := range raw {
+		accounts = append(accounts, ServiceAccount{
+			Principal:      principal,
+			RoleDescriptor: account.RoleDescriptor.toRole(principal),
+		})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Principal < accounts[j].Principal })
+
+	return accounts, rl, nil
+}
+
+// GetServiceAccountTokens lists the tokens of a service account, both those stored in the security index and
+// those read from service_tokens files on the nodes.
+func (c *Client) GetServiceAccountTokens(ctx context.Context, principal string) ([]ServiceAccountToken, *v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityServiceAccounts); err != nil {
+		return nil, nil, err
+	}
+
+	namespace, service, err := splitServicePrincipal(principal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var raw esServiceCredentials
+	rl, err := c.securityGet(ctx, &raw, "service", namespace, service, "credential")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get service account tokens: %w", err)
+	}
+
+	var tokens []ServiceAccountToken
+	for name := range raw.Tokens {
+		tokens = append(tokens, ServiceAccountToken{ServiceAccount: principal, Name: name, Source: TokenSourceIndex})
+	}
+	for name := range raw.NodesCredentials.FileTokens {
+		tokens = append(tokens, ServiceAccountToken{ServiceAccount: principal, Name: name, Source: TokenSourceFile})
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+
+	return tokens, rl, nil
+}
+
+// DeleteServiceAccountToken deletes a service account token stored in the security index. File tokens cannot
+// be deleted through the API.
+func (c *Client) DeleteServiceAccountToken(ctx context.Context, principal, name string) (*v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityServiceAccounts); err != nil {
+		return nil, err
+	}
+
+	namespace, service, err := splitServicePrincipal(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenUrl, err := getPath(c.baseURL.String(), c.securityPath, "service", namespace, service, "credential", "token", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service account token url: %w", err)
+	}
+
+	req, err := c.httpClient.NewRequest(ctx, http.MethodDelete, tokenUrl, uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opWrite)
+
+	var result struct {
+		Found bool `json:"found"`
+	}
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(&result))
+	if err != nil {
+		return rl, fmt.Errorf("failed to delete service account token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if !result.Found {
+		return rl, status.Errorf(codes.NotFound, "token %s of service account %s not found in the security index", name, principal)
+	}
+
+	return rl, nil
+}
+
+// splitServicePrincipal splits a service account principal such as "elastic/fleet-server".
+func splitServicePrincipal(principal string) (string, string, error) {
+	namespace, service, ok := strings.Cut(principal, "/")
+	if !ok || namespace == "" || service == "" {
+		return "", "", fmt.Errorf("invalid service account %q, expected namespace/service", principal)
+	}
+	return namespace, service, nil
+}
+
+// roleDescriptors converts the role descriptors of an API key, sorted by name.
+func roleDescriptors(raw map[string]esRole) []Role {
+	roles := make([]Role, 0, len(raw))
+	for name, r := range raw {
+		roles = append(roles, r.toRole(name))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
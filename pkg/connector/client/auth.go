@@ -0,0 +1,65 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+)
+
+// operation is the class of a security API call, used to pick the credential that makes it.
+type operation int
+
+const (
+	// opRead covers every call made while syncing.
+	opRead operation = iota
+	// opWrite covers provisioning calls such as role mapping patches and user creation.
+	opWrite
+)
+
+// authenticator adds credentials to an outgoing request.
+type authenticator interface {
+	authenticate(req *http.Request)
+}
+
+// basicAuth authenticates requests with an internal user's name and password.
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a basicAuth) authenticate(req *http.Request) {
+	req.SetBasicAuth(a.username, a.password)
+}
+
+const (
+	defaultProxyUserHeader  = "x-proxy-user"
+	defaultProxyRolesHeader = "x-proxy-roles"
+)
+
+// proxyAuth authenticates requests the way a trusted reverse proxy does for the security plugin's proxy auth
+// domain: the user and its backend roles are asserted in request headers. The cluster only honors these
+// headers from addresses listed as internal proxies, optionally combined with a client certificate.
+type proxyAuth struct {
+	userHeader  string
+	rolesHeader string
+	user        string
+	roles       []string
+}
+
+func (a proxyAuth) authenticate(req *http.Request) {
+	req.Header.Set(a.userHeader, a.user)
+	if len(a.roles) > 0 {
+		req.Header.Set(a.rolesHeader, strings.Join(a.roles, ","))
+	}
+}
+
+// authenticate adds the credential for the given operation class to req. Writes fall back to the read
+// credential when no separate write credential is configured.
+func (c *Client) authenticate(req *http.Request, op operation) {
+	auth := c.readAuth
+	if op == opWrite && c.writeAuth != nil {
+		auth = c.writeAuth
+	}
+	if auth != nil {
+		auth.authenticate(req)
+	}
+}
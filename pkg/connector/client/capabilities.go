@@ -0,0 +1,74 @@
+package client
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Capability is an optional security API feature whose availability depends on the flavor and version.
+type Capability string
+
+const (
+	CapabilityServiceAccounts Capability = "service accounts"
+	CapabilityAPIKeys         Capability = "API keys"
+	CapabilityActionGroups    Capability = "action groups"
+	CapabilityDataStreams     Capability = "data streams"
+	CapabilityAccount         Capability = "account"
+	CapabilityPermissionsInfo Capability = "permissionsinfo"
+)
+
+// capabilities lists, per feature, the flavors that offer it and the first cluster version that does. Flavors
+// missing from an entry never offer the feature.
+var capabilities = map[Capability]map[Flavor]Version{
+	CapabilityServiceAccounts: {
+		FlavorElasticsearch: {Major: 7, Minor: 13},
+	},
+	CapabilityAPIKeys: {
+		FlavorElasticsearch: {Major: 6, Minor: 7},
+	},
+	CapabilityActionGroups: {
+		FlavorOpenSearch:  {Major: 1},
+		FlavorOpenDistro:  {Major: 6},
+		FlavorSearchGuard: {Major: 6},
+	},
+	CapabilityDataStreams: {
+		FlavorOpenSearch:    {Major: 1},
+		FlavorElasticsearch: {Major: 7, Minor: 9},
+	},
+	CapabilityAccount: {
+		FlavorOpenSearch: {Major: 1},
+		FlavorOpenDistro: {Major: 7},
+	},
+	CapabilityPermissionsInfo: {
+		FlavorOpenSearch:  {Major: 1},
+		FlavorOpenDistro:  {Major: 6},
+		FlavorSearchGuard: {Major: 6},
+	},
+}
+
+// Version returns the cluster version, or the zero version when it could not be read.
+func (c *Client) Version() Version {
+	return c.version
+}
+
+// Require returns an error when the cluster does not offer a capability: Unimplemented when the security API
+// flavor lacks it, and FailedPrecondition when the cluster is older than the first version that has it. When
+// the version is unknown, the flavor alone decides.
+func (c *Client) Require(capability Capability) error {
+	minVersion, ok := capabilities[capability][c.Flavor()]
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "the %s API is not supported by the %s security API", capability, c.Flavor())
+	}
+
+	if !c.version.IsZero() && !c.version.AtLeast(minVersion) {
+		return status.Errorf(codes.FailedPrecondition, "the %s API requires %s %s or later, but the cluster runs %s",
+			capability, c.Flavor(), minVersion, c.version)
+	}
+
+	return nil
+}
+
+// Supports reports whether the cluster offers a capability.
+func (c *Client) Supports(capability Capability) bool {
+	return c.Require(capability) == nil
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"slices"
+	"sort"
+)
+
+// Classification assigns a data classification level to the indices an index pattern names.
+type Classification struct {
+	Pattern string
+	Level   string
+}
+
+// Classifications rates index access by the data classification of the indices it reaches. A nil
+// *Classifications classifies nothing.
+type Classifications struct {
+	// Levels lists the classification levels in increasing order of sensitivity.
+	Levels []string
+	Rules  []Classification
+}
+
+// NewClassifications returns the classifications of index patterns, given as a map from pattern to level.
+func NewClassifications(levels []string, indices map[string]string) *Classifications {
+	rules := make([]Classification, 0, len(indices))
+	for pattern, level := range indices {
+		rules = append(rules, Classification{Pattern: pattern, Level: level})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Pattern < rules[j].Pattern })
+	return &Classifications{Levels: levels, Rules: rules}
+}
+
+// Highest returns the most sensitive of the levels, or "" when none is set.
+func (c *Classifications) Highest(levels ...string) string {
+	highest := ""
+	for _, level := range levels {
+		if slices.Index(c.Levels, level) > slices.Index(c.Levels, highest) {
+			highest = level
+		}
+	}
+	return highest
+}
+
+// PatternLevel returns the highest classification of the indices an index pattern can name.
+func (c *Classifications) PatternLevel(pattern string) string {
+	if c == nil {
+		return ""
+	}
+	level := ""
+	for _, rule := range c.Rules {
+		if overlaps(pattern, rule.Pattern) {
+			level = c.Highest(level, rule.Level)
+		}
+	}
+	return level
+}
+
+// PermissionsLevel returns the highest classification that index permissions reach. User variables in index
+// patterns are read as wildcards, so templated permissions are rated by every index they can name for any user.
+func (c *Classifications) PermissionsLevel(perms []IndexPermission) string {
+	if c == nil {
+		return ""
+	}
+	level := ""
+	for _, perm := range perms {
+		if len(perm.AllowedActions) == 0 {
+			continue
+		}
+		for _, pattern := range perm.IndexPatterns {
+			level = c.Highest(level, c.PatternLevel(variablePattern.ReplaceAllString(pattern, "*")))
+		}
+	}
+	return level
+}
+
+// RoleClassification returns the highest classification of the named role's index permissions.
+func (m *AccessModel) RoleClassification(c *Classifications, name string) string {
+	role, ok := m.role(name)
+	if !ok {
+		return ""
+	}
+	return c.PermissionsLevel(role.IndexPermissions)
+}
+
+// UserClassification returns the highest classification a user reaches through its roles, with the user's
+// variables substituted into templated index permissions.
+func (m *AccessModel) UserClassification(c *Classifications, name string) string {
+	if c == nil {
+		return ""
+	}
+	user, ok := m.user(name)
+	if !ok {
+		user = User{UserIdentifier: name}
+	}
+
+	assignments := m.userRoles(user)
+	securityRoles := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		securityRoles = append(securityRoles, assignment.Role)
+	}
+	userContext := NewUserContext(user, securityRoles)
+
+	level := ""
+	for _, assignment := range assignments {
+		role, ok := m.role(assignment.Role)
+		if !ok {
+			continue
+		}
+		for _, perm := range role.IndexPermissions {
+			level = c.Highest(level, c.PermissionsLevel([]IndexPermission{userContext.Apply(perm)}))
+		}
+	}
+	return level
+}
+
+// BackendRoleClassification returns the highest classification of the roles mapped to a backend role.
+func (m *AccessModel) BackendRoleClassification(c *Classifications, backendRole string) string {
+	if c == nil {
+		return ""
+	}
+	level := ""
+	for _, mapping := range m.Mappings {
+		if allowsAny(mapping.BackendRoles, []string{backendRole}) {
+			level = c.Highest(level, m.RoleClassification(c, mapping.Name))
+		}
+	}
+	return level
+}
@@ -5,112 +5,284 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Client struct {
 	httpClient   *uhttp.BaseHttpClient
 	baseURL      *url.URL
-	username     string
-	password     string
+	readAuth     authenticator
+	writeAuth    authenticator
 	userMatchKey string
 	securityPath string
+	flavor       Flavor
+	version      Version
+	// detectErr holds the reason security API detection failed, reported by Validate.
+	detectErr  error
+	maxRetries int
+	// requestTimeout is the deadline for a single client call, including retries.
+	requestTimeout time.Duration
 }
 
-func (c *Client) detectSecurityAPIPath(ctx context.Context) error {
+// errUnauthorized is returned when the cluster rejects the connector's credentials.
+var errUnauthorized = errors.New("unauthorized: check credentials")
+
+// clusterVersion is the version block reported on the cluster root.
+type clusterVersion struct {
+	Distribution string `json:"distribution"`
+	Number       string `json:"number"`
+	BuildFlavor  string `json:"build_flavor"`
+}
+
+// getClusterVersion reads the version reported on the cluster root.
+func (c *Client) getClusterVersion(ctx context.Context) (*clusterVersion, error) {
 	rootUrl, err := getPath(c.baseURL.String(), "/")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rootUrl.String(), nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.SetBasicAuth(c.username, c.password)
+	c.authenticate(req, opRead)
 
-	resp, err := c.httpClient.Do(req)
+	resp, _, err := c.doRequest(req)
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		return nil, errUnauthorized
+	}
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		return fmt.Errorf("unauthorized: check credentials")
-	}
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var versionInfo struct {
-		Version struct {
-			Distribution string `json:"distribution"`
-			Number       string `json:"number"`
-		} `json:"version"`
+		Version clusterVersion `json:"version"`
 	}
 
 	if err := json.Unmarshal(body, &versionInfo); err != nil {
-		return fmt.Errorf("failed to parse version info: %w", err)
+		return nil, fmt.Errorf("failed to parse version info: %w", err)
 	}
 
-	// Check if distribution field exists and is "opensearch"
-	if versionInfo.Version.Distribution != "" && strings.EqualFold(versionInfo.Version.Distribution, "opensearch") {
-		c.securityPath = "/_plugins/_security/api"
-	} else {
-		// If there is no distribution field, or it is not "opensearch", use the OpenDistro security API for Elasticsearch
-		c.securityPath = "/_opendistro/_security/api"
+	return &versionInfo.Version, nil
+}
+
+// setVersion records the cluster version. Unparseable versions are logged and left unknown.
+func (c *Client) setVersion(ctx context.Context, number string) {
+	if number == "" {
+		return
+	}
+
+	v, err := parseVersion(number)
+	if err != nil {
+		ctxzap.Extract(ctx).Debug("failed to parse cluster version", zap.Error(err))
+		return
 	}
-	return nil
+	c.version = v
 }
 
-func NewClient(ctx context.Context, address string, username, password, userMatchKey string, insecureSkipVerify bool, credentials []byte) (*Client, error) {
+// detectSecurityAPIPath probes the security APIs that the cluster version makes likely, in order, and selects
+// the first one that responds. When the root cannot be read every flavor is probed.
+func (c *Client) detectSecurityAPIPath(ctx context.Context) error {
+	l := ctxzap.Extract(ctx)
+
+	version, err := c.getClusterVersion(ctx)
+	if errors.Is(err, errUnauthorized) {
+		return err
+	}
+	if err != nil {
+		l.Debug("failed to read cluster version, probing every security API", zap.Error(err))
+		version = &clusterVersion{}
+	}
+	c.setVersion(ctx, version.Number)
+
+	candidates := candidateFlavors(version.Distribution, version.BuildFlavor)
+	var probeErrs []error
+	for _, f := range candidates {
+		ok, probeErr := c.probeFlavor(ctx, f)
+		if ok {
+			c.setFlavor(f)
+			l.Info("detected security API",
+				zap.String("flavor", string(f)),
+				zap.String("path", c.securityPath),
+				zap.String("distribution", version.Distribution),
+				zap.String("version", version.Number),
+			)
+			return nil
+		}
+		if probeErr == nil {
+			continue
+		}
+		l.Debug("security API probe failed", zap.String("flavor", string(f)), zap.Error(probeErr))
+		// Rejected credentials and connection failures fail every probe the same way, so they are reported as
+		// they are. A 404 only means the flavor is not installed.
+		switch status.Code(probeErr) {
+		case codes.Unauthenticated:
+			return errUnauthorized
+		case codes.NotFound:
+		default:
+			probeErrs = append(probeErrs, fmt.Errorf("%s: %w", f, probeErr))
+		}
+	}
+
+	tried := make([]string, 0, len(candidates))
+	for _, f := range candidates {
+		tried = append(tried, string(f))
+	}
+	if len(probeErrs) > 0 {
+		return fmt.Errorf("no security API responded (tried %s): %w", strings.Join(tried, ", "), errors.Join(probeErrs...))
+	}
+	if err != nil {
+		return fmt.Errorf("no security API responded (tried %s): %w", strings.Join(tried, ", "), err)
+	}
+	return fmt.Errorf("no security API responded (tried %s)", strings.Join(tried, ", "))
+}
+
+func NewClient(
+	ctx context.Context,
+	address string,
+	username, password, userMatchKey string,
+	insecureSkipVerify bool,
+	credentials []byte,
+	opts ...Option,
+) (*Client, error) {
+	o := &options{
+		maxRetries:     defaultMaxRetries,
+		connectTimeout: defaultConnectTimeout,
+		readTimeout:    defaultReadTimeout,
+		requestTimeout: defaultRequestTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	tlsConfig, err := getTLSConfig(ctx, insecureSkipVerify, credentials)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TLS config: %w", err)
 	}
+	if err := applyTLSOptions(tlsConfig, o); err != nil {
+		return nil, fmt.Errorf("failed to create TLS config: %w", err)
+	}
+
+	parsedURL, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeURLs := []*url.URL{parsedURL}
+	for _, a := range o.addresses {
+		if a == "" || a == address {
+			continue
+		}
+		u, err := url.Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse address %s: %w", a, err)
+		}
+		nodeURLs = append(nodeURLs, u)
+	}
+
+	base := newHTTPTransport(tlsConfig, o.connectTimeout, o.readTimeout)
+	transport, err := newNodeTransport(ctx, nodeURLs, base, username, password, o.discoverNodes)
+	if err != nil {
+		return nil, err
+	}
 
 	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+		Transport: transport,
+		// Bound a single attempt, including reading the body, so a node that stops sending mid-response
+		// cannot hold the call until the request deadline.
+		Timeout: o.connectTimeout + o.readTimeout,
+	}
+
+	var wrapperOpts []uhttp.WrapperOption
+	if o.requestsPerSecond > 0 {
+		wrapperOpts = append(wrapperOpts, uhttp.WithRateLimiter(o.requestsPerSecond, time.Second))
 	}
 
-	baseClient, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
+	baseClient, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient, wrapperOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create http client: %w", err)
 	}
 
-	parsedURL, err := url.Parse(address)
-	if err != nil {
-		return nil, err
+	var readAuth authenticator
+	switch {
+	case o.proxyAuth != nil:
+		if o.proxyAuth.user == "" {
+			return nil, fmt.Errorf("a proxy user is required for proxy authentication")
+		}
+		if username != "" || password != "" {
+			return nil, fmt.Errorf("a username and password cannot be combined with proxy authentication")
+		}
+		readAuth = *o.proxyAuth
+	case username != "":
+		readAuth = basicAuth{username: username, password: password}
+	default:
+		return nil, fmt.Errorf("a username is required for basic authentication")
 	}
 
 	c := &Client{
-		httpClient:   baseClient,
-		baseURL:      parsedURL,
-		username:     username,
-		password:     password,
-		userMatchKey: userMatchKey,
+		httpClient:     baseClient,
+		baseURL:        parsedURL,
+		readAuth:       readAuth,
+		userMatchKey:   userMatchKey,
+		maxRetries:     o.maxRetries,
+		requestTimeout: o.requestTimeout,
 		// Set a default security path in case detection fails
-		securityPath: "/_plugins/_security/api",
+		securityPath: openSearchSecurityPath,
 	}
 
-	// Try to detect the security API path, but don't fail if it doesn't work
+	if o.writeUsername != "" {
+		c.writeAuth = basicAuth{username: o.writeUsername, password: o.writePassword}
+	}
+
+	flavor, err := parseFlavor(o.flavor)
+	if err != nil {
+		return nil, err
+	}
+
+	l := ctxzap.Extract(ctx)
+	if flavor != "" {
+		c.setFlavor(flavor)
+		// The version only gates optional features, so failing to read it is not an error here.
+		if version, err := c.getClusterVersion(ctx); err == nil {
+			c.setVersion(ctx, version.Number)
+		} else {
+			l.Debug("failed to read cluster version", zap.Error(err))
+		}
+		l.Info("using configured security API",
+			zap.String("flavor", string(flavor)),
+			zap.String("path", c.securityPath),
+			zap.Stringer("version", c.version),
+		)
+		return c, nil
+	}
+
+	// Detection failures are kept for Validate so the connector can still be built, e.g. to print its config.
 	if err := c.detectSecurityAPIPath(ctx); err != nil {
-		l := ctxzap.Extract(ctx)
-		l.Debug("failed to detect security API path, using default", zap.Error(err))
-		// Keep the default path that was set above
+		l.Warn("failed to detect security API, using default", zap.Error(err))
+		c.detectErr = err
 	}
 
 	return c, nil
@@ -164,26 +336,62 @@ func getPath(base string, elem ...string) (*url.URL, error) {
 	return url.Parse(fullPath)
 }
 
+// securityGet decodes the JSON response of a GET on the security API into out.
+func (c *Client) securityGet(ctx context.Context, out interface{}, elem ...string) (*v2.RateLimitDescription, error) {
+	return c.get(ctx, out, nil, append([]string{c.securityPath}, elem...)...)
+}
+
+// get decodes the JSON response of a GET on a cluster API, such as _cat/indices, into out.
+func (c *Client) get(ctx context.Context, out interface{}, query url.Values, elem ...string) (*v2.RateLimitDescription, error) {
+	u, err := getPath(c.baseURL.String(), elem...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url: %w", err)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opRead)
+
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(out))
+	if err != nil {
+		return rl, err
+	}
+	defer resp.Body.Close()
+
+	return rl, nil
+}
+
 // GetUsers retrieves all users from OpenSearch using the Security API.
-func (c *Client) GetUsers(ctx context.Context) ([]User, error) {
+func (c *Client) GetUsers(ctx context.Context) ([]User, *v2.RateLimitDescription, error) {
+	switch c.flavor {
+	case FlavorElasticsearch:
+		return c.esUsers(ctx)
+	case FlavorSearchGuard:
+		return c.sgUsers(ctx)
+	}
+
 	l := ctxzap.Extract(ctx)
 
 	usersUrl, err := getPath(c.baseURL.String(), c.securityPath, "internalusers")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get users url: %w", err)
+		return nil, nil, fmt.Errorf("failed to get users url: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, usersUrl.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.SetBasicAuth(c.username, c.password)
+	c.authenticate(req, opRead)
 
 	raw := map[string]User{}
-	resp, err := c.httpClient.Do(req, uhttp.WithJSONResponse(&raw))
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(&raw))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get users: %w", err)
+		return nil, rl, fmt.Errorf("failed to get users: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -194,31 +402,38 @@ func (c *Client) GetUsers(ctx context.Context) ([]User, error) {
 	}
 
 	l.Debug("retrieved users", zap.Int("count", len(users)))
-	return users, nil
+	return users, rl, nil
 }
 
 // GetRoles retrieves all roles from OpenSearch using the Security API.
-func (c *Client) GetRoles(ctx context.Context) ([]Role, error) {
+func (c *Client) GetRoles(ctx context.Context) ([]Role, *v2.RateLimitDescription, error) {
+	switch c.flavor {
+	case FlavorElasticsearch:
+		return c.esRoles(ctx)
+	case FlavorSearchGuard:
+		return c.sgRoles(ctx)
+	}
+
 	l := ctxzap.Extract(ctx)
 
 	rolesUrl, err := getPath(c.baseURL.String(), c.securityPath, "roles")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get roles url: %w", err)
+		return nil, nil, fmt.Errorf("failed to get roles url: %w", err)
 	}
 
 	l.Debug("making request to URL", zap.String("url", rolesUrl.String()))
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rolesUrl.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.SetBasicAuth(c.username, c.password)
+	c.authenticate(req, opRead)
 
 	raw := map[string]Role{}
-	resp, err := c.httpClient.Do(req, uhttp.WithJSONResponse(&raw))
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(&raw))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get roles: %w", err)
+		return nil, rl, fmt.Errorf("failed to get roles: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -229,54 +444,68 @@ func (c *Client) GetRoles(ctx context.Context) ([]Role, error) {
 	}
 
 	l.Debug("retrieved roles", zap.Int("count", len(roles)))
-	return roles, nil
+	return roles, rl, nil
 }
 
 // GetRole returns a single role by name.
-func (c *Client) GetRole(ctx context.Context, name string) (*Role, error) {
+func (c *Client) GetRole(ctx context.Context, name string) (*Role, *v2.RateLimitDescription, error) {
+	switch c.flavor {
+	case FlavorElasticsearch:
+		return c.esRole(ctx, name)
+	case FlavorSearchGuard:
+		return c.sgRole(ctx, name)
+	}
+
 	rolesUrl, err := getPath(c.baseURL.String(), c.securityPath, "roles", name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get role url: %w", err)
+		return nil, nil, fmt.Errorf("failed to get role url: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rolesUrl.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.SetBasicAuth(c.username, c.password)
+	c.authenticate(req, opRead)
 
 	role := &Role{}
-	resp, err := c.httpClient.Do(req, uhttp.WithJSONResponse(role))
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(role))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get role: %w", err)
+		return nil, rl, fmt.Errorf("failed to get role: %w", err)
 	}
 	defer resp.Body.Close()
 
 	role.Name = name
-	return role, nil
+	return role, rl, nil
 }
 
 // GetRoleMappings retrieves all role mappings from OpenSearch using the Security API.
-func (c *Client) GetRoleMappings(ctx context.Context) ([]RoleMapping, error) {
+func (c *Client) GetRoleMappings(ctx context.Context) ([]RoleMapping, *v2.RateLimitDescription, error) {
+	switch c.flavor {
+	case FlavorElasticsearch:
+		return c.esRoleMappings(ctx)
+	case FlavorSearchGuard:
+		return c.sgRoleMappings(ctx)
+	}
+
 	l := ctxzap.Extract(ctx)
 
 	roleMappingsUrl, err := getPath(c.baseURL.String(), c.securityPath, "rolesmapping")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get role mappings url: %w", err)
+		return nil, nil, fmt.Errorf("failed to get role mappings url: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, roleMappingsUrl.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.SetBasicAuth(c.username, c.password)
+	c.authenticate(req, opRead)
 
 	raw := map[string]RoleMapping{}
-	resp, err := c.httpClient.Do(req, uhttp.WithJSONResponse(&raw))
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(&raw))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get role mappings: %w", err)
+		return nil, rl, fmt.Errorf("failed to get role mappings: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -287,41 +516,218 @@ func (c *Client) GetRoleMappings(ctx context.Context) ([]RoleMapping, error) {
 	}
 
 	l.Debug("retrieved role mappings", zap.Int("count", len(roleMappings)))
-	return roleMappings, nil
+	return roleMappings, rl, nil
 }
 
 // GetRoleMapping returns a single role mapping by name.
-func (c *Client) GetRoleMapping(ctx context.Context, name string) (*RoleMapping, error) {
+func (c *Client) GetRoleMapping(ctx context.Context, name string) (*RoleMapping, *v2.RateLimitDescription, error) {
+	switch c.flavor {
+	case FlavorElasticsearch:
+		return c.esRoleMapping(ctx, name)
+	case FlavorSearchGuard:
+		return c.sgRoleMapping(ctx, name)
+	}
+
 	roleMappingUrl, err := getPath(c.baseURL.String(), c.securityPath, "rolesmapping", name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get role mapping url: %w", err)
+		return nil, nil, fmt.Errorf("failed to get role mapping url: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, roleMappingUrl.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.SetBasicAuth(c.username, c.password)
+	c.authenticate(req, opRead)
 
 	// The API returns a nested structure: {"role_name": {...}}
 	raw := map[string]RoleMapping{}
-	resp, err := c.httpClient.Do(req, uhttp.WithJSONResponse(&raw))
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(&raw))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get role mapping: %w", err)
+		return nil, rl, fmt.Errorf("failed to get role mapping: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Extract the role mapping from the nested structure
 	roleMapping, exists := raw[name]
 	if !exists {
-		return nil, fmt.Errorf("role mapping %s not found in response", name)
+		return nil, rl, status.Errorf(codes.NotFound, "role mapping %s not found in response", name)
 	}
 
 	roleMapping.Name = name
-	return &roleMapping, nil
+	return &roleMapping, rl, nil
+}
+
+// DetectionError returns why the security API could not be detected, or nil if detection succeeded or the
+// flavor was configured.
+func (c *Client) DetectionError() error {
+	return c.detectErr
 }
 
 func (c *Client) GetUserMatchKey() string {
 	return c.userMatchKey
 }
+
+// freshReadsKey marks a context whose reads must not be answered from the response cache.
+type freshReadsKey struct{}
+
+// freshReads numbers the requests that bypass the response cache.
+var freshReads atomic.Uint64
+
+// WithFreshReads returns a context whose reads bypass the response cache, for the reads that a write is based
+// on. The http wrapper caches every GET and cannot skip its cache for one request, so each such request carries
+// a cookie the cluster ignores but that makes its cache key unique. Other requests, and other clients, keep
+// their cached responses.
+func WithFreshReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadsKey{}, true)
+}
+
+// bustCache gives a GET request of a fresh-reads context a cache key of its own.
+func bustCache(req *http.Request) {
+	if req.Method != http.MethodGet || req.Context().Value(freshReadsKey{}) == nil {
+		return
+	}
+	req.AddCookie(&http.Cookie{Name: "baton_fresh_read", Value: strconv.FormatUint(freshReads.Add(1), 10)})
+}
+
+// CreateRoleMapping creates a role mapping. If the mapping already exists it is replaced, and FailedPrecondition
+// is returned.
+func (c *Client) CreateRoleMapping(ctx context.Context, mapping *RoleMapping) (*v2.RateLimitDescription, error) {
+	if c.flavor == FlavorElasticsearch {
+		return nil, errRoleMappingWriteUnsupported(mapping.Name)
+	}
+
+	roleMappingUrl, err := getPath(c.baseURL.String(), c.securityPath, "rolesmapping", mapping.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role mapping url: %w", err)
+	}
+
+	// The security API rejects unknown keys, so only the writable fields are sent.
+	body := map[string][]string{
+		"backend_roles":     nonNil(mapping.BackendRoles),
+		"hosts":             nonNil(mapping.Hosts),
+		"users":             nonNil(mapping.Users),
+		"and_backend_roles": nonNil(mapping.AndBackendRoles),
+	}
+	if c.flavor == FlavorSearchGuard {
+		translated := make(map[string][]string, len(body))
+		for field, values := range body {
+			path, _ := c.sgPatchPath("rolesmapping", "/"+field)
+			translated[strings.TrimPrefix(path, "/")] = values
+		}
+		body = translated
+	}
+
+	req, err := c.httpClient.NewRequest(ctx, http.MethodPut, roleMappingUrl, uhttp.WithJSONBody(body), uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opWrite)
+
+	resp, rl, err := c.doRequest(req)
+	if err != nil {
+		return rl, fmt.Errorf("failed to create role mapping: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The security API cannot create a mapping only if it is missing, but it answers 200 rather than 201 when
+	// it replaced one. Another writer created the mapping since it was found missing, and its members are gone.
+	if resp.StatusCode == http.StatusOK {
+		return rl, status.Errorf(codes.FailedPrecondition,
+			"role mapping %s was created by another writer while it was being created, and has been replaced: check its members", mapping.Name)
+	}
+
+	return rl, nil
+}
+
+// PatchRoleMapping applies JSON patch operations to an existing role mapping.
+func (c *Client) PatchRoleMapping(ctx context.Context, name string, ops []PatchOperation) (*v2.RateLimitDescription, error) {
+	switch c.flavor {
+	case FlavorElasticsearch:
+		return nil, errRoleMappingWriteUnsupported(name)
+	case FlavorSearchGuard:
+		translated, err := c.sgPatch("rolesmapping", ops)
+		if err != nil {
+			return nil, err
+		}
+		ops = translated
+	}
+
+	roleMappingUrl, err := getPath(c.baseURL.String(), c.securityPath, "rolesmapping", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role mapping url: %w", err)
+	}
+
+	req, err := c.httpClient.NewRequest(ctx, http.MethodPatch, roleMappingUrl, uhttp.WithJSONBody(ops), uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opWrite)
+
+	resp, rl, err := c.doRequest(req)
+	if err != nil {
+		if patchConflict(resp, ops) {
+			return rl, status.Errorf(codes.Aborted, "role mapping %s changed while it was patched: %v", name, err)
+		}
+		return rl, fmt.Errorf("failed to patch role mapping: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return rl, nil
+}
+
+// PatchUser applies JSON patch operations to an internal user.
+func (c *Client) PatchUser(ctx context.Context, name string, ops []PatchOperation) (*v2.RateLimitDescription, error) {
+	switch c.flavor {
+	case FlavorElasticsearch:
+		return nil, errUserWriteUnsupported(name)
+	case FlavorSearchGuard:
+		translated, err := c.sgPatch("internalusers", ops)
+		if err != nil {
+			return nil, err
+		}
+		ops = translated
+	}
+
+	userUrl, err := getPath(c.baseURL.String(), c.securityPath, "internalusers", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user url: %w", err)
+	}
+
+	req, err := c.httpClient.NewRequest(ctx, http.MethodPatch, userUrl, uhttp.WithJSONBody(ops), uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opWrite)
+
+	resp, rl, err := c.doRequest(req)
+	if err != nil {
+		if patchConflict(resp, ops) {
+			return rl, status.Errorf(codes.Aborted, "user %s changed while it was patched: %v", name, err)
+		}
+		return rl, fmt.Errorf("failed to patch user: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return rl, nil
+}
+
+// patchConflict reports whether a patch was rejected because one of its test operations failed, which the
+// security API answers with 400 Bad Request, or because of a concurrent write, answered with 409 Conflict.
+func patchConflict(resp *http.Response, ops []PatchOperation) bool {
+	if resp == nil || (resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusConflict) {
+		return false
+	}
+	return slices.ContainsFunc(ops, func(op PatchOperation) bool { return op.Op == "test" })
+}
+
+// nonNil returns an empty slice for nil so it is encoded as [] rather than null.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
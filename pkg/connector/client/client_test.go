@@ -2,14 +2,28 @@ package client
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // createTestServer creates a test server with the given response or behavior.
@@ -75,8 +89,8 @@ func TestNewClient(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 				assert.NotNil(t, client)
-				assert.Equal(t, tt.username, client.username)
-				assert.Equal(t, tt.password, client.password)
+				assert.Equal(t, basicAuth{username: tt.username, password: tt.password}, client.readAuth)
+				assert.Nil(t, client.writeAuth)
 				assert.Equal(t, tt.userMatchKey, client.userMatchKey)
 			}
 		})
@@ -211,6 +225,17 @@ func TestDetectSecurityAPIPath(t *testing.T) {
 			expectedPath: "/_opendistro/_security/api",
 			expectError:  false,
 		},
+		{
+			name: "elasticsearch default build",
+			mockResponse: map[string]interface{}{
+				"version": map[string]interface{}{
+					"number":       "8.13.0",
+					"build_flavor": "default",
+				},
+			},
+			expectedPath: "/_security",
+			expectError:  false,
+		},
 		{
 			name: "empty version info",
 			mockResponse: map[string]interface{}{
@@ -254,8 +279,7 @@ func TestDetectSecurityAPIPath(t *testing.T) {
 			client := &Client{
 				httpClient:   baseClient,
 				baseURL:      parsedURL,
-				username:     "test",
-				password:     "test",
+				readAuth:     basicAuth{username: "test", password: "test"},
 				securityPath: "/_plugins/_security/api", // Default path
 			}
 
@@ -631,3 +655,1782 @@ func TestGetPathExactClientUsage(t *testing.T) {
 		})
 	}
 }
+
+func TestNewClientFailsOverToAnotherNode(t *testing.T) {
+	live := createTestServer(map[string]interface{}{
+		"admin": map[string]interface{}{
+			"cluster_permissions": []string{"*"},
+		},
+	}, nil)
+	defer live.Close()
+
+	// A closed server refuses connections, which should make the pool move on to the live node.
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL := dead.URL
+	dead.Close()
+
+	client, err := NewClient(context.Background(), deadURL, "test", "test", "username", true, nil, WithAddresses(live.URL))
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+
+	roles, _, err := client.GetRoles(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+	assert.Equal(t, "admin", roles[0].Name)
+}
+
+func TestNodeTransportStripsPrimaryPath(t *testing.T) {
+	var gotPath string
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	defer server.Close()
+
+	primary, _ := url.Parse(server.URL + "/opensearch")
+	transport, err := newNodeTransport(context.Background(), []*url.URL{primary}, http.DefaultTransport, "", "", false)
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/opensearch/_plugins/_security/api/roles", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "/opensearch/_plugins/_security/api/roles", gotPath)
+}
+
+func TestDoRequestRetriesThrottledRequests(t *testing.T) {
+	attempts := 0
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"admin": {}}`))
+	})
+	defer server.Close()
+
+	parsedURL, _ := url.Parse(server.URL)
+	baseClient, _ := uhttp.NewBaseHttpClientWithContext(context.Background(), &http.Client{})
+	client := &Client{
+		httpClient:   baseClient,
+		baseURL:      parsedURL,
+		securityPath: "/_plugins/_security/api",
+		maxRetries:   3,
+	}
+
+	roles, rl, err := client.GetRoles(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+	assert.Equal(t, 3, attempts)
+	assert.NotNil(t, rl)
+	assert.Equal(t, v2.RateLimitDescription_STATUS_OVERLIMIT, rl.GetStatus())
+}
+
+func TestDoRequestGivesUpAfterMaxRetries(t *testing.T) {
+	attempts := 0
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+
+	parsedURL, _ := url.Parse(server.URL)
+	baseClient, _ := uhttp.NewBaseHttpClientWithContext(context.Background(), &http.Client{})
+	client := &Client{
+		httpClient:   baseClient,
+		baseURL:      parsedURL,
+		securityPath: "/_plugins/_security/api",
+		maxRetries:   2,
+	}
+
+	_, _, err := client.GetRoles(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 500*time.Millisecond, backoff(0, 500*time.Millisecond, 30*time.Second))
+	assert.Equal(t, 2*time.Second, backoff(2, 500*time.Millisecond, 30*time.Second))
+	assert.Equal(t, 30*time.Second, backoff(10, 500*time.Millisecond, 30*time.Second))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	resp := &http.Response{Header: http.Header{}}
+	_, ok := retryAfter(resp, now)
+	assert.False(t, ok)
+
+	resp.Header.Set("Retry-After", "7")
+	d, ok := retryAfter(resp, now)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, d)
+
+	resp.Header.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+	d, ok = retryAfter(resp, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+}
+
+func TestDoRequestTimeoutIsDeadlineExceeded(t *testing.T) {
+	release := make(chan struct{})
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	defer server.Close()
+	defer close(release)
+
+	parsedURL, _ := url.Parse(server.URL)
+	baseClient, _ := uhttp.NewBaseHttpClientWithContext(context.Background(), &http.Client{})
+	client := &Client{
+		httpClient:     baseClient,
+		baseURL:        parsedURL,
+		securityPath:   "/_plugins/_security/api",
+		requestTimeout: 50 * time.Millisecond,
+	}
+
+	_, _, err := client.GetRoles(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestNewHTTPTransportTimeouts(t *testing.T) {
+	transport := newHTTPTransport(nil, 5*time.Second, 30*time.Second)
+	assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, 30*time.Second, transport.ResponseHeaderTimeout)
+}
+
+func TestApplyTLSOptions(t *testing.T) {
+	pin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name    string
+		opts    *options
+		wantErr bool
+		check   func(t *testing.T, cfg *tls.Config)
+	}{
+		{
+			name: "server name and minimum version",
+			opts: &options{tlsServerName: "opensearch.internal", tlsMinVersion: "1.3"},
+			check: func(t *testing.T, cfg *tls.Config) {
+				assert.Equal(t, "opensearch.internal", cfg.ServerName)
+				assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+			},
+		},
+		{
+			name: "pinned keys install a connection check",
+			opts: &options{pinnedKeys: []string{"sha256/" + pin}},
+			check: func(t *testing.T, cfg *tls.Config) {
+				assert.NotNil(t, cfg.VerifyConnection)
+			},
+		},
+		{
+			name:    "unsupported minimum version",
+			opts:    &options{tlsMinVersion: "1.0"},
+			wantErr: true,
+		},
+		{
+			name:    "malformed pin",
+			opts:    &options{pinnedKeys: []string{"not-base64!"}},
+			wantErr: true,
+		},
+		{
+			name:    "pin with wrong digest length",
+			opts:    &options{pinnedKeys: []string{base64.StdEncoding.EncodeToString([]byte("short"))}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+			err := applyTLSOptions(cfg, tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestPinnedPublicKeys(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	serverPin := base64.StdEncoding.EncodeToString(spkiFingerprint(server.Certificate()))
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	for name, tt := range map[string]struct {
+		pin     string
+		wantErr bool
+	}{
+		"matching pin":  {pin: serverPin},
+		"unmatched pin": {pin: otherPin, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &tls.Config{InsecureSkipVerify: true} //#nosec G402 // the pin is what is being tested
+			assert.NoError(t, applyTLSOptions(cfg, &options{pinnedKeys: []string{tt.pin}}))
+
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+			resp, err := httpClient.Do(req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			resp.Body.Close()
+		})
+	}
+}
+
+// newTestCert returns a certificate for 127.0.0.1 signed by parent, or self-signed when parent is nil.
+func newTestCert(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
+
+func TestPinnedPublicKeysIgnoreUnverifiedChainEntries(t *testing.T) {
+	ca, caKey := newTestCert(t, "pinned ca", true, nil, nil)
+	issued, issuedKey := newTestCert(t, "issued", false, ca, caKey)
+	impostor, impostorKey := newTestCert(t, "impostor", false, nil, nil)
+	caPin := base64.StdEncoding.EncodeToString(spkiFingerprint(ca))
+	impostorPin := base64.StdEncoding.EncodeToString(spkiFingerprint(impostor))
+
+	// serve presents leaf followed by extra certificates, as a node or an interceptor would.
+	serve := func(leaf *x509.Certificate, key *ecdsa.PrivateKey, extra ...*x509.Certificate) *httptest.Server {
+		chain := [][]byte{leaf.Raw}
+		for _, cert := range extra {
+			chain = append(chain, cert.Raw)
+		}
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: chain, PrivateKey: key}}, MinVersion: tls.VersionTLS12}
+		server.StartTLS()
+		return server
+	}
+
+	tests := []struct {
+		name     string
+		server   *httptest.Server
+		insecure bool
+		roots    []*x509.Certificate
+		pin      string
+		wantErr  bool
+	}{
+		{
+			name:   "pinned CA in the verified chain",
+			server: serve(issued, issuedKey, ca),
+			roots:  []*x509.Certificate{ca},
+			pin:    caPin,
+		},
+		{
+			name:    "pinned CA appended to a chain that verifies without it",
+			server:  serve(impostor, impostorKey, ca),
+			roots:   []*x509.Certificate{impostor},
+			pin:     caPin,
+			wantErr: true,
+		},
+		{
+			name:     "pinned CA appended when verification is skipped",
+			server:   serve(impostor, impostorKey, ca),
+			insecure: true,
+			pin:      caPin,
+			wantErr:  true,
+		},
+		{
+			name:     "pinned leaf when verification is skipped",
+			server:   serve(impostor, impostorKey, ca),
+			insecure: true,
+			pin:      impostorPin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.server.Close()
+
+			roots := x509.NewCertPool()
+			for _, root := range tt.roots {
+				roots.AddCert(root)
+			}
+			cfg := &tls.Config{RootCAs: roots, InsecureSkipVerify: tt.insecure, MinVersion: tls.VersionTLS12} //#nosec G402 // the pin is what is being tested
+			assert.NoError(t, applyTLSOptions(cfg, &options{pinnedKeys: []string{tt.pin}}))
+
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.server.URL, nil)
+			resp, err := httpClient.Do(req)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errPinnedKeyMismatch)
+				return
+			}
+			assert.NoError(t, err)
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestWriteCredentials(t *testing.T) {
+	var gotUsers []string
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		username, _, _ := r.BasicAuth()
+		gotUsers = append(gotUsers, r.Method+" "+username)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "reader", "reader", "username", true, nil, WithWriteCredentials("admin", "admin"))
+	assert.NoError(t, err)
+
+	_, _, err = client.GetRoles(context.Background())
+	assert.NoError(t, err)
+	_, err = client.PatchRoleMapping(context.Background(), "readall", []PatchOperation{{Op: "add", Path: "/users", Value: []string{"alice"}}})
+	assert.NoError(t, err)
+
+	// The first requests are the security API path detection and the Search Guard probe.
+	assert.Equal(t, []string{"GET reader", "GET reader", "GET reader", "PATCH admin"}, gotUsers)
+}
+
+func TestPatchUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		flavor   string
+		wantURL  string
+		wantPath string
+		wantCode codes.Code
+	}{
+		{"opensearch", "opensearch", "/_plugins/_security/api/internalusers/alice", "/opendistro_security_roles", codes.OK},
+		{"search guard", "searchguard", "/_searchguard/api/internalusers/alice", "/search_guard_roles", codes.OK},
+		{"elasticsearch", "elasticsearch", "", "", codes.Unimplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotURL string
+			var gotOps []PatchOperation
+			server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.Method == http.MethodPatch {
+					gotURL = r.URL.Path
+					_ = json.NewDecoder(r.Body).Decode(&gotOps)
+				}
+				_, _ = w.Write([]byte(`{}`))
+			})
+			defer server.Close()
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor(tt.flavor))
+			assert.NoError(t, err)
+
+			_, err = client.PatchUser(context.Background(), "alice", []PatchOperation{
+				{Op: "replace", Path: "/opendistro_security_roles", Value: []string{}},
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode != codes.OK {
+				return
+			}
+			assert.Equal(t, tt.wantURL, gotURL)
+			assert.Len(t, gotOps, 1)
+			assert.Equal(t, tt.wantPath, gotOps[0].Path)
+			assert.Equal(t, []interface{}{}, gotOps[0].Value)
+		})
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	var gotUser, gotRoles string
+	var gotBasic bool
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		gotUser = r.Header.Get("x-proxy-user")
+		gotRoles = r.Header.Get("x-proxy-roles")
+		_, _, gotBasic = r.BasicAuth()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "", "", "username", true, nil,
+		WithProxyAuth("baton", []string{"security_reader", "auditor"}, "", ""))
+	assert.NoError(t, err)
+
+	_, _, err = client.GetRoles(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "baton", gotUser)
+	assert.Equal(t, "security_reader,auditor", gotRoles)
+	assert.False(t, gotBasic)
+}
+
+func TestNewClientRequiresCredentials(t *testing.T) {
+	_, err := NewClient(context.Background(), "http://localhost:9200", "", "", "username", true, nil)
+	assert.Error(t, err)
+
+	_, err = NewClient(context.Background(), "http://localhost:9200", "", "", "username", true, nil, WithProxyAuth("", nil, "", ""))
+	assert.Error(t, err)
+}
+
+func TestElasticsearchBackend(t *testing.T) {
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`{"version":{"number":"8.13.0","build_flavor":"default"}}`))
+		case "/_security/_authenticate":
+			_, _ = w.Write([]byte(`{"username": "elastic"}`))
+		case "/_security/user":
+			_, _ = w.Write([]byte(`{
+				"elastic": {"username": "elastic", "roles": ["superuser"], "metadata": {"_reserved": true}, "enabled": true},
+				"alice": {"username": "alice", "roles": ["analyst"], "full_name": "Alice", "email": "alice@example.com", "enabled": true},
+				"bob": {"username": "bob", "roles": ["analyst"], "enabled": false}
+			}`))
+		case "/_security/role":
+			_, _ = w.Write([]byte(`{
+				"analyst": {
+					"cluster": ["monitor"],
+					"indices": [{"names": ["logs-*"], "privileges": ["read"], "field_security": {"grant": ["*"], "except": ["secret"]}, "query": "{\"term\": {\"team\": \"ops\"}}"}],
+					"metadata": {}
+				}
+			}`))
+		case "/_security/role_mapping":
+			_, _ = w.Write([]byte(`{
+				"ldap_analysts": {"enabled": true, "roles": ["analyst"], "rules": {"any": [{"field": {"groups": "cn=analysts,dc=example,dc=com"}}, {"field": {"username": ["carol"]}}]}},
+				"disabled": {"enabled": false, "roles": ["analyst"], "rules": {"field": {"username": "dave"}}}
+			}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "elastic", "elastic", "username", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, FlavorElasticsearch, client.Flavor())
+
+	users, _, err := client.GetUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+	for _, u := range users {
+		assert.NotNil(t, u.Enabled)
+		switch u.UserIdentifier {
+		case "elastic":
+			assert.True(t, u.Reserved)
+		case "alice":
+			assert.True(t, *u.Enabled)
+			assert.Equal(t, "alice@example.com", u.Email)
+			assert.Equal(t, []string{"analyst"}, u.OpendistroSecurityRoles)
+		case "bob":
+			assert.False(t, *u.Enabled)
+		}
+	}
+
+	roles, _, err := client.GetRoles(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+	assert.Equal(t, []string{"monitor"}, roles[0].ClusterPermissions)
+	assert.Equal(t, []string{"logs-*"}, roles[0].IndexPermissions[0].IndexPatterns)
+	assert.Equal(t, []string{"~secret"}, roles[0].IndexPermissions[0].FLS)
+	assert.Equal(t, `{"term": {"team": "ops"}}`, roles[0].IndexPermissions[0].DLS)
+
+	mapping, _, err := client.GetRoleMapping(context.Background(), "analyst")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"alice", "carol"}, mapping.Users)
+	assert.Equal(t, []string{"cn=analysts,dc=example,dc=com"}, mapping.BackendRoles)
+
+	_, _, err = client.GetRoleMapping(context.Background(), "unmapped")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.PatchRoleMapping(context.Background(), "analyst", nil)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestEvaluateRoleMappingRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		rule           string
+		wantMatches    []principalMatch
+		wantUnresolved []string
+	}{
+		{
+			name:        "username field",
+			rule:        `{"field": {"username": ["alice", "bob"]}}`,
+			wantMatches: []principalMatch{{kind: principalUser, name: "alice"}, {kind: principalUser, name: "bob"}},
+		},
+		{
+			name: "groups restricted to a realm",
+			rule: `{"all": [{"field": {"groups": "cn=admins,dc=example,dc=com"}}, {"field": {"realm.name": "ldap1"}}]}`,
+			wantMatches: []principalMatch{
+				{kind: principalGroup, name: "cn=admins,dc=example,dc=com", conditions: []string{"realm.name is ldap1"}},
+			},
+		},
+		{
+			name: "except applies to every match",
+			rule: `{"all": [{"any": [{"field": {"username": "alice"}}, {"field": {"groups": "ops"}}]}, {"except": {"field": {"realm.name": "file"}}}]}`,
+			wantMatches: []principalMatch{
+				{kind: principalUser, name: "alice", conditions: []string{"not (realm.name is file)"}},
+				{kind: principalGroup, name: "ops", conditions: []string{"not (realm.name is file)"}},
+			},
+		},
+		{
+			name:           "patterns are unresolved",
+			rule:           `{"any": [{"field": {"username": "svc-*"}}, {"field": {"groups": "/.*admins.*/"}}]}`,
+			wantUnresolved: []string{"username matches svc-*", "groups matches /.*admins.*/"},
+		},
+		{
+			name:           "dn only rule is unresolved",
+			rule:           `{"field": {"dn": "*,ou=admin,dc=example,dc=com"}}`,
+			wantUnresolved: []string{"any user where dn is *,ou=admin,dc=example,dc=com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule esRule
+			assert.NoError(t, json.Unmarshal([]byte(tt.rule), &rule))
+
+			matches, unresolved := rule.evaluate().principals()
+			assert.ElementsMatch(t, tt.wantMatches, matches)
+			assert.ElementsMatch(t, tt.wantUnresolved, unresolved)
+		})
+	}
+}
+
+func TestEvaluateRoleTemplates(t *testing.T) {
+	raw := []json.RawMessage{
+		json.RawMessage(`{"template": {"source": "viewer"}}`),
+		json.RawMessage(`{"template": {"source": "[\"a\", \"b\"]"}, "format": "json"}`),
+		json.RawMessage(`{"template": {"source": "{{#tojson}}groups{{/tojson}}"}, "format": "json"}`),
+		json.RawMessage(`{"template": {"source": "{{metadata.team}}_role"}}`),
+	}
+
+	templates := evaluateTemplates(raw)
+	assert.Equal(t, []string{"viewer", "a", "b"}, templates.names)
+	assert.True(t, templates.groupsAsRoles)
+	assert.False(t, templates.usernameAsRole)
+	assert.Equal(t, []string{"{{metadata.team}}_role"}, templates.unresolved)
+}
+
+func TestRoleMappingAddPrincipal(t *testing.T) {
+	m := &RoleMapping{Name: "analyst"}
+	m.addPrincipal(principalMatch{kind: principalUser, name: "alice", conditions: []string{"realm.name is ldap1"}})
+	m.addPrincipal(principalMatch{kind: principalUser, name: "alice", conditions: []string{"realm.name is saml1"}})
+	assert.Equal(t, []string{"alice"}, m.Users)
+	assert.Equal(t, []string{"realm.name is ldap1", "realm.name is saml1"}, m.UserConditions["alice"])
+
+	m.addPrincipal(principalMatch{kind: principalUser, name: "alice"})
+	assert.NotContains(t, m.UserConditions, "alice")
+
+	m.addPrincipal(principalMatch{kind: principalUser, name: "alice", conditions: []string{"realm.name is file"}})
+	assert.NotContains(t, m.UserConditions, "alice")
+}
+
+func TestElasticsearchAPIKeys(t *testing.T) {
+	var invalidated []string
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/":
+			_, _ = w.Write([]byte(`{"version":{"number":"8.13.0","build_flavor":"default"}}`))
+		case r.URL.Path == "/_security/_authenticate":
+			_, _ = w.Write([]byte(`{"username": "elastic"}`))
+		case r.URL.Path == "/_security/api_key" && r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(`{"api_keys": [
+				{"id": "k1", "name": "ingest", "creation": 1700000000000, "expiration": 1800000000000, "invalidated": false,
+				 "username": "alice", "realm": "native1",
+				 "role_descriptors": {"writer": {"cluster": ["monitor"], "indices": [{"names": ["logs-*"], "privileges": ["write"]}]}}},
+				{"id": "k2", "name": "old", "creation": 1600000000000, "invalidated": true, "username": "bob", "realm": "native1"}
+			]}`))
+		case r.URL.Path == "/_security/api_key" && r.Method == http.MethodDelete:
+			var body struct {
+				IDs []string `json:"ids"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			invalidated = append(invalidated, body.IDs...)
+			_, _ = w.Write([]byte(`{"invalidated_api_keys": ["k1"], "previously_invalidated_api_keys": [], "error_count": 0}`))
+		case r.URL.Path == "/_security/service":
+			_, _ = w.Write([]byte(`{"elastic/fleet-server": {"role_descriptor": {"cluster": ["monitor"]}}}`))
+		case r.URL.Path == "/_security/service/elastic/fleet-server/credential":
+			_, _ = w.Write([]byte(`{"service_account": "elastic/fleet-server", "count": 2,
+				"tokens": {"token1": {}}, "nodes_credentials": {"_nodes": {}, "file_tokens": {"token2": {"nodes": ["node1"]}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "elastic", "elastic", "username", true, nil)
+	assert.NoError(t, err)
+
+	keys, _, err := client.GetAPIKeys(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "alice", keys[0].Owner)
+	assert.Equal(t, time.UnixMilli(1700000000000), keys[0].CreatedAt)
+	assert.Equal(t, time.UnixMilli(1800000000000), keys[0].ExpiresAt)
+	assert.Equal(t, "writer", keys[0].RoleDescriptors[0].Name)
+
+	_, err = client.InvalidateAPIKey(context.Background(), "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k1"}, invalidated)
+
+	accounts, _, err := client.GetServiceAccounts(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "elastic/fleet-server", accounts[0].Principal)
+
+	tokens, _, err := client.GetServiceAccountTokens(context.Background(), "elastic/fleet-server")
+	assert.NoError(t, err)
+	assert.Equal(t, []ServiceAccountToken{
+		{ServiceAccount: "elastic/fleet-server", Name: "token1", Source: TokenSourceIndex},
+		{ServiceAccount: "elastic/fleet-server", Name: "token2", Source: TokenSourceFile},
+	}, tokens)
+}
+
+func TestAPIKeysRequireElasticsearch(t *testing.T) {
+	client := &Client{flavor: FlavorOpenSearch}
+	_, _, err := client.GetAPIKeys(context.Background())
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestSearchGuardBackend(t *testing.T) {
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`{"version":{"number":"7.10.2","build_flavor":"default"}}`))
+		case "/_searchguard/authinfo":
+			_, _ = w.Write([]byte(`{"user_name": "admin", "sg_roles": ["SGS_ALL_ACCESS"], "backend_roles": ["admin"]}`))
+		case "/_searchguard/api/internalusers":
+			_, _ = w.Write([]byte(`{
+				"_sg_meta": {"type": "internalusers", "config_version": 2},
+				"alice": {"backend_roles": ["analysts"], "search_guard_roles": ["SGS_READALL"], "attributes": {"team": "ops"}}
+			}`))
+		case "/_searchguard/api/roles":
+			_, _ = w.Write([]byte(`{
+				"sg7_role": {"cluster_permissions": ["SGS_CLUSTER_MONITOR"], "index_permissions": [{"index_patterns": ["logs-*"], "allowed_actions": ["SGS_READ"]}]},
+				"sg6_role": {"cluster": ["CLUSTER_MONITOR"], "indices": {"metrics-*": {"*": ["READ"], "_fls_": ["~secret"], "_dls_": "{\"term\": {\"team\": \"ops\"}}"}}}
+			}`))
+		case "/_searchguard/api/rolesmapping/sg6_role":
+			_, _ = w.Write([]byte(`{"sg6_role": {"backendroles": ["ops"], "users": ["bob"]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, FlavorSearchGuard, client.Flavor())
+	assert.Equal(t, "/_searchguard/api", client.securityPath)
+
+	users, _, err := client.GetUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, []string{"SGS_READALL"}, users[0].OpendistroSecurityRoles)
+	assert.Equal(t, []string{"analysts"}, users[0].BackendRoles)
+
+	roles, _, err := client.GetRoles(context.Background())
+	assert.NoError(t, err)
+	byName := map[string]Role{}
+	for _, r := range roles {
+		byName[r.Name] = r
+	}
+	assert.Equal(t, []string{"logs-*"}, byName["sg7_role"].IndexPermissions[0].IndexPatterns)
+	assert.Equal(t, []string{"CLUSTER_MONITOR"}, byName["sg6_role"].ClusterPermissions)
+	assert.Equal(t, []string{"metrics-*"}, byName["sg6_role"].IndexPermissions[0].IndexPatterns)
+	assert.Equal(t, []string{"READ"}, byName["sg6_role"].IndexPermissions[0].AllowedActions)
+	assert.Equal(t, []string{"~secret"}, byName["sg6_role"].IndexPermissions[0].FLS)
+	assert.Equal(t, `{"term": {"team": "ops"}}`, byName["sg6_role"].IndexPermissions[0].DLS)
+
+	mapping, _, err := client.GetRoleMapping(context.Background(), "sg6_role")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ops"}, mapping.BackendRoles)
+	assert.Equal(t, []string{"bob"}, mapping.Users)
+}
+
+func TestTranslateSearchGuardIndicesIsStable(t *testing.T) {
+	raw := json.RawMessage(`{
+		"metrics-*": {"doc": ["READ"], "_doc": ["WRITE"], "*": ["indices:data/read/search"]},
+		"logs-*": {"*": ["CRUD"], "_fls_": ["~secret"]},
+		"audit-*": {"*": ["READ"]}
+	}`)
+
+	first, ok := translateSearchGuardIndices(raw)
+	assert.True(t, ok)
+	for range 20 {
+		again, ok := translateSearchGuardIndices(raw)
+		assert.True(t, ok)
+		assert.JSONEq(t, string(first), string(again))
+	}
+
+	var perms []IndexPermission
+	assert.NoError(t, json.Unmarshal(first, &perms))
+	if assert.Len(t, perms, 3) {
+		assert.Equal(t, []string{"audit-*"}, perms[0].IndexPatterns)
+		assert.Equal(t, []string{"logs-*"}, perms[1].IndexPatterns)
+		assert.Equal(t, []string{"~secret"}, perms[1].FLS)
+		assert.Equal(t, []string{"indices:data/read/search", "WRITE", "READ"}, perms[2].AllowedActions)
+	}
+}
+
+func TestSearchGuardWrites(t *testing.T) {
+	tests := []struct {
+		name            string
+		version         string
+		wantMappingPath string
+		wantMappingKeys []string
+		wantUserPath    string
+		wantUserCode    codes.Code
+	}{
+		{
+			name:            "search guard 7",
+			version:         "7.10.2",
+			wantMappingPath: "/backend_roles/-",
+			wantMappingKeys: []string{"and_backend_roles", "backend_roles", "hosts", "users"},
+			wantUserPath:    "/search_guard_roles/0",
+		},
+		{
+			name:            "search guard 6",
+			version:         "6.8.23",
+			wantMappingPath: "/backendroles/-",
+			wantMappingKeys: []string{"andbackendroles", "backendroles", "hosts", "users"},
+			wantUserCode:    codes.Unimplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOps []PatchOperation
+			var gotBody map[string][]string
+			server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.URL.Path == "/":
+					_, _ = w.Write([]byte(`{"version":{"number":"` + tt.version + `"}}`))
+					return
+				case r.Method == http.MethodPatch:
+					_ = json.NewDecoder(r.Body).Decode(&gotOps)
+				case r.Method == http.MethodPut:
+					_ = json.NewDecoder(r.Body).Decode(&gotBody)
+					w.WriteHeader(http.StatusCreated)
+				}
+				_, _ = w.Write([]byte(`{}`))
+			})
+			defer server.Close()
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor("searchguard"))
+			assert.NoError(t, err)
+
+			// A mapping missing from the response is NotFound, so that granting creates it.
+			_, _, err = client.GetRoleMapping(context.Background(), "readall")
+			assert.Equal(t, codes.NotFound, status.Code(err))
+
+			_, err = client.CreateRoleMapping(context.Background(), &RoleMapping{Name: "readall", Users: []string{"alice"}})
+			assert.NoError(t, err)
+			keys := make([]string, 0, len(gotBody))
+			for key := range gotBody {
+				keys = append(keys, key)
+			}
+			assert.ElementsMatch(t, tt.wantMappingKeys, keys)
+
+			_, err = client.PatchRoleMapping(context.Background(), "readall", []PatchOperation{{Op: "add", Path: "/backend_roles/-", Value: "ops"}})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMappingPath, gotOps[0].Path)
+
+			gotOps = nil
+			_, err = client.PatchUser(context.Background(), "alice", []PatchOperation{{Op: "remove", Path: "/opendistro_security_roles/0"}})
+			assert.Equal(t, tt.wantUserCode, status.Code(err))
+			if tt.wantUserCode == codes.OK {
+				assert.Equal(t, tt.wantUserPath, gotOps[0].Path)
+			} else {
+				assert.Empty(t, gotOps)
+			}
+		})
+	}
+}
+
+func TestDetectSecurityAPIPathProbesCandidates(t *testing.T) {
+	var probed []string
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`{"version":{"distribution":"opensearch","number":"1.3.0"}}`))
+		case "/_opendistro/_security/authinfo":
+			probed = append(probed, r.URL.Path)
+			_, _ = w.Write([]byte(`{"user_name": "admin"}`))
+		default:
+			probed = append(probed, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, client.DetectionError())
+	assert.Equal(t, FlavorOpenDistro, client.Flavor())
+	assert.Equal(t, []string{"/_plugins/_security/authinfo", "/_opendistro/_security/authinfo"}, probed)
+}
+
+func TestDetectSecurityAPIPathFailure(t *testing.T) {
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, client.DetectionError(), "no security API responded")
+}
+
+func TestNewClientWithConfiguredFlavor(t *testing.T) {
+	var requests int
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor("elasticsearch"))
+	assert.NoError(t, err)
+	assert.NoError(t, client.DetectionError())
+	assert.Equal(t, FlavorElasticsearch, client.Flavor())
+	assert.Equal(t, "/_security", client.securityPath)
+	// Only the cluster root is read, for the version; no security API is probed.
+	assert.Equal(t, 1, requests)
+
+	_, err = NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor("xpack"))
+	assert.Error(t, err)
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Version
+		wantErr bool
+	}{
+		{input: "2.11.0", want: Version{Major: 2, Minor: 11}},
+		{input: "7.10.2-SNAPSHOT", want: Version{Major: 7, Minor: 10, Patch: 2}},
+		{input: "3", want: Version{Major: 3}},
+		{input: "", wantErr: true},
+		{input: "x.y", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseVersion(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assert.True(t, Version{Major: 2, Minor: 1}.AtLeast(Version{Major: 2}))
+	assert.False(t, Version{Major: 1, Minor: 3}.AtLeast(Version{Major: 2}))
+	assert.True(t, Version{Major: 7, Minor: 13}.AtLeast(Version{Major: 7, Minor: 13}))
+}
+
+func TestRequireCapability(t *testing.T) {
+	tests := []struct {
+		name       string
+		flavor     Flavor
+		version    Version
+		capability Capability
+		wantCode   codes.Code
+	}{
+		{name: "data streams on opensearch", flavor: FlavorOpenSearch, version: Version{Major: 2, Minor: 11}, capability: CapabilityDataStreams, wantCode: codes.OK},
+		{name: "data streams on elasticsearch 7.8", flavor: FlavorElasticsearch, version: Version{Major: 7, Minor: 8}, capability: CapabilityDataStreams, wantCode: codes.FailedPrecondition},
+		{name: "data streams on opendistro", flavor: FlavorOpenDistro, version: Version{Major: 7, Minor: 10}, capability: CapabilityDataStreams, wantCode: codes.Unimplemented},
+		{name: "service accounts on elasticsearch 7.12", flavor: FlavorElasticsearch, version: Version{Major: 7, Minor: 12}, capability: CapabilityServiceAccounts, wantCode: codes.FailedPrecondition},
+		{name: "service accounts on elasticsearch 8", flavor: FlavorElasticsearch, version: Version{Major: 8}, capability: CapabilityServiceAccounts, wantCode: codes.OK},
+		{name: "unknown version trusts the flavor", flavor: FlavorOpenDistro, capability: CapabilityAccount, wantCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{flavor: tt.flavor, version: tt.version}
+			err := client.Require(tt.capability)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCode == codes.OK, client.Supports(tt.capability))
+		})
+	}
+}
+
+func TestDetectionRecordsVersion(t *testing.T) {
+	server := createTestServer(map[string]interface{}{
+		"version": map[string]interface{}{
+			"distribution": "opensearch",
+			"number":       "2.11.1",
+		},
+	}, nil)
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Version{Major: 2, Minor: 11, Patch: 1}, client.Version())
+}
+
+func TestExpandActionGroups(t *testing.T) {
+	groups := NewActionGroups([]ActionGroup{
+		{Name: "logs_reader", AllowedActions: []string{"read", "indices:admin/get"}},
+		{Name: "loop_a", AllowedActions: []string{"loop_b", "indices:data/read/get"}},
+		{Name: "loop_b", AllowedActions: []string{"loop_a", "indices:data/read/search"}},
+		// Custom groups override built-in ones.
+		{Name: "delete", AllowedActions: []string{"indices:data/write/delete"}},
+	})
+
+	tests := []struct {
+		name    string
+		actions []string
+		want    []string
+	}{
+		{"built-in nested", []string{"crud"}, []string{
+			"indices:admin/mapping/put", "indices:admin/mappings/fields/get*", "indices:admin/resolve/index",
+			"indices:data/read*", "indices:data/write/bulk*", "indices:data/write/delete", "indices:data/write/index*",
+			"indices:data/write/update*",
+		}},
+		{"custom", []string{"logs_reader", "indices:data/read*"}, []string{
+			"indices:admin/get", "indices:admin/mappings/fields/get*", "indices:admin/resolve/index", "indices:data/read*",
+		}},
+		{"cycle", []string{"loop_a"}, []string{"indices:data/read/get", "indices:data/read/search"}},
+		{"unknown names are kept", []string{"SGS_READ", "cluster:monitor/*"}, []string{"SGS_READ", "cluster:monitor/*"}},
+		{"empty", nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, groups.Expand(tt.actions))
+		})
+	}
+}
+
+func TestGetActionGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		flavor   string
+		path     string
+		body     string
+		want     map[string][]string
+		wantCode codes.Code
+	}{
+		{"opensearch", "opensearch", "/_plugins/_security/api/actiongroups",
+			`{"_meta": {"type": "actiongroups"}, "my_group": {"allowed_actions": ["crud"], "type": "index"}}`,
+			map[string][]string{"my_group": {"crud"}}, codes.OK},
+		{"search guard 6", "searchguard", "/_searchguard/api/actiongroups",
+			`{"_sg_meta": {"type": "actiongroups"}, "READ": {"permissions": ["indices:data/read*"]}, "OLD": ["indices:admin/get"]}`,
+			map[string][]string{"READ": {"indices:data/read*"}, "OLD": {"indices:admin/get"}}, codes.OK},
+		{"elasticsearch", "elasticsearch", "", "", nil, codes.Unimplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path != tt.path {
+					_, _ = w.Write([]byte(`{}`))
+					return
+				}
+				_, _ = w.Write([]byte(tt.body))
+			})
+			defer server.Close()
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor(tt.flavor))
+			assert.NoError(t, err)
+
+			groups, _, err := client.GetActionGroups(context.Background())
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode != codes.OK {
+				return
+			}
+			got := map[string][]string{}
+			for _, g := range groups {
+				got[g.Name] = g.AllowedActions
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchIndexPattern(t *testing.T) {
+	now := time.Date(2024, time.March, 22, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"logs-*", "logs-2024", true},
+		{"logs-*", "metrics", false},
+		{"logs-?", "logs-1", true},
+		{"logs-?", "logs-12", false},
+		{"*", ".opendistro_security", true},
+		{"logs", "logs", true},
+		{"logs", "logs-1", false},
+		{"/logs-[0-9]+/", "logs-42", true},
+		{"/logs-[0-9]+/", "logs-42a", false},
+		{"/logs-(/", "logs-(", false},
+		{"<logs-{now/d}>", "logs-2024.03.22", true},
+		{"<logs-{now/d}>", "logs-2024.03.21", false},
+		{"<logs-{now/M{yyyy.MM}}-*>", "logs-2024.03-000001", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchIndexPattern(tt.pattern, tt.name, now))
+		})
+	}
+}
+
+func TestResolveDateMath(t *testing.T) {
+	now := time.Date(2024, time.March, 22, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{"<logs-{now}>", "logs-2024.03.22", false},
+		{"<logs-{now-1d/d}>", "logs-2024.03.21", false},
+		{"<logs-{now-1M/M{yyyy.MM}}>", "logs-2024.02", false},
+		{"<logs-{now/w{yyyy.MM.dd}}>", "logs-2024.03.18", false},
+		{"<logs-{now/d{yyyy.MM.dd|+12:00}}>", "logs-2024.03.23", false},
+		{"<logs-{now/y{uuuu}}>", "logs-2024", false},
+		{"<\\{literal\\}-{now/d}>", "{literal}-2024.03.22", false},
+		{"logs-plain", "logs-plain", false},
+		{"<logs-{now/d>", "", true},
+		{"<logs-{yesterday}>", "", true},
+		{"<logs-{now/d{EEE}}>", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ResolveDateMath(tt.expr, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestActionAccessLevels(t *testing.T) {
+	groups := NewActionGroups(nil)
+	assert.Equal(t, []string{AccessRead}, ActionAccessLevels(groups.Expand([]string{"read"})))
+	assert.Equal(t, []string{AccessRead, AccessWrite}, ActionAccessLevels(groups.Expand([]string{"crud"})))
+	assert.Equal(t, []string{AccessRead, AccessWrite, AccessAdmin}, ActionAccessLevels(groups.Expand([]string{"indices_all"})))
+	assert.Equal(t, []string{AccessAdmin}, ActionAccessLevels(groups.Expand([]string{"manage"})))
+	assert.Empty(t, ActionAccessLevels(groups.Expand([]string{"indices_monitor"})))
+	assert.Equal(t, []string{AccessWrite}, ActionAccessLevels(esIndexPrivilegeActions.Expand([]string{"create_doc", "delete"})))
+}
+
+func TestGetIndicesAliasesAndDataStreams(t *testing.T) {
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/_cat/indices":
+			assert.Equal(t, "json", r.URL.Query().Get("format"))
+			_, _ = w.Write([]byte(`[{"index": "logs-1", "health": "green", "status": "open", "docs.count": "10"},
+				{"index": ".ds-metrics-000001", "health": "yellow", "status": "open", "docs.count": "5"}]`))
+		case "/_alias":
+			_, _ = w.Write([]byte(`{"logs-1": {"aliases": {"logs": {}, "all": {}}}, "logs-2": {"aliases": {"logs": {}}}, "other": {"aliases": {}}}`))
+		case "/_data_stream":
+			_, _ = w.Write([]byte(`{"data_streams": [{"name": "metrics", "template": "metrics-template", "indices": [{"index_name": ".ds-metrics-000001"}]}]}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor("opensearch"))
+	assert.NoError(t, err)
+
+	indices, _, err := client.GetIndices(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, indices, 2)
+	assert.Equal(t, Index{Name: "logs-1", Health: "green", Status: "open", DocsCount: "10"}, indices[0])
+
+	aliases, _, err := client.GetAliases(context.Background())
+	assert.NoError(t, err)
+	byName := map[string][]string{}
+	for _, a := range aliases {
+		byName[a.Name] = a.Indices
+	}
+	assert.Equal(t, map[string][]string{"logs": {"logs-1", "logs-2"}, "all": {"logs-1"}}, byName)
+
+	streams, _, err := client.GetDataStreams(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []DataStream{{Name: "metrics", Template: "metrics-template", Indices: []string{".ds-metrics-000001"}}}, streams)
+}
+
+func TestIndexPermissionSecurity(t *testing.T) {
+	var role Role
+	err := json.Unmarshal([]byte(`{"index_permissions": [{
+		"index_patterns": ["customers-*"],
+		"dls": "{\"term\": {\"region\": \"eu\"}}",
+		"fls": ["name", "~ssn", "!dob"],
+		"masked_fields": ["email"],
+		"allowed_actions": ["read"]
+	}, {"index_patterns": ["logs-*"], "allowed_actions": ["read"]}]}`), &role)
+	assert.NoError(t, err)
+
+	restricted := role.IndexPermissions[0]
+	assert.True(t, restricted.Restricted())
+	assert.Equal(t, `{"term": {"region": "eu"}}`, restricted.DLS)
+	assert.Equal(t, []string{"name"}, restricted.FieldIncludes())
+	assert.Equal(t, []string{"ssn", "dob"}, restricted.FieldExcludes())
+	assert.Equal(t, []string{"email"}, restricted.MaskedFields)
+
+	assert.False(t, role.IndexPermissions[1].Restricted())
+}
+
+func TestUserContextSubstitution(t *testing.T) {
+	user := User{
+		UserIdentifier: "alice",
+		BackendRoles:   []string{"ops", "dev"},
+		Attributes:     map[string]interface{}{"team": "payments", "regions": []interface{}{"eu", "us"}},
+	}
+	uc := NewUserContext(user, []string{"team_reader"})
+
+	assert.Equal(t, []string{"payments-*"}, uc.ExpandPattern("${attr.internal.team}-*"))
+	assert.Equal(t, []string{"ops-logs", "dev-logs"}, uc.ExpandPattern("${user.roles}-logs"))
+	assert.Equal(t, []string{"alice-eu", "alice-us"}, uc.ExpandPattern("${user.name}-${attr.internal.regions}"))
+	assert.Equal(t, []string{"${attr.internal.missing}-*"}, uc.ExpandPattern("${attr.internal.missing}-*"))
+	assert.Empty(t, NewUserContext(User{UserIdentifier: "bob"}, nil).ExpandPattern("${user.roles}-*"))
+
+	assert.Equal(t, `{"terms": {"owner": ["alice"], "roles": "ops,dev", "sec": "team_reader"}}`,
+		uc.Substitute(`{"terms": {"owner": ["${user_name}"], "roles": "${user.roles}", "sec": "${user.securityRoles}"}}`))
+
+	perm := IndexPermission{IndexPatterns: []string{"${attr.internal.team}-*", "shared"}, DLS: `{"term": {"team": "${attr.internal.team}"}}`}
+	assert.True(t, perm.Templated())
+	applied := uc.Apply(perm)
+	assert.Equal(t, []string{"payments-*", "shared"}, applied.IndexPatterns)
+	assert.Equal(t, `{"term": {"team": "payments"}}`, applied.DLS)
+	assert.False(t, applied.Templated())
+}
+
+func TestUserRoles(t *testing.T) {
+	user := User{UserIdentifier: "alice", BackendRoles: []string{"ops", "eu"}, OpendistroSecurityRoles: []string{"own_index"}}
+	mappings := []RoleMapping{
+		{Name: "readall", Users: []string{"ali*"}},
+		{Name: "ops_role", BackendRoles: []string{"ops"}},
+		{Name: "eu_ops", AndBackendRoles: []string{"ops", "eu"}},
+		{Name: "us_ops", AndBackendRoles: []string{"ops", "us"}},
+		{Name: "own_index", Users: []string{"bob"}},
+	}
+
+	assert.Equal(t, []RoleAssignment{
+		{Role: "eu_ops", Sources: []string{"backend_role:ops+eu"}},
+		{Role: "ops_role", Sources: []string{"backend_role:ops"}},
+		{Role: "own_index", Sources: []string{"user"}},
+		{Role: "readall", Sources: []string{"role_mapping"}},
+	}, UserRoles(user, mappings))
+}
+
+func TestAccessModel(t *testing.T) {
+	model := &AccessModel{
+		Roles: []Role{
+			{Name: "payments_read", ClusterPermissions: []string{"cluster_monitor"}, IndexPermissions: []IndexPermission{
+				{IndexPatterns: []string{"payments-*"}, AllowedActions: []string{"read"}, MaskedFields: []string{"ssn"}},
+			}},
+			{Name: "team", IndexPermissions: []IndexPermission{
+				{IndexPatterns: []string{"${attr.internal.team}-*"}, AllowedActions: []string{"crud"}},
+			}},
+		},
+		Mappings: []RoleMapping{
+			{Name: "payments_read", BackendRoles: []string{"finance"}},
+			{Name: "team", Users: []string{"*"}},
+		},
+		Users: []User{
+			{UserIdentifier: "alice", Attributes: map[string]interface{}{"team": "payments"}, OpendistroSecurityRoles: []string{"payments_read"}},
+			{UserIdentifier: "bob", Attributes: map[string]interface{}{"team": "logs"}},
+		},
+		ClusterGroups: NewActionGroups(nil),
+		IndexGroups:   NewActionGroups(nil),
+		DirectRoles:   true,
+		Now:           time.Now(),
+	}
+
+	t.Run("who can read an index", func(t *testing.T) {
+		paths, err := model.IndexAccess("payments-eu", AccessRead)
+		assert.NoError(t, err)
+		chains := map[string]bool{}
+		for _, p := range paths {
+			assert.Equal(t, ScopeIndex, p.Scope)
+			chains[p.Principal+" "+p.Via+" "+p.Role] = true
+		}
+		assert.Equal(t, map[string]bool{
+			"backend_role:finance role_mapping payments_read": true,
+			"user:alice user payments_read":                   true,
+			"user:alice role_mapping team":                    true,
+		}, chains)
+
+		for _, p := range paths {
+			switch p.Role {
+			case "team":
+				assert.Equal(t, "payments-*", p.IndexPattern)
+				assert.Equal(t, []string{"crud", "read"}, p.ActionGroups)
+			case "payments_read":
+				assert.Equal(t, []string{"read"}, p.ActionGroups)
+				assert.Equal(t, "masked ssn", p.Restrictions)
+			}
+		}
+	})
+
+	t.Run("broader queries are partial", func(t *testing.T) {
+		paths, err := model.IndexAccess("*", AccessWrite)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, paths)
+		for _, p := range paths {
+			assert.True(t, p.Partial)
+			assert.Equal(t, "team", p.Role)
+		}
+	})
+
+	t.Run("unknown level", func(t *testing.T) {
+		_, err := model.IndexAccess("payments-eu", "owner")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("what can a user do", func(t *testing.T) {
+		paths := model.UserAccess("bob")
+		assert.NotEmpty(t, paths)
+		for _, p := range paths {
+			assert.Equal(t, "user:bob", p.Principal)
+			assert.Equal(t, "role_mapping", p.Via)
+			assert.Equal(t, "logs-*", p.IndexPattern)
+		}
+
+		paths = model.UserAccess("alice")
+		vias := map[string]bool{}
+		for _, p := range paths {
+			vias[p.Role+" "+p.Via] = true
+		}
+		assert.Equal(t, map[string]bool{"payments_read user": true, "team role_mapping": true}, vias)
+	})
+
+	t.Run("what can a backend role do", func(t *testing.T) {
+		paths := model.BackendRoleAccess("finance")
+		assert.NotEmpty(t, paths)
+		scopes := map[string]bool{}
+		for _, p := range paths {
+			assert.Equal(t, "payments_read", p.Role)
+			scopes[p.Scope] = true
+		}
+		assert.Equal(t, map[string]bool{ScopeCluster: true, ScopeIndex: true}, scopes)
+	})
+}
+
+func TestLoadAccessModelFallsBackToBuiltinActionGroups(t *testing.T) {
+	server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`{"version":{"distribution":"opensearch","number":"2.11.0"}}`))
+		case "/_plugins/_security/api/roles":
+			_, _ = w.Write([]byte(`{"logs_writer":{"index_permissions":[{"index_patterns":["logs-*"],"allowed_actions":["crud"]}]}}`))
+		case "/_plugins/_security/api/rolesmapping":
+			_, _ = w.Write([]byte(`{"logs_writer":{"backend_roles":["ingest"]}}`))
+		case "/_plugins/_security/api/internalusers":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil)
+	assert.NoError(t, err)
+
+	model, err := LoadAccessModel(context.Background(), client)
+	assert.NoError(t, err)
+	paths, err := model.IndexAccess("logs-eu", AccessWrite)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, paths)
+	for _, p := range paths {
+		// The permission resolves through the built-in crud group.
+		assert.Equal(t, "backend_role:ingest", p.Principal)
+		assert.Equal(t, "crud", p.ActionGroups[0])
+	}
+}
+
+func TestClassifyRole(t *testing.T) {
+	groups := NewActionGroups(nil)
+	tests := []struct {
+		name        string
+		role        Role
+		wantLevel   string
+		wantReasons []string
+	}{
+		{
+			name:        "cluster_all",
+			role:        Role{ClusterPermissions: []string{"cluster_all"}},
+			wantLevel:   RiskCritical,
+			wantReasons: []string{"cluster_all"},
+		},
+		{
+			name:        "indices_all on all indices",
+			role:        Role{IndexPermissions: []IndexPermission{{IndexPatterns: []string{"*"}, AllowedActions: []string{"indices_all"}}}},
+			wantLevel:   RiskCritical,
+			wantReasons: []string{"indices_all on *"},
+		},
+		{
+			name:        "security REST API",
+			role:        Role{ClusterPermissions: []string{"restapi:admin/internalusers"}},
+			wantLevel:   RiskCritical,
+			wantReasons: []string{"security REST API: restapi:admin/internalusers"},
+		},
+		{
+			name:        "write to the security index",
+			role:        Role{IndexPermissions: []IndexPermission{{IndexPatterns: []string{".opendistro*"}, AllowedActions: []string{"crud"}}}},
+			wantLevel:   RiskCritical,
+			wantReasons: []string{"write to security index .opendistro*"},
+		},
+		{
+			name:        "write to a system index",
+			role:        Role{IndexPermissions: []IndexPermission{{IndexPatterns: []string{".opensearch-notifications"}, AllowedActions: []string{"write"}}}},
+			wantLevel:   RiskHigh,
+			wantReasons: []string{"write to system index .opensearch-notifications"},
+		},
+		{
+			name: "read on system indices and write on all indices",
+			role: Role{
+				ClusterPermissions: []string{"cluster_monitor"},
+				IndexPermissions: []IndexPermission{
+					{IndexPatterns: []string{".opensearch-*"}, AllowedActions: []string{"read"}},
+					{IndexPatterns: []string{"*"}, AllowedActions: []string{"crud"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk := ClassifyRole(tt.role, groups, groups)
+			assert.Equal(t, tt.wantLevel, risk.Level)
+			assert.Equal(t, tt.wantReasons, risk.Reasons)
+		})
+	}
+
+	t.Run("elasticsearch privileges", func(t *testing.T) {
+		risk := ClassifyRole(Role{ClusterPermissions: []string{"manage_security"}}, esClusterPrivilegeActions, esIndexPrivilegeActions)
+		assert.Equal(t, RiskCritical, risk.Level)
+	})
+
+	t.Run("principals inherit the highest level", func(t *testing.T) {
+		model := &AccessModel{
+			Roles: []Role{
+				{Name: "admin", ClusterPermissions: []string{"*"}},
+				{Name: "notifications", IndexPermissions: []IndexPermission{{IndexPatterns: []string{".opensearch-notifications-*"}, AllowedActions: []string{"crud"}}}},
+				{Name: "reader", IndexPermissions: []IndexPermission{{IndexPatterns: []string{"logs-*"}, AllowedActions: []string{"read"}}}},
+			},
+			Mappings: []RoleMapping{
+				{Name: "admin", Users: []string{"alice"}},
+				{Name: "notifications", BackendRoles: []string{"ops"}},
+				{Name: "reader", BackendRoles: []string{"*"}},
+			},
+			Users:         []User{{UserIdentifier: "bob", BackendRoles: []string{"ops"}}},
+			ClusterGroups: groups,
+			IndexGroups:   groups,
+			DirectRoles:   true,
+		}
+		assert.Equal(t, RiskCritical, model.UserRisk("alice"))
+		assert.Equal(t, RiskHigh, model.UserRisk("bob"))
+		assert.Equal(t, "", model.UserRisk("carol"))
+		assert.Equal(t, RiskHigh, model.BackendRoleRisk("ops"))
+		assert.Equal(t, "", model.BackendRoleRisk("dev"))
+	})
+}
+
+func TestOverlaps(t *testing.T) {
+	today := time.Now().UTC().Format("2006.01.02")
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "logs-2024", b: "logs-2024", want: true},
+		{a: "logs-2024", b: "logs-2025", want: false},
+		{a: "logs-*", b: "logs-2024", want: true},
+		{a: "*", b: ".opendistro_security", want: true},
+		{a: "p*", b: "*-pii", want: true},
+		{a: "*-eu", b: "pii-*", want: true},
+		{a: "logs-*", b: "*-pii", want: true},
+		{a: "logs-*", b: "metrics-*", want: false},
+		{a: "*-eu", b: "*-us", want: false},
+		{a: "log?-20*", b: "logs-19*", want: false},
+		{a: "a*b*c", b: "*x*", want: true},
+		{a: "a?c", b: "*b*", want: true},
+		{a: "a?c", b: "ab", want: false},
+		{a: "/pii-.*/", b: "pii-eu", want: true},
+		{a: "<logs-{now/d}>", b: "logs-" + today, want: true},
+		{a: "<logs-{now/d}>", b: "logs-*", want: true},
+		{a: "<logs-{now/d}>", b: "metrics-*", want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, overlaps(tt.a, tt.b), "%s and %s", tt.a, tt.b)
+		assert.Equal(t, tt.want, overlaps(tt.b, tt.a), "%s and %s", tt.b, tt.a)
+	}
+
+	c := NewClassifications([]string{"public", "restricted"}, map[string]string{"*-pii": "restricted"})
+	assert.Equal(t, "restricted", c.PatternLevel("p*"))
+	assert.Equal(t, "", c.PatternLevel("logs-*-eu"))
+}
+
+func TestClassifications(t *testing.T) {
+	c := NewClassifications([]string{"public", "internal", "confidential", "restricted"}, map[string]string{
+		"pii-*":  "restricted",
+		"logs-*": "internal",
+	})
+
+	tests := []struct {
+		name  string
+		perms []IndexPermission
+		want  string
+	}{
+		{name: "exact index", perms: []IndexPermission{{IndexPatterns: []string{"logs-2024"}, AllowedActions: []string{"read"}}}, want: "internal"},
+		{name: "broader pattern", perms: []IndexPermission{{IndexPatterns: []string{"*"}, AllowedActions: []string{"read"}}}, want: "restricted"},
+		{name: "highest wins", perms: []IndexPermission{
+			{IndexPatterns: []string{"logs-*"}, AllowedActions: []string{"read"}},
+			{IndexPatterns: []string{"pii-eu"}, AllowedActions: []string{"read"}},
+		}, want: "restricted"},
+		{name: "unclassified", perms: []IndexPermission{{IndexPatterns: []string{"metrics-*"}, AllowedActions: []string{"read"}}}, want: ""},
+		{name: "no actions", perms: []IndexPermission{{IndexPatterns: []string{"pii-*"}}}, want: ""},
+		{name: "user variables", perms: []IndexPermission{{IndexPatterns: []string{"${user.name}-*"}, AllowedActions: []string{"read"}}}, want: "restricted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, c.PermissionsLevel(tt.perms))
+		})
+	}
+
+	t.Run("principals", func(t *testing.T) {
+		model := &AccessModel{
+			Roles: []Role{
+				{Name: "own", IndexPermissions: []IndexPermission{{IndexPatterns: []string{"${attr.internal.data}-*"}, AllowedActions: []string{"read"}}}},
+				{Name: "logs", IndexPermissions: []IndexPermission{{IndexPatterns: []string{"logs-*"}, AllowedActions: []string{"read"}}}},
+			},
+			Mappings: []RoleMapping{
+				{Name: "own", Users: []string{"*"}},
+				{Name: "logs", BackendRoles: []string{"ops"}},
+			},
+			Users: []User{
+				{UserIdentifier: "alice", Attributes: map[string]interface{}{"data": "pii"}},
+				{UserIdentifier: "bob", Attributes: map[string]interface{}{"data": "metrics"}, BackendRoles: []string{"ops"}},
+			},
+			DirectRoles: true,
+		}
+		assert.Equal(t, "restricted", model.RoleClassification(c, "own"))
+		assert.Equal(t, "restricted", model.UserClassification(c, "alice"))
+		assert.Equal(t, "internal", model.UserClassification(c, "bob"))
+		assert.Equal(t, "internal", model.BackendRoleClassification(c, "ops"))
+		assert.Equal(t, "", model.UserClassification(nil, "alice"))
+	})
+}
+
+func TestCheckProvisioning(t *testing.T) {
+	tests := []struct {
+		name            string
+		flavor          string
+		permissionsInfo string
+		wantCode        codes.Code
+		wantContains    string
+	}{
+		{
+			name:            "allowed",
+			flavor:          "opensearch",
+			permissionsInfo: `{"user_name": "baton", "has_api_access": true, "disabled_endpoints": {"TENANTS": ["PUT"]}}`,
+			wantCode:        codes.OK,
+		},
+		{
+			name:            "no REST API access",
+			flavor:          "opensearch",
+			permissionsInfo: `{"user_name": "baton", "has_api_access": false, "disabled_endpoints": {}}`,
+			wantCode:        codes.PermissionDenied,
+			wantContains:    "plugins.security.restapi.roles_enabled",
+		},
+		{
+			name:            "disabled endpoints",
+			flavor:          "opensearch",
+			permissionsInfo: `{"user_name": "baton", "has_api_access": true, "disabled_endpoints": {"ROLESMAPPING": ["PATCH"], "INTERNALUSERS": ["PATCH", "PUT"]}}`,
+			wantCode:        codes.PermissionDenied,
+			wantContains:    "user baton (roles readall) cannot call PATCH rolesmapping, PATCH internalusers",
+		},
+		{
+			name:     "elasticsearch",
+			flavor:   "elasticsearch",
+			wantCode: codes.Unimplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writeUsers []string
+			server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				user, _, _ := r.BasicAuth()
+				switch r.URL.Path {
+				case "/_plugins/_security/api/permissionsinfo":
+					writeUsers = append(writeUsers, user)
+					_, _ = w.Write([]byte(tt.permissionsInfo))
+				case "/_plugins/_security/api/account":
+					writeUsers = append(writeUsers, user)
+					_, _ = w.Write([]byte(`{"user_name": "baton", "roles": ["readall"], "backend_roles": []}`))
+				default:
+					_, _ = w.Write([]byte(`{}`))
+				}
+			})
+			defer server.Close()
+
+			client, err := NewClient(context.Background(), server.URL, "reader", "secret", "username", true, nil,
+				WithSecurityFlavor(tt.flavor), WithWriteCredentials("writer", "secret"))
+			assert.NoError(t, err)
+
+			err = client.CheckProvisioning(context.Background())
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantContains != "" {
+				assert.ErrorContains(t, err, tt.wantContains)
+			}
+			for _, user := range writeUsers {
+				assert.Equal(t, "writer", user)
+			}
+		})
+	}
+}
+
+func TestCheckDeletePrivileges(t *testing.T) {
+	tests := []struct {
+		name         string
+		flavor       string
+		privileges   string
+		check        func(*Client, context.Context) error
+		wantCode     codes.Code
+		wantContains string
+	}{
+		{
+			name:       "API keys allowed",
+			flavor:     "elasticsearch",
+			privileges: `{"username": "baton", "cluster": {"manage_api_key": true}}`,
+			check:      (*Client).CheckAPIKeyInvalidation,
+			wantCode:   codes.OK,
+		},
+		{
+			name:         "API keys denied",
+			flavor:       "elasticsearch",
+			privileges:   `{"username": "baton", "cluster": {"manage_api_key": false}}`,
+			check:        (*Client).CheckAPIKeyInvalidation,
+			wantCode:     codes.PermissionDenied,
+			wantContains: "user baton lacks the manage_api_key cluster privilege",
+		},
+		{
+			name:         "service tokens denied",
+			flavor:       "elasticsearch",
+			privileges:   `{"username": "baton", "cluster": {}}`,
+			check:        (*Client).CheckServiceTokenDeletion,
+			wantCode:     codes.PermissionDenied,
+			wantContains: "manage_service_account",
+		},
+		{
+			name:     "opensearch",
+			flavor:   "opensearch",
+			check:    (*Client).CheckAPIKeyInvalidation,
+			wantCode: codes.Unimplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writeUsers []string
+			server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/_security/user/_has_privileges" && r.Method == http.MethodPost {
+					user, _, _ := r.BasicAuth()
+					writeUsers = append(writeUsers, user)
+					_, _ = w.Write([]byte(tt.privileges))
+					return
+				}
+				_, _ = w.Write([]byte(`{}`))
+			})
+			defer server.Close()
+
+			client, err := NewClient(context.Background(), server.URL, "reader", "secret", "username", true, nil,
+				WithSecurityFlavor(tt.flavor), WithWriteCredentials("writer", "secret"))
+			assert.NoError(t, err)
+
+			err = tt.check(client, context.Background())
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantContains != "" {
+				assert.ErrorContains(t, err, tt.wantContains)
+			}
+			for _, user := range writeUsers {
+				assert.Equal(t, "writer", user)
+			}
+		})
+	}
+}
+
+func TestWithFreshReads(t *testing.T) {
+	newCountingClient := func() (*Client, *int) {
+		reads := 0
+		server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/_plugins/_security/api/rolesmapping/readall" {
+				reads++
+			}
+			_, _ = w.Write([]byte(`{"readall": {"users": ["alice"]}}`))
+		})
+		t.Cleanup(server.Close)
+
+		c, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor("opensearch"))
+		assert.NoError(t, err)
+		return c, &reads
+	}
+
+	ctx := context.Background()
+	a, aReads := newCountingClient()
+	b, bReads := newCountingClient()
+	for _, c := range []*Client{a, b, a, b} {
+		_, _, err := c.GetRoleMapping(ctx, "readall")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, *aReads)
+	assert.Equal(t, 1, *bReads)
+
+	// Fresh reads reach the cluster every time, and leave the cached responses of every client in place.
+	for range 2 {
+		_, _, err := a.GetRoleMapping(WithFreshReads(ctx), "readall")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, *aReads)
+	for _, c := range []*Client{a, b} {
+		_, _, err := c.GetRoleMapping(ctx, "readall")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, *aReads)
+	assert.Equal(t, 1, *bReads)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      func(w http.ResponseWriter, r *http.Request) bool
+		wantContains string
+	}{
+		{name: "valid"},
+		{
+			name: "wrong password",
+			handler: func(w http.ResponseWriter, r *http.Request) bool {
+				w.WriteHeader(http.StatusUnauthorized)
+				return true
+			},
+			wantContains: "rejected the password of user admin",
+		},
+		{
+			name: "plugin missing",
+			handler: func(w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path == "/_plugins/_security/health" {
+					w.WriteHeader(http.StatusNotFound)
+					return true
+				}
+				return false
+			},
+			wantContains: "security plugin is not installed",
+		},
+		{
+			name: "plugin unhealthy",
+			handler: func(w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path == "/_plugins/_security/health" {
+					_, _ = w.Write([]byte(`{"status": "DOWN", "mode": "strict", "message": "Not initialized"}`))
+					return true
+				}
+				return false
+			},
+			wantContains: "security plugin is DOWN",
+		},
+		{
+			name: "no REST API access",
+			handler: func(w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path == "/_plugins/_security/api/rolesmapping" {
+					w.WriteHeader(http.StatusForbidden)
+					return true
+				}
+				return false
+			},
+			wantContains: "failed to read role mappings, REST API access is not enabled for the roles of user admin: add one of them to plugins.security.restapi.roles_enabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.handler != nil && tt.handler(w, r) {
+					return
+				}
+				switch r.URL.Path {
+				case "/_plugins/_security/health":
+					_, _ = w.Write([]byte(`{"status": "UP", "mode": "strict"}`))
+				default:
+					_, _ = w.Write([]byte(`{}`))
+				}
+			})
+			defer server.Close()
+
+			client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, WithSecurityFlavor("opensearch"))
+			assert.NoError(t, err)
+
+			err = client.Validate(context.Background())
+			if tt.wantContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantContains)
+		})
+	}
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		client, err := NewClient(context.Background(), server.URL, "admin", "admin", "username", false, nil, WithMaxRetries(0))
+		assert.NoError(t, err)
+		assert.ErrorContains(t, client.Validate(context.Background()), "set ca-cert-path or ca-cert")
+	})
+}
@@ -0,0 +1,365 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// esUser is a native realm user as returned by GET /_security/user.
+type esUser struct {
+	Username string                 `json:"username"`
+	Roles    []string               `json:"roles"`
+	FullName string                 `json:"full_name"`
+	Email    string                 `json:"email"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Enabled  bool                   `json:"enabled"`
+}
+
+// esRole is a role as returned by GET /_security/role.
+type esRole struct {
+	Cluster     []string               `json:"cluster"`
+	Indices     []esIndexPrivileges    `json:"indices"`
+	RunAs       []string               `json:"run_as"`
+	Description string                 `json:"description"`
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+type esIndexPrivileges struct {
+	Names         []string `json:"names"`
+	Privileges    []string `json:"privileges"`
+	FieldSecurity *struct {
+		Grant  []string `json:"grant"`
+		Except []string `json:"except"`
+	} `json:"field_security,omitempty"`
+	Query json.RawMessage `json:"query,omitempty"`
+}
+
+// esRoleMapping is a role mapping as returned by GET /_security/role_mapping. Unlike the security plugin,
+// Elasticsearch mappings are named independently of the roles they grant and select users with rules.
+type esRoleMapping struct {
+	Enabled       bool                   `json:"enabled"`
+	Roles         []string               `json:"roles"`
+	RoleTemplates []json.RawMessage      `json:"role_templates"`
+	Rules         esRule                 `json:"rules"`
+	Metadata      map[string]interface{} `json:"metadata"`
+}
+
+// esRule is a node of the role mapping rule DSL.
+type esRule struct {
+	Any    []esRule                   `json:"any,omitempty"`
+	All    []esRule                   `json:"all,omitempty"`
+	Field  map[string]json.RawMessage `json:"field,omitempty"`
+	Except *esRule                    `json:"except,omitempty"`
+}
+
+// reservedMetadata reports whether Elasticsearch marked a built-in user or role as reserved.
+func reservedMetadata(metadata map[string]interface{}) bool {
+	reserved, _ := metadata["_reserved"].(bool)
+	return reserved
+}
+
+// errRoleMappingWriteUnsupported is returned for role mapping writes against Elasticsearch, whose mappings are
+// rule based and not keyed by role.
+func errRoleMappingWriteUnsupported(name string) error {
+	return status.Errorf(codes.Unimplemented, "updating the mapping for role %s is not supported on Elasticsearch", name)
+}
+
+func errUserWriteUnsupported(name string) error {
+	return status.Errorf(codes.Unimplemented, "updating user %s is not supported on Elasticsearch", name)
+}
+
+// esUsers lists native realm users. Their directly assigned roles are reported as OpendistroSecurityRoles, which
+// has the same meaning in the security plugin.
+func (c *Client) esUsers(ctx context.Context) ([]User, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	raw := map[string]esUser{}
+	rl, err := c.securityGet(ctx, &raw, "user")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	var users []User
+	for username, u := range raw {
+		enabled := u.Enabled
+		users = append(users, User{
+			UserIdentifier:          username,
+			Reserved:                reservedMetadata(u.Metadata),
+			OpendistroSecurityRoles: u.Roles,
+			Attributes:              u.Metadata,
+			Enabled:                 &enabled,
+			FullName:                u.FullName,
+			Email:                   u.Email,
+		})
+	}
+
+	l.Debug("retrieved users", zap.Int("count", len(users)))
+	return users, rl, nil
+}
+
+// toRole converts an Elasticsearch role to the security plugin model. Field security excludes are written with
+// the plugin's "~" prefix, and the document query becomes the DLS query.
+func (r esRole) toRole(name string) Role {
+	role := Role{
+		Name:               name,
+		Reserved:           reservedMetadata(r.Metadata),
+		Description:        r.Description,
+		ClusterPermissions: r.Cluster,
+	}
+
+	for _, index := range r.Indices {
+		perm := IndexPermission{
+			IndexPatterns:  index.Names,
+			AllowedActions: index.Privileges,
+			DLS:            esQuery(index.Query),
+		}
+		if fs := index.FieldSecurity; fs != nil {
+			for _, field := range fs.Grant {
+				if field == "*" && len(fs.Except) > 0 {
+					continue
+				}
+				perm.FLS = append(perm.FLS, field)
+			}
+			for _, field := range fs.Except {
+				perm.FLS = append(perm.FLS, "~"+field)
+			}
+		}
+		role.IndexPermissions = append(role.IndexPermissions, perm)
+	}
+
+	return role
+}
+
+// esQuery returns the document level security query of an index privilege, which is a query object or a JSON
+// string holding one.
+func esQuery(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var query string
+	if err := json.Unmarshal(raw, &query); err == nil {
+		return query
+	}
+	return string(raw)
+}
+
+func (c *Client) esRoles(ctx context.Context) ([]Role, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	raw := map[string]esRole{}
+	rl, err := c.securityGet(ctx, &raw, "role")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	var roles []Role
+	for name, r := range raw {
+		roles = append(roles, r.toRole(name))
+	}
+
+	l.Debug("retrieved roles", zap.Int("count", len(roles)))
+	return roles, rl, nil
+}
+
+func (c *Client) esRole(ctx context.Context, name string) (*Role, *v2.RateLimitDescription, error) {
+	raw := map[string]esRole{}
+	rl, err := c.securityGet(ctx, &raw, "role", name)
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	r, ok := raw[name]
+	if !ok {
+		return nil, rl, status.Errorf(codes.NotFound, "role %s not found", name)
+	}
+
+	role := r.toRole(name)
+	return &role, rl, nil
+}
+
+// esRoleMappings builds one RoleMapping per role from two sources: the roles assigned directly to enabled native
+// users, and the users and groups selected by enabled role mapping rules. Disabled users and mappings grant
+// nothing, so they are left out.
+func (c *Client) esRoleMappings(ctx context.Context) ([]RoleMapping, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	rawMappings := map[string]esRoleMapping{}
+	rl, err := c.securityGet(ctx, &rawMappings, "role_mapping")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get role mappings: %w", err)
+	}
+
+	users, rl, err := c.esUsers(ctx)
+	if err != nil {
+		return nil, rl, err
+	}
+
+	byRole := map[string]*RoleMapping{}
+	mappingFor := func(role string) *RoleMapping {
+		m, ok := byRole[role]
+		if !ok {
+			m = &RoleMapping{Name: role}
+			byRole[role] = m
+		}
+		return m
+	}
+
+	for _, u := range users {
+		if u.Enabled != nil && !*u.Enabled {
+			continue
+		}
+		for _, role := range u.OpendistroSecurityRoles {
+			mappingFor(role).addPrincipal(principalMatch{kind: principalUser, name: u.UserIdentifier})
+		}
+	}
+
+	var allRoles []string
+	names := make([]string, 0, len(rawMappings))
+	for name := range rawMappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		mapping := rawMappings[name]
+		if !mapping.Enabled {
+			continue
+		}
+
+		matches, unresolved := mapping.Rules.evaluate().principals()
+		templates := evaluateTemplates(mapping.RoleTemplates)
+		roles := append(slices.Clone(mapping.Roles), templates.names...)
+
+		for _, role := range roles {
+			m := mappingFor(role)
+			for _, match := range matches {
+				m.addPrincipal(match)
+			}
+			for _, u := range unresolved {
+				m.Unresolved = append(m.Unresolved, fmt.Sprintf("role mapping %s: %s", name, u))
+			}
+		}
+
+		// Templates that name the role after the username or a group grant each role to the principal of the
+		// same name, provided the mapping's rule selects it. Other templates may produce any role, so they are
+		// reported as unresolved on every role.
+		if templates.usernameAsRole || templates.groupsAsRoles || len(templates.unresolved) > 0 {
+			if allRoles == nil {
+				roles, rl, err := c.esRoles(ctx)
+				if err != nil {
+					return nil, rl, err
+				}
+				for _, r := range roles {
+					allRoles = append(allRoles, r.Name)
+				}
+			}
+
+			var conditions []string
+			if rule := mapping.Rules.describe(); rule != "" {
+				conditions = []string{rule}
+			}
+			for _, role := range allRoles {
+				m := mappingFor(role)
+				if templates.usernameAsRole {
+					m.addPrincipal(principalMatch{kind: principalUser, name: role, conditions: conditions})
+				}
+				if templates.groupsAsRoles {
+					m.addPrincipal(principalMatch{kind: principalGroup, name: role, conditions: conditions})
+				}
+				for _, source := range templates.unresolved {
+					m.Unresolved = append(m.Unresolved, fmt.Sprintf("role mapping %s: role template %s", name, source))
+				}
+			}
+		}
+	}
+
+	roleMappings := make([]RoleMapping, 0, len(byRole))
+	for _, m := range byRole {
+		roleMappings = append(roleMappings, *m)
+	}
+	sort.Slice(roleMappings, func(i, j int) bool { return roleMappings[i].Name < roleMappings[j].Name })
+
+	l.Debug("retrieved role mappings", zap.Int("count", len(roleMappings)))
+	return roleMappings, rl, nil
+}
+
+func (c *Client) esRoleMapping(ctx context.Context, name string) (*RoleMapping, *v2.RateLimitDescription, error) {
+	roleMappings, rl, err := c.esRoleMappings(ctx)
+	if err != nil {
+		return nil, rl, err
+	}
+
+	for _, m := range roleMappings {
+		if m.Name == name {
+			return &m, rl, nil
+		}
+	}
+
+	return nil, rl, status.Errorf(codes.NotFound, "role %s is not mapped", name)
+}
+
+// fieldValues decodes a field rule value, which is a single value or a list of values. Non-string values are
+// dropped.
+func fieldValues(raw json.RawMessage) []string {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return []string{value}
+	}
+
+	var values []interface{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil
+	}
+
+	var rv []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			rv = append(rv, s)
+		}
+	}
+	return rv
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// addPrincipal adds a rule match to the mapping. A principal mapped by several rules keeps each rule's
+// conditions as an alternative, and one unconditional match makes it unconditional.
+func (m *RoleMapping) addPrincipal(match principalMatch) {
+	members, conditions := &m.Users, &m.UserConditions
+	if match.kind == principalGroup {
+		members, conditions = &m.BackendRoles, &m.GroupConditions
+	}
+
+	known := slices.Contains(*members, match.name)
+	_, conditional := (*conditions)[match.name]
+	if !known {
+		*members = append(*members, match.name)
+	}
+
+	switch {
+	case len(match.conditions) == 0:
+		delete(*conditions, match.name)
+	case !known || conditional:
+		if *conditions == nil {
+			*conditions = map[string][]string{}
+		}
+		(*conditions)[match.name] = appendUnique((*conditions)[match.name], strings.Join(match.conditions, " and "))
+	}
+}
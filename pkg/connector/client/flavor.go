@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+// Flavor identifies which security plugin, and therefore which REST API dialect, a cluster runs.
+type Flavor string
+
+const (
+	// FlavorOpenSearch is the OpenSearch security plugin under /_plugins/_security/api.
+	FlavorOpenSearch Flavor = "opensearch"
+	// FlavorOpenDistro is the Open Distro security plugin under /_opendistro/_security/api.
+	FlavorOpenDistro Flavor = "opendistro"
+	// FlavorElasticsearch is Elasticsearch's native X-Pack security under /_security.
+	FlavorElasticsearch Flavor = "elasticsearch"
+	// FlavorSearchGuard is the Search Guard plugin under /_searchguard/api.
+	FlavorSearchGuard Flavor = "searchguard"
+)
+
+const (
+	openSearchSecurityPath    = "/_plugins/_security/api"
+	openDistroSecurityPath    = "/_opendistro/_security/api"
+	elasticsearchSecurityPath = "/_security"
+	searchGuardSecurityPath   = "/_searchguard/api"
+)
+
+// Flavor returns the security API flavor the client talks to.
+func (c *Client) Flavor() Flavor {
+	if c.flavor == "" {
+		return FlavorOpenSearch
+	}
+	return c.flavor
+}
+
+// securityPaths maps each flavor to the base path of its security API.
+var securityPaths = map[Flavor]string{
+	FlavorOpenSearch:    openSearchSecurityPath,
+	FlavorOpenDistro:    openDistroSecurityPath,
+	FlavorElasticsearch: elasticsearchSecurityPath,
+	FlavorSearchGuard:   searchGuardSecurityPath,
+}
+
+// flavorProbes are endpoints that any authenticated user can call and that only exist when the flavor's
+// security API is installed.
+var flavorProbes = map[Flavor]string{
+	FlavorOpenSearch:    "/_plugins/_security/authinfo",
+	FlavorOpenDistro:    "/_opendistro/_security/authinfo",
+	FlavorElasticsearch: "/_security/_authenticate",
+	FlavorSearchGuard:   "/_searchguard/authinfo",
+}
+
+// parseFlavor validates a configured flavor. "auto" and the empty string return an empty flavor, which means
+// the flavor is probed.
+func parseFlavor(flavor string) (Flavor, error) {
+	f := Flavor(strings.ToLower(strings.TrimSpace(flavor)))
+	if f == "" || f == "auto" {
+		return "", nil
+	}
+	if _, ok := securityPaths[f]; !ok {
+		return "", fmt.Errorf("unsupported security API flavor %q, expected auto, opensearch, opendistro, elasticsearch or searchguard", flavor)
+	}
+	return f, nil
+}
+
+// setFlavor points the client at the security API of the given flavor.
+func (c *Client) setFlavor(f Flavor) {
+	c.flavor = f
+	c.securityPath = securityPaths[f]
+}
+
+// candidateFlavors orders the flavors to probe, most likely first, from what the cluster root reported.
+func candidateFlavors(distribution, buildFlavor string) []Flavor {
+	switch {
+	case strings.EqualFold(distribution, "opensearch"):
+		// OpenSearch 1.x still serves the Open Distro paths.
+		return []Flavor{FlavorOpenSearch, FlavorOpenDistro}
+	case strings.EqualFold(buildFlavor, "default"):
+		// Search Guard runs on Elasticsearch builds of any flavor, so it is probed before X-Pack security.
+		return []Flavor{FlavorSearchGuard, FlavorElasticsearch, FlavorOpenDistro}
+	default:
+		return []Flavor{FlavorOpenDistro, FlavorSearchGuard, FlavorOpenSearch, FlavorElasticsearch}
+	}
+}
+
+// probeFlavor reports whether the flavor's security API answers on this cluster. Search Guard's authinfo is
+// also required to carry its sg_ prefixed fields. The error is why the probe failed, such as a 404 when the
+// flavor is not installed.
+func (c *Client) probeFlavor(ctx context.Context, f Flavor) (bool, error) {
+	probeUrl, err := getPath(c.baseURL.String(), flavorProbes[f])
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeUrl.String(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	c.authenticate(req, opRead)
+
+	var body map[string]json.RawMessage
+	resp, _, err := c.doRequest(req, uhttp.WithJSONResponse(&body))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if f == FlavorSearchGuard {
+		_, ok := body["sg_roles"]
+		return ok, nil
+	}
+	return true, nil
+}
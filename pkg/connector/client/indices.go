@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Index is an index as listed by _cat/indices.
+type Index struct {
+	Name      string `json:"index"`
+	Health    string `json:"health"`
+	Status    string `json:"status"`
+	DocsCount string `json:"docs.count"`
+}
+
+// Alias is an index alias and the indices it points to.
+type Alias struct {
+	Name    string
+	Indices []string
+}
+
+// DataStream is a data stream and its backing indices.
+type DataStream struct {
+	Name     string
+	Template string
+	Indices  []string
+}
+
+// Index access levels group the actions that roles allow on indices, aliases and data streams.
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+	AccessAdmin = "admin"
+)
+
+// AccessLevels lists the index access levels in increasing order of privilege.
+var AccessLevels = []string{AccessRead, AccessWrite, AccessAdmin}
+
+// accessLevelActions are the actions that characterize each access level. Action patterns that allow any of
+// them grant the level.
+var accessLevelActions = map[string][]string{
+	AccessRead:  {"indices:data/read/search", "indices:data/read/get"},
+	AccessWrite: {"indices:data/write/index", "indices:data/write/update", "indices:data/write/delete"},
+	AccessAdmin: {"indices:admin/delete", "indices:admin/settings/update", "indices:admin/close"},
+}
+
+// ActionAccessLevels returns the access levels that concrete action patterns, as returned by
+// ActionGroups.Expand, grant.
+func ActionAccessLevels(actions []string) []string {
+	var levels []string
+	for _, level := range AccessLevels {
+		if allowsAny(actions, accessLevelActions[level]) {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+func allowsAny(patterns []string, actions []string) bool {
+	for _, pattern := range patterns {
+		for _, action := range actions {
+			if MatchPattern(pattern, action) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetIndices lists the indices of the cluster, including hidden and closed ones.
+func (c *Client) GetIndices(ctx context.Context) ([]Index, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	var indices []Index
+	query := url.Values{"format": {"json"}, "h": {"index,health,status,docs.count"}}
+	rl, err := c.get(ctx, &indices, query, "_cat", "indices")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get indices: %w", err)
+	}
+
+	l.Debug("retrieved indices", zap.Int("count", len(indices)))
+	return indices, rl, nil
+}
+
+// GetAliases lists the aliases of the cluster with the indices they point to.
+func (c *Client) GetAliases(ctx context.Context) ([]Alias, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	raw := map[string]struct {
+		Aliases map[string]interface{} `json:"aliases"`
+	}{}
+	rl, err := c.get(ctx, &raw, nil, "_alias")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get aliases: %w", err)
+	}
+
+	byName := map[string]*Alias{}
+	for index, entry := range raw {
+		for name := range entry.Aliases {
+			alias, ok := byName[name]
+			if !ok {
+				alias = &Alias{Name: name}
+				byName[name] = alias
+			}
+			alias.Indices = append(alias.Indices, index)
+		}
+	}
+
+	aliases := make([]Alias, 0, len(byName))
+	for _, alias := range byName {
+		sort.Strings(alias.Indices)
+		aliases = append(aliases, *alias)
+	}
+
+	l.Debug("retrieved aliases", zap.Int("count", len(aliases)))
+	return aliases, rl, nil
+}
+
+// GetDataStreams lists the data streams of the cluster with their backing indices.
+func (c *Client) GetDataStreams(ctx context.Context) ([]DataStream, *v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityDataStreams); err != nil {
+		return nil, nil, err
+	}
+	l := ctxzap.Extract(ctx)
+
+	var raw struct {
+		DataStreams []struct {
+			Name     string `json:"name"`
+			Template string `json:"template"`
+			Indices  []struct {
+				IndexName string `json:"index_name"`
+			} `json:"indices"`
+		} `json:"data_streams"`
+	}
+	rl, err := c.get(ctx, &raw, nil, "_data_stream")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get data streams: %w", err)
+	}
+
+	streams := make([]DataStream, 0, len(raw.DataStreams))
+	for _, ds := range raw.DataStreams {
+		stream := DataStream{Name: ds.Name, Template: ds.Template}
+		for _, index := range ds.Indices {
+			stream.Indices = append(stream.Indices, index.IndexName)
+		}
+		streams = append(streams, stream)
+	}
+
+	l.Debug("retrieved data streams", zap.Int("count", len(streams)))
+	return streams, rl, nil
+}
@@ -1,5 +1,10 @@
 package client
 
+import (
+	"strings"
+	"time"
+)
+
 type User struct {
 	UserIdentifier          string                 `json:"user_identifier"`
 	Description             string                 `json:"description,omitempty"`
@@ -9,6 +14,10 @@ type User struct {
 	BackendRoles            []string               `json:"backend_roles"`
 	OpendistroSecurityRoles []string               `json:"opendistro_security_roles"`
 	Attributes              map[string]interface{} `json:"attributes,omitempty"`
+	// Enabled is only reported by Elasticsearch native users. Nil means the backend has no such flag.
+	Enabled  *bool  `json:"enabled,omitempty"`
+	FullName string `json:"full_name,omitempty"`
+	Email    string `json:"email,omitempty"`
 }
 
 type Role struct {
@@ -18,7 +27,7 @@ type Role struct {
 	Static             bool               `json:"static,omitempty"`
 	Description        string             `json:"description,omitempty"`
 	ClusterPermissions []string           `json:"cluster_permissions"`
-	IndexPermissions   []indexPermission  `json:"index_permissions"`
+	IndexPermissions   []IndexPermission  `json:"index_permissions"`
 	TenantPermissions  []tenantPermission `json:"tenant_permissions"`
 }
 
@@ -31,16 +40,115 @@ type RoleMapping struct {
 	Hosts           []string `json:"hosts,omitempty"`
 	Users           []string `json:"users,omitempty"`
 	AndBackendRoles []string `json:"and_backend_roles,omitempty"`
+	// UserConditions and GroupConditions hold, per user or backend role, the alternative conditions under which
+	// a rule-based mapping applies. A principal without an entry is mapped unconditionally.
+	UserConditions  map[string][]string `json:"-"`
+	GroupConditions map[string][]string `json:"-"`
+	// Unresolved describes mapping rules and role templates that could not be resolved to principals.
+	Unresolved []string `json:"-"`
+}
+
+// PatchOperation is a single JSON patch (RFC 6902) operation accepted by the security API PATCH endpoints.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
 }
 
-type indexPermission struct {
-	IndexPatterns  []string `json:"index_patterns"`
+// IndexPermission grants actions on the indices matching its patterns, optionally limited by document and field
+// level security.
+type IndexPermission struct {
+	IndexPatterns []string `json:"index_patterns"`
+	// DLS is a document level security query that limits the documents the permission applies to.
+	DLS string `json:"dls,omitempty"`
+	// FLS lists the fields that documents are limited to, or with a "~" prefix the fields that are hidden.
 	FLS            []string `json:"fls,omitempty"`
 	MaskedFields   []string `json:"masked_fields,omitempty"`
 	AllowedActions []string `json:"allowed_actions"`
 }
 
+// FieldIncludes returns the fields that field level security limits documents to.
+func (p IndexPermission) FieldIncludes() []string {
+	var fields []string
+	for _, field := range p.FLS {
+		if !isFieldExclude(field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// FieldExcludes returns the fields that field level security hides, without their prefix.
+func (p IndexPermission) FieldExcludes() []string {
+	var fields []string
+	for _, field := range p.FLS {
+		if isFieldExclude(field) {
+			fields = append(fields, field[1:])
+		}
+	}
+	return fields
+}
+
+// Restricted reports whether the permission limits documents or fields, or masks field values.
+func (p IndexPermission) Restricted() bool {
+	return p.DLS != "" || len(p.FLS) > 0 || len(p.MaskedFields) > 0
+}
+
+// DescribeRestrictions summarizes the document and field level security of the permission, e.g.
+// "dls {"term":{"region":"eu"}}, fls ~ssn, masked email".
+func (p IndexPermission) DescribeRestrictions() string {
+	var parts []string
+	if p.DLS != "" {
+		parts = append(parts, "dls "+p.DLS)
+	}
+	if len(p.FLS) > 0 {
+		parts = append(parts, "fls "+strings.Join(p.FLS, ","))
+	}
+	if len(p.MaskedFields) > 0 {
+		parts = append(parts, "masked "+strings.Join(p.MaskedFields, ","))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isFieldExclude reports whether an FLS entry hides a field. Search Guard also accepts "!" as the prefix.
+func isFieldExclude(field string) bool {
+	return strings.HasPrefix(field, "~") || strings.HasPrefix(field, "!")
+}
+
 type tenantPermission struct {
 	TenantPatterns []string `json:"tenant_patterns,omitempty"`
 	AllowedActions []string `json:"allowed_actions,omitempty"`
 }
+
+// APIKey is an Elasticsearch API key. A key without role descriptors has the full access of its owner.
+type APIKey struct {
+	ID              string
+	Name            string
+	Type            string
+	Owner           string
+	Realm           string
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	RoleDescriptors []Role
+	Metadata        map[string]interface{}
+}
+
+// ServiceAccount is an Elasticsearch service account, identified by its namespace/service principal.
+type ServiceAccount struct {
+	Principal      string
+	RoleDescriptor Role
+}
+
+const (
+	// TokenSourceIndex marks service account tokens stored in the security index.
+	TokenSourceIndex = "index"
+	// TokenSourceFile marks service account tokens read from service_tokens files on the nodes.
+	TokenSourceFile = "file"
+)
+
+// ServiceAccountToken is a bearer token of a service account.
+type ServiceAccountToken struct {
+	ServiceAccount string
+	Name           string
+	Source         string
+}
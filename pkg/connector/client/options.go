@@ -0,0 +1,149 @@
+package client
+
+import "time"
+
+// Option configures optional behaviour of a Client.
+type Option func(*options)
+
+type options struct {
+	addresses         []string
+	discoverNodes     bool
+	maxRetries        int
+	requestsPerSecond int
+	connectTimeout    time.Duration
+	readTimeout       time.Duration
+	requestTimeout    time.Duration
+	tlsServerName     string
+	tlsMinVersion     string
+	pinnedKeys        []string
+	writeUsername     string
+	writePassword     string
+	proxyAuth         *proxyAuth
+	clientCert        []byte
+	clientKey         []byte
+	flavor            string
+}
+
+// WithAddresses adds node addresses that requests fail over to when the primary address is unreachable.
+func WithAddresses(addresses ...string) Option {
+	return func(o *options) {
+		o.addresses = append(o.addresses, addresses...)
+	}
+}
+
+// WithNodeDiscovery replaces the configured addresses with the HTTP-enabled nodes reported by _nodes/http.
+func WithNodeDiscovery(enabled bool) Option {
+	return func(o *options) {
+		o.discoverNodes = enabled
+	}
+}
+
+// WithMaxRetries sets how many times a throttled (429) or transiently failing (502, 503, 504) request is retried.
+func WithMaxRetries(maxRetries int) Option {
+	return func(o *options) {
+		if maxRetries >= 0 {
+			o.maxRetries = maxRetries
+		}
+	}
+}
+
+// WithRequestsPerSecond limits how many requests the client sends per second. Zero disables the limit.
+func WithRequestsPerSecond(rps int) Option {
+	return func(o *options) {
+		o.requestsPerSecond = rps
+	}
+}
+
+// WithConnectTimeout bounds how long dialing a node and completing the TLS handshake may take.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.connectTimeout = timeout
+		}
+	}
+}
+
+// WithReadTimeout bounds how long a node may take to answer a single request.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.readTimeout = timeout
+		}
+	}
+}
+
+// WithRequestTimeout sets the deadline for a whole client call, including retries and failover.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.requestTimeout = timeout
+		}
+	}
+}
+
+// WithTLSServerName overrides the server name used to verify the node certificate, for clusters reached by IP.
+func WithTLSServerName(serverName string) Option {
+	return func(o *options) {
+		o.tlsServerName = serverName
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version, either "1.2" or "1.3".
+func WithMinTLSVersion(version string) Option {
+	return func(o *options) {
+		o.tlsMinVersion = version
+	}
+}
+
+// WithPinnedPublicKeys only accepts nodes whose verified certificate chain contains one of the given public keys,
+// or whose leaf certificate has one when verification is skipped.
+// Each pin is a base64 SHA-256 fingerprint of a SubjectPublicKeyInfo.
+func WithPinnedPublicKeys(pins ...string) Option {
+	return func(o *options) {
+		o.pinnedKeys = append(o.pinnedKeys, pins...)
+	}
+}
+
+// WithWriteCredentials makes provisioning calls with a separate, more privileged credential. Sync calls keep
+// using the credential passed to NewClient.
+func WithWriteCredentials(username, password string) Option {
+	return func(o *options) {
+		o.writeUsername = username
+		o.writePassword = password
+	}
+}
+
+// WithProxyAuth authenticates as user with the given backend roles through the security plugin's proxy auth
+// domain instead of basic auth. Empty header names default to x-proxy-user and x-proxy-roles.
+func WithProxyAuth(user string, roles []string, userHeader, rolesHeader string) Option {
+	return func(o *options) {
+		if userHeader == "" {
+			userHeader = defaultProxyUserHeader
+		}
+		if rolesHeader == "" {
+			rolesHeader = defaultProxyRolesHeader
+		}
+		o.proxyAuth = &proxyAuth{
+			userHeader:  userHeader,
+			rolesHeader: rolesHeader,
+			user:        user,
+			roles:       roles,
+		}
+	}
+}
+
+// WithClientCertificate presents a PEM-encoded client certificate and key during the TLS handshake.
+func WithClientCertificate(certPEM, keyPEM []byte) Option {
+	return func(o *options) {
+		o.clientCert = certPEM
+		o.clientKey = keyPEM
+	}
+}
+
+// WithSecurityFlavor selects the security API instead of probing the cluster for it. "auto" or an empty value
+// keeps probing.
+func WithSecurityFlavor(flavor string) Option {
+	return func(o *options) {
+		o.flavor = flavor
+	}
+}
@@ -0,0 +1,280 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MatchPattern reports whether name matches a pattern as the security plugin matches index patterns and
+// actions: a pattern enclosed in slashes is a regular expression, a pattern with * or ? is a wildcard and any
+// other pattern must equal name. Patterns must match the whole name.
+func MatchPattern(pattern, name string) bool {
+	if isRegexPattern(pattern) {
+		re, err := regexp.Compile("^(?:" + pattern[1:len(pattern)-1] + ")$")
+		if err != nil {
+			return false
+		}
+		return re.MatchString(name)
+	}
+	if strings.ContainsAny(pattern, "*?") {
+		return matchWildcard(pattern, name)
+	}
+	return pattern == name
+}
+
+// MatchIndexPattern is MatchPattern for role index patterns, which can also be date math expressions such as
+// <logs-{now/d}>. Date math is resolved at now.
+func MatchIndexPattern(pattern, name string, now time.Time) bool {
+	if strings.HasPrefix(pattern, "<") && strings.HasSuffix(pattern, ">") {
+		resolved, err := ResolveDateMath(pattern, now)
+		if err != nil {
+			return false
+		}
+		pattern = resolved
+	}
+	return MatchPattern(pattern, name)
+}
+
+// matchWildcard matches name against a pattern in which * matches any sequence of characters and ? any single
+// character.
+func matchWildcard(pattern, name string) bool {
+	p, n := 0, 0
+	star, next := -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, n
+			p++
+		case star >= 0:
+			next++
+			p, n = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// dateMathFormat is the format of date math expressions that do not name one.
+const dateMathFormat = "yyyy.MM.dd"
+
+// ResolveDateMath resolves a date math index name such as <logs-{now/d}> or <logs-{now-1M/M{yyyy.MM|UTC}}>.
+// Characters outside braces are kept, and \{ and \} escape literal braces.
+func ResolveDateMath(expr string, now time.Time) (string, error) {
+	if !strings.HasPrefix(expr, "<") || !strings.HasSuffix(expr, ">") {
+		return expr, nil
+	}
+	inner := expr[1 : len(expr)-1]
+
+	var sb strings.Builder
+	for i := 0; i < len(inner); i++ {
+		switch ch := inner[i]; ch {
+		case '\\':
+			if i+1 < len(inner) {
+				i++
+				sb.WriteByte(inner[i])
+			}
+		case '{':
+			end, depth := -1, 0
+			for j := i; j < len(inner) && end < 0; j++ {
+				switch inner[j] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+					if depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end < 0 {
+				return "", fmt.Errorf("unbalanced braces in date math expression %s", expr)
+			}
+			value, err := evalDateMath(inner[i+1:end], now)
+			if err != nil {
+				return "", fmt.Errorf("invalid date math expression %s: %w", expr, err)
+			}
+			sb.WriteString(value)
+			i = end
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), nil
+}
+
+// evalDateMath evaluates the contents of one date math placeholder: an expression relative to now, optionally
+// followed by {format} or {format|time zone}.
+func evalDateMath(placeholder string, now time.Time) (string, error) {
+	math, format := placeholder, dateMathFormat
+	location := time.UTC
+	if i := strings.Index(placeholder, "{"); i >= 0 {
+		if !strings.HasSuffix(placeholder, "}") {
+			return "", fmt.Errorf("unterminated format in %q", placeholder)
+		}
+		math, format = placeholder[:i], placeholder[i+1:len(placeholder)-1]
+		if f, zone, ok := strings.Cut(format, "|"); ok {
+			loc, err := parseTimeZone(zone)
+			if err != nil {
+				return "", err
+			}
+			format, location = f, loc
+		}
+	}
+
+	if !strings.HasPrefix(math, "now") {
+		return "", fmt.Errorf("expression %q does not start with now", math)
+	}
+	t := now.In(location)
+	ops := math[len("now"):]
+	for len(ops) > 0 {
+		op := ops[0]
+		ops = ops[1:]
+		switch op {
+		case '/':
+			if ops == "" {
+				return "", fmt.Errorf("missing rounding unit in %q", math)
+			}
+			var err error
+			if t, err = roundDate(t, ops[0]); err != nil {
+				return "", err
+			}
+			ops = ops[1:]
+		case '+', '-':
+			digits := 0
+			for digits < len(ops) && ops[digits] >= '0' && ops[digits] <= '9' {
+				digits++
+			}
+			if digits == len(ops) {
+				return "", fmt.Errorf("missing unit in %q", math)
+			}
+			n := 1
+			if digits > 0 {
+				n, _ = strconv.Atoi(ops[:digits])
+			}
+			if op == '-' {
+				n = -n
+			}
+			var err error
+			if t, err = addDate(t, n, ops[digits]); err != nil {
+				return "", err
+			}
+			ops = ops[digits+1:]
+		default:
+			return "", fmt.Errorf("unexpected %q in %q", op, math)
+		}
+	}
+
+	layout, err := javaDateLayout(format)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+// parseTimeZone parses a date math time zone: a zone ID such as Europe/Berlin or an offset such as +01:00.
+func parseTimeZone(zone string) (*time.Location, error) {
+	if strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-") {
+		t, err := time.Parse("-07:00", zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone offset %q", zone)
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(zone, offset), nil
+	}
+	return time.LoadLocation(zone)
+}
+
+func addDate(t time.Time, n int, unit byte) (time.Time, error) {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0), nil
+	case 'M':
+		return t.AddDate(0, n, 0), nil
+	case 'w':
+		return t.AddDate(0, 0, 7*n), nil
+	case 'd':
+		return t.AddDate(0, 0, n), nil
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case 's':
+		return t.Add(time.Duration(n) * time.Second), nil
+	}
+	return t, fmt.Errorf("unknown date math unit %q", unit)
+}
+
+func roundDate(t time.Time, unit byte) (time.Time, error) {
+	y, mo, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case 'y':
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, loc), nil
+	case 'M':
+		return time.Date(y, mo, 1, 0, 0, 0, 0, loc), nil
+	case 'w':
+		// Weeks start on Monday.
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, mo, d-offset, 0, 0, 0, 0, loc), nil
+	case 'd':
+		return time.Date(y, mo, d, 0, 0, 0, 0, loc), nil
+	case 'h', 'H':
+		return time.Date(y, mo, d, t.Hour(), 0, 0, 0, loc), nil
+	case 'm':
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, loc), nil
+	case 's':
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+	}
+	return t, fmt.Errorf("unknown date math unit %q", unit)
+}
+
+// javaDateLayouts maps the Java date format fields used in index names to Go layout elements.
+var javaDateLayouts = map[string]string{
+	"yyyy": "2006",
+	"uuuu": "2006",
+	"YYYY": "2006",
+	"yy":   "06",
+	"uu":   "06",
+	"YY":   "06",
+	"MM":   "01",
+	"M":    "1",
+	"dd":   "02",
+	"d":    "2",
+	"HH":   "15",
+	"mm":   "04",
+	"ss":   "05",
+}
+
+// javaDateLayout converts a Java date format such as yyyy.MM.dd to a Go time layout.
+func javaDateLayout(format string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); {
+		ch := format[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z') {
+			sb.WriteByte(ch)
+			i++
+			continue
+		}
+		j := i
+		for j < len(format) && format[j] == ch {
+			j++
+		}
+		layout, ok := javaDateLayouts[format[i:j]]
+		if !ok {
+			return "", fmt.Errorf("unsupported date format field %q", format[i:j])
+		}
+		sb.WriteString(layout)
+		i = j
+	}
+	return sb.String(), nil
+}
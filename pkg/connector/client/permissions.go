@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Account is the user a credential authenticates as, as reported by the account API.
+type Account struct {
+	UserName       string   `json:"user_name"`
+	IsReserved     bool     `json:"is_reserved"`
+	IsHidden       bool     `json:"is_hidden"`
+	IsInternalUser bool     `json:"is_internal_user"`
+	BackendRoles   []string `json:"backend_roles"`
+	Roles          []string `json:"roles"`
+}
+
+// PermissionsInfo is what the security REST API allows a credential: whether it may use the API at all, and
+// the HTTP methods that are disabled per endpoint, e.g. "ROLESMAPPING": ["PUT", "PATCH"].
+type PermissionsInfo struct {
+	UserName          string              `json:"user_name"`
+	HasAPIAccess      bool                `json:"has_api_access"`
+	DisabledEndpoints map[string][]string `json:"disabled_endpoints"`
+}
+
+// Allows reports whether the credential can call the endpoint with the method.
+func (p *PermissionsInfo) Allows(endpoint, method string) bool {
+	return p.HasAPIAccess && !slices.Contains(p.DisabledEndpoints[endpoint], method)
+}
+
+// endpointMethod is a security REST API endpoint and HTTP method.
+type endpointMethod struct {
+	endpoint string
+	method   string
+}
+
+// grantEndpoints are the calls that granting a role makes: its mapping is created or patched.
+var grantEndpoints = []endpointMethod{
+	{endpoint: "ROLESMAPPING", method: http.MethodPut},
+	{endpoint: "ROLESMAPPING", method: http.MethodPatch},
+}
+
+// revokeEndpoints are the calls that revoking a role makes: its mapping is patched, and a directly held role is
+// patched out of the internal user.
+var revokeEndpoints = []endpointMethod{
+	{endpoint: "ROLESMAPPING", method: http.MethodPatch},
+	{endpoint: "INTERNALUSERS", method: http.MethodPatch},
+}
+
+// provisioningEndpoints are the calls that granting and revoking roles make.
+var provisioningEndpoints = []endpointMethod{
+	{endpoint: "ROLESMAPPING", method: http.MethodPut},
+	{endpoint: "ROLESMAPPING", method: http.MethodPatch},
+	{endpoint: "INTERNALUSERS", method: http.MethodPatch},
+}
+
+// GetAccount returns the account of the provisioning credential, which is the sync credential unless a separate
+// one is configured.
+func (c *Client) GetAccount(ctx context.Context) (*Account, *v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityAccount); err != nil {
+		return nil, nil, err
+	}
+
+	var account Account
+	rl, err := c.writeGet(ctx, &account, c.securityPath, "account")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get account: %w", err)
+	}
+	return &account, rl, nil
+}
+
+// GetPermissionsInfo returns what the security REST API allows the provisioning credential.
+func (c *Client) GetPermissionsInfo(ctx context.Context) (*PermissionsInfo, *v2.RateLimitDescription, error) {
+	if err := c.Require(CapabilityPermissionsInfo); err != nil {
+		return nil, nil, err
+	}
+
+	var info PermissionsInfo
+	rl, err := c.writeGet(ctx, &info, c.securityPath, "permissionsinfo")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get permissions info: %w", err)
+	}
+	return &info, rl, nil
+}
+
+// writeGet is get with the provisioning credential. The response cache ignores credentials, so these requests
+// carry an Accept header that the sync credential's requests do not, which keeps their cache entries apart.
+func (c *Client) writeGet(ctx context.Context, out interface{}, elem ...string) (*v2.RateLimitDescription, error) {
+	u, err := getPath(c.baseURL.String(), elem...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url: %w", err)
+	}
+
+	req, err := c.httpClient.NewRequest(ctx, http.MethodGet, u, uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opWrite)
+
+	resp, rl, err := c.doRequest(req, uhttp.WithJSONResponse(out))
+	if err != nil {
+		return rl, err
+	}
+	defer resp.Body.Close()
+
+	return rl, nil
+}
+
+// CheckProvisioning returns an error unless the provisioning credential can grant and revoke roles. The error
+// names each missing endpoint permission. Clusters that cannot report permissions are assumed to allow
+// provisioning, and Elasticsearch role mappings cannot be written at all.
+func (c *Client) CheckProvisioning(ctx context.Context) error {
+	return c.checkEndpoints(ctx, provisioningEndpoints)
+}
+
+// CheckGrant is CheckProvisioning for granting roles, which only writes role mappings.
+func (c *Client) CheckGrant(ctx context.Context) error {
+	return c.checkEndpoints(ctx, grantEndpoints)
+}
+
+// CheckRevoke is CheckProvisioning for revoking roles, which patches role mappings and internal users.
+func (c *Client) CheckRevoke(ctx context.Context) error {
+	return c.checkEndpoints(ctx, revokeEndpoints)
+}
+
+// checkEndpoints returns an error unless the provisioning credential can make the calls.
+func (c *Client) checkEndpoints(ctx context.Context, endpoints []endpointMethod) error {
+	l := ctxzap.Extract(ctx)
+
+	if c.Flavor() == FlavorElasticsearch {
+		return status.Errorf(codes.Unimplemented, "role mappings cannot be written on Elasticsearch")
+	}
+	if !c.Supports(CapabilityPermissionsInfo) {
+		l.Debug("the cluster cannot report permissions, assuming provisioning is allowed")
+		return nil
+	}
+
+	info, _, err := c.GetPermissionsInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	user := info.UserName
+	if c.Supports(CapabilityAccount) {
+		if account, _, err := c.GetAccount(ctx); err == nil {
+			l.Debug("provisioning account",
+				zap.String("user", account.UserName),
+				zap.Strings("roles", account.Roles),
+				zap.Strings("backend_roles", account.BackendRoles),
+			)
+			if len(account.Roles) > 0 {
+				user = fmt.Sprintf("%s (roles %s)", account.UserName, strings.Join(account.Roles, ", "))
+			}
+		} else {
+			l.Debug("failed to get provisioning account", zap.Error(err))
+		}
+	}
+
+	if !info.HasAPIAccess {
+		return status.Errorf(codes.PermissionDenied,
+			"user %s has no security REST API access: map it to a role listed in plugins.security.restapi.roles_enabled", user)
+	}
+
+	var missing []string
+	for _, e := range endpoints {
+		if !info.Allows(e.endpoint, e.method) {
+			missing = append(missing, fmt.Sprintf("%s %s", e.method, strings.ToLower(e.endpoint)))
+		}
+	}
+	if len(missing) > 0 {
+		return status.Errorf(codes.PermissionDenied, "user %s cannot call %s on the security REST API", user, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CheckAPIKeyInvalidation returns an error unless the provisioning credential can invalidate the API keys of every
+// user, which needs the manage_api_key cluster privilege.
+func (c *Client) CheckAPIKeyInvalidation(ctx context.Context) error {
+	if err := c.Require(CapabilityAPIKeys); err != nil {
+		return err
+	}
+	return c.checkClusterPrivileges(ctx, "manage_api_key")
+}
+
+// CheckServiceTokenDeletion returns an error unless the provisioning credential can delete service account
+// tokens, which needs the manage_service_account cluster privilege.
+func (c *Client) CheckServiceTokenDeletion(ctx context.Context) error {
+	if err := c.Require(CapabilityServiceAccounts); err != nil {
+		return err
+	}
+	return c.checkClusterPrivileges(ctx, "manage_service_account")
+}
+
+// checkClusterPrivileges asks Elasticsearch whether the provisioning credential holds the cluster privileges and
+// returns PermissionDenied naming those it lacks.
+func (c *Client) checkClusterPrivileges(ctx context.Context, privileges ...string) error {
+	u, err := getPath(c.baseURL.String(), c.securityPath, "user", "_has_privileges")
+	if err != nil {
+		return fmt.Errorf("failed to get url: %w", err)
+	}
+
+	body := map[string][]string{"cluster": privileges}
+	req, err := c.httpClient.NewRequest(ctx, http.MethodPost, u, uhttp.WithJSONBody(body), uhttp.WithAcceptJSONHeader())
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authenticate(req, opWrite)
+
+	var result struct {
+		Username string          `json:"username"`
+		Cluster  map[string]bool `json:"cluster"`
+	}
+	resp, _, err := c.doRequest(req, uhttp.WithJSONResponse(&result))
+	if err != nil {
+		return fmt.Errorf("failed to check privileges: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var missing []string
+	for _, privilege := range privileges {
+		if !result.Cluster[privilege] {
+			missing = append(missing, privilege)
+		}
+	}
+	if len(missing) > 0 {
+		return status.Errorf(codes.PermissionDenied, "user %s lacks the %s cluster privilege", result.Username, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// retryableStatus reports whether a response status is worth retrying. The security plugin answers bursts with
+// 429, and proxies in front of the cluster return 502, 503 and 504 while nodes restart.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before the given retry attempt, starting at initial and doubling up to max.
+func backoff(attempt int, initial, maxDelay time.Duration) time.Duration {
+	delay := initial
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
+}
+
+// retryAfter parses the Retry-After header, which is either a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// wrapTimeout turns timeout errors into DeadlineExceeded statuses. The http wrapper already does this for
+// errors returned while sending a request, but not for deadlines hit while reading a body or waiting to retry.
+func wrapTimeout(err error) error {
+	if err == nil || status.Code(err) == codes.DeadlineExceeded {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return uhttp.WrapErrors(codes.DeadlineExceeded, "request timeout", err)
+	}
+
+	return err
+}
+
+// doRequest sends req through the http client and retries throttled or transiently failing responses with
+// exponential backoff, honoring Retry-After when the server sends it. The returned rate limit description
+// reports throttling to the SDK even when a retry eventually succeeded.
+//
+// The whole call, including retries, is bounded by the client's request timeout. Timeouts are returned as
+// DeadlineExceeded so they can be told apart from authentication failures.
+func (c *Client) doRequest(req *http.Request, options ...uhttp.DoOption) (*http.Response, *v2.RateLimitDescription, error) {
+	ctx := req.Context()
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	l := ctxzap.Extract(ctx)
+	bustCache(req)
+
+	var throttled *v2.RateLimitDescription
+	for attempt := 0; ; attempt++ {
+		rl := &v2.RateLimitDescription{}
+		resp, err := c.httpClient.Do(req, append(options, uhttp.WithRatelimitData(rl))...)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			throttled = rl
+		}
+		if err == nil {
+			if throttled != nil {
+				return resp, throttled, nil
+			}
+			return resp, rl, nil
+		}
+
+		if resp == nil || !retryableStatus(resp.StatusCode) || attempt >= c.maxRetries {
+			if throttled != nil {
+				return resp, throttled, wrapTimeout(err)
+			}
+			return resp, rl, wrapTimeout(err)
+		}
+		resp.Body.Close()
+
+		now := time.Now()
+		delay, ok := retryAfter(resp, now)
+		if !ok {
+			delay = backoff(attempt, defaultInitialBackoff, defaultMaxBackoff)
+		}
+		if delay > defaultMaxBackoff {
+			delay = defaultMaxBackoff
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			throttled.ResetAt = timestamppb.New(now.Add(delay))
+		}
+
+		l.Debug("retrying request",
+			zap.String("url", req.URL.String()),
+			zap.Int("status", resp.StatusCode),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, throttled, wrapTimeout(ctx.Err())
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, throttled, fmt.Errorf("failed to reset request body: %w", err)
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Risk levels of roles, and of the principals that hold them.
+const (
+	RiskHigh     = "high"
+	RiskCritical = "critical"
+)
+
+// RiskLevels lists the risk levels in increasing order.
+var RiskLevels = []string{RiskHigh, RiskCritical}
+
+// securityIndex is the index that holds the security plugin's configuration.
+const securityIndex = ".opendistro_security"
+
+// systemIndexPatterns are the system indices of OpenSearch plugins.
+var systemIndexPatterns = []string{".opensearch-*", ".opendistro-*", ".plugins-*"}
+
+// securityAPIActions are the prefixes of the actions that manage users, roles and role mappings.
+var securityAPIActions = []string{"restapi:admin/", "cluster:admin/xpack/security/"}
+
+// RoleRisk is the risk level of a role and the permissions that cause it.
+type RoleRisk struct {
+	Level   string
+	Reasons []string
+}
+
+func (r *RoleRisk) add(level, reason string) {
+	r.Level = HighestRisk(r.Level, level)
+	if !slices.Contains(r.Reasons, reason) {
+		r.Reasons = append(r.Reasons, reason)
+	}
+}
+
+// HighestRisk returns the highest of the risk levels, or "" when none is set.
+func HighestRisk(levels ...string) string {
+	highest := ""
+	for _, level := range levels {
+		if slices.Index(RiskLevels, level) > slices.Index(RiskLevels, highest) {
+			highest = level
+		}
+	}
+	return highest
+}
+
+// ClassifyRole returns the risk of a role. Roles are critical when they allow all cluster actions, all index
+// actions on all indices, the security REST API or writes to the security index, and high when they allow
+// writes to other system indices. The level is empty for other roles.
+func ClassifyRole(role Role, clusterGroups, indexGroups ActionGroups) RoleRisk {
+	var risk RoleRisk
+	for _, action := range clusterGroups.Expand(role.ClusterPermissions) {
+		if MatchPattern(action, "cluster:*") {
+			risk.add(RiskCritical, "cluster_all")
+			continue
+		}
+		for _, prefix := range securityAPIActions {
+			if strings.HasPrefix(action, prefix) || MatchPattern(action, prefix+"*") {
+				risk.add(RiskCritical, "security REST API: "+action)
+			}
+		}
+	}
+
+	for _, perm := range role.IndexPermissions {
+		actions := indexGroups.Expand(perm.AllowedActions)
+		levels := ActionAccessLevels(actions)
+		writes := slices.Contains(levels, AccessWrite) || slices.Contains(levels, AccessAdmin)
+		for _, pattern := range perm.IndexPatterns {
+			if pattern == "*" && slices.ContainsFunc(actions, func(action string) bool { return MatchPattern(action, "indices:*") }) {
+				risk.add(RiskCritical, "indices_all on *")
+			}
+			// Only patterns that name dot-prefixed indices reach system indices; "*" does not.
+			if !writes || !strings.HasPrefix(pattern, ".") {
+				continue
+			}
+			if overlaps(pattern, securityIndex) {
+				risk.add(RiskCritical, fmt.Sprintf("write to security index %s", pattern))
+				continue
+			}
+			for _, system := range systemIndexPatterns {
+				if overlaps(pattern, system) {
+					risk.add(RiskHigh, fmt.Sprintf("write to system index %s", pattern))
+				}
+			}
+		}
+	}
+	return risk
+}
+
+// overlaps reports whether two index patterns can name the same index. Date math is resolved at the current
+// time. Regular expressions cannot be intersected, so a pattern and a regular expression overlap only if one
+// matches the other.
+func overlaps(a, b string) bool {
+	now := time.Now()
+	a, b = resolveIndexPattern(a, now), resolveIndexPattern(b, now)
+	if isRegexPattern(a) || isRegexPattern(b) {
+		return MatchPattern(a, b) || MatchPattern(b, a)
+	}
+	return wildcardsIntersect(a, b)
+}
+
+// resolveIndexPattern resolves a date math index pattern as MatchIndexPattern does. Expressions that cannot
+// be resolved are kept, and then only overlap themselves.
+func resolveIndexPattern(pattern string, now time.Time) string {
+	resolved, err := ResolveDateMath(pattern, now)
+	if err != nil {
+		return pattern
+	}
+	return resolved
+}
+
+// isRegexPattern reports whether MatchPattern reads a pattern as a regular expression.
+func isRegexPattern(pattern string) bool {
+	return len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// wildcardsIntersect reports whether some name matches both wildcard patterns, such as p* and *-pii, which
+// neither matches the other. in[i][j] records whether the rest of a from i and the rest of b from j intersect.
+func wildcardsIntersect(a, b string) bool {
+	in := make([][]bool, len(a)+1)
+	for i := range in {
+		in[i] = make([]bool, len(b)+1)
+	}
+	for i := len(a); i >= 0; i-- {
+		for j := len(b); j >= 0; j-- {
+			switch {
+			case i == len(a) && j == len(b):
+				in[i][j] = true
+			case i < len(a) && a[i] == '*':
+				// The star matches nothing, or also the next character or star of b.
+				in[i][j] = in[i+1][j] || (j < len(b) && in[i][j+1])
+			case j < len(b) && b[j] == '*':
+				in[i][j] = in[i][j+1] || (i < len(a) && in[i+1][j])
+			case i < len(a) && j < len(b):
+				in[i][j] = (a[i] == '?' || b[j] == '?' || a[i] == b[j]) && in[i+1][j+1]
+			}
+		}
+	}
+	return in[0][0]
+}
+
+// RoleRisk returns the risk of the named role.
+func (m *AccessModel) RoleRisk(name string) RoleRisk {
+	role, ok := m.role(name)
+	if !ok {
+		return RoleRisk{}
+	}
+	return ClassifyRole(role, m.ClusterGroups, m.IndexGroups)
+}
+
+// UserRisk returns the highest risk level of the roles a user holds.
+func (m *AccessModel) UserRisk(name string) string {
+	user, ok := m.user(name)
+	if !ok {
+		user = User{UserIdentifier: name}
+	}
+	level := ""
+	for _, assignment := range m.userRoles(user) {
+		level = HighestRisk(level, m.RoleRisk(assignment.Role).Level)
+	}
+	return level
+}
+
+// BackendRoleRisk returns the highest risk level of the roles mapped to a backend role.
+func (m *AccessModel) BackendRoleRisk(backendRole string) string {
+	level := ""
+	for _, mapping := range m.Mappings {
+		if allowsAny(mapping.BackendRoles, []string{backendRole}) {
+			level = HighestRisk(level, m.RoleRisk(mapping.Name).Level)
+		}
+	}
+	return level
+}
@@ -0,0 +1,287 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	principalUser  = "user"
+	principalGroup = "group"
+)
+
+// principalMatch is a user or group that an Elasticsearch role mapping rule selects. Conditions are the other
+// parts of the rule, such as the realm or DN, that Elasticsearch also checks when the principal authenticates.
+type principalMatch struct {
+	kind       string
+	name       string
+	conditions []string
+}
+
+// ruleResult is the static evaluation of a role mapping rule.
+type ruleResult struct {
+	// matches are the principals the rule selects.
+	matches []principalMatch
+	// conditions are constraints that select no principal on their own, like "realm.name is ldap1".
+	conditions []string
+	// unresolved describes parts of the rule that cannot be turned into principals without knowing every user
+	// that may ever authenticate, such as username patterns.
+	unresolved []string
+}
+
+// evaluate resolves a rule to the users and groups it maps. Literal username and groups values become
+// principals; dn, realm and metadata fields, "except" clauses and sibling clauses of "all" become conditions on
+// those principals. Patterns, and rules that match no named principal, are reported as unresolved.
+func (r esRule) evaluate() ruleResult {
+	var rv ruleResult
+
+	fields := make([]string, 0, len(r.Field))
+	for field := range r.Field {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		raw := r.Field[field]
+		switch field {
+		case "username", "groups":
+			kind := principalUser
+			if field == "groups" {
+				kind = principalGroup
+			}
+			for _, value := range fieldValues(raw) {
+				if isPattern(value) {
+					rv.unresolved = append(rv.unresolved, fmt.Sprintf("%s matches %s", field, value))
+					continue
+				}
+				rv.matches = append(rv.matches, principalMatch{kind: kind, name: value})
+			}
+		default:
+			rv.conditions = append(rv.conditions, describeField(field, raw))
+		}
+	}
+
+	for _, sub := range r.Any {
+		res := sub.evaluate()
+		rv.matches = append(rv.matches, res.matches...)
+		rv.unresolved = append(rv.unresolved, res.unresolved...)
+		// A branch of "any" with conditions but no principals maps everyone meeting the conditions.
+		if len(res.matches) == 0 && len(res.conditions) > 0 {
+			rv.unresolved = append(rv.unresolved, "any user where "+strings.Join(res.conditions, " and "))
+		}
+	}
+
+	if len(r.All) > 0 {
+		rv = rv.merge(evaluateAll(r.All))
+	}
+
+	if r.Except != nil {
+		rv.conditions = append(rv.conditions, "not ("+r.Except.describe()+")")
+	}
+
+	return rv
+}
+
+// evaluateAll resolves an "all" clause. The principals of the first clause that names any become the matches,
+// and every other clause becomes a condition on them.
+func evaluateAll(rules []esRule) ruleResult {
+	results := make([]ruleResult, 0, len(rules))
+	selected := -1
+	for i, sub := range rules {
+		res := sub.evaluate()
+		results = append(results, res)
+		if selected == -1 && len(res.matches) > 0 {
+			selected = i
+		}
+	}
+
+	var rv ruleResult
+	if selected == -1 {
+		for _, res := range results {
+			rv.conditions = append(rv.conditions, res.conditions...)
+			rv.unresolved = append(rv.unresolved, res.unresolved...)
+		}
+		return rv
+	}
+
+	var conditions []string
+	for i, sub := range rules {
+		if i != selected {
+			conditions = append(conditions, sub.describe())
+		}
+	}
+	conditions = append(conditions, results[selected].conditions...)
+
+	for _, m := range results[selected].matches {
+		m.conditions = append(slices.Clone(m.conditions), conditions...)
+		rv.matches = append(rv.matches, m)
+	}
+	for _, u := range results[selected].unresolved {
+		if len(conditions) > 0 {
+			u += " and " + strings.Join(conditions, " and ")
+		}
+		rv.unresolved = append(rv.unresolved, u)
+	}
+
+	return rv
+}
+
+// merge combines the result of a sibling clause in the same rule object, which must also hold.
+func (r ruleResult) merge(other ruleResult) ruleResult {
+	return ruleResult{
+		matches:    append(slices.Clone(r.matches), other.matches...),
+		conditions: append(slices.Clone(r.conditions), other.conditions...),
+		unresolved: append(slices.Clone(r.unresolved), other.unresolved...),
+	}
+}
+
+// principals returns the matches with the rule's own conditions applied, and a description of everything that
+// could not be resolved. A rule made only of conditions maps every user that meets them, so it is unresolved.
+func (r ruleResult) principals() ([]principalMatch, []string) {
+	unresolved := slices.Clone(r.unresolved)
+	if len(r.matches) == 0 && len(r.conditions) > 0 {
+		unresolved = append(unresolved, "any user where "+strings.Join(r.conditions, " and "))
+	}
+
+	matches := make([]principalMatch, 0, len(r.matches))
+	for _, m := range r.matches {
+		m.conditions = append(slices.Clone(m.conditions), r.conditions...)
+		matches = append(matches, m)
+	}
+
+	return matches, unresolved
+}
+
+// describe renders a rule in a compact, readable form for grant metadata.
+func (r esRule) describe() string {
+	var parts []string
+
+	fields := make([]string, 0, len(r.Field))
+	for field := range r.Field {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		parts = append(parts, describeField(field, r.Field[field]))
+	}
+
+	if len(r.Any) > 0 {
+		sub := make([]string, 0, len(r.Any))
+		for _, s := range r.Any {
+			sub = append(sub, s.describe())
+		}
+		parts = append(parts, "("+strings.Join(sub, " or ")+")")
+	}
+
+	if len(r.All) > 0 {
+		sub := make([]string, 0, len(r.All))
+		for _, s := range r.All {
+			sub = append(sub, s.describe())
+		}
+		parts = append(parts, "("+strings.Join(sub, " and ")+")")
+	}
+
+	if r.Except != nil {
+		parts = append(parts, "not ("+r.Except.describe()+")")
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+func describeField(field string, raw json.RawMessage) string {
+	var values []interface{}
+	if err := json.Unmarshal(raw, &values); err == nil {
+		rendered := make([]string, 0, len(values))
+		for _, v := range values {
+			rendered = append(rendered, fmt.Sprint(v))
+		}
+		return fmt.Sprintf("%s in [%s]", field, strings.Join(rendered, ", "))
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err == nil {
+		if value == nil {
+			return field + " is unset"
+		}
+		return fmt.Sprintf("%s is %v", field, value)
+	}
+
+	return fmt.Sprintf("%s is %s", field, string(raw))
+}
+
+// isPattern reports whether a field value is a wildcard or /regex/ rather than a literal. A lone "*" is kept
+// as a literal since the connector already represents it as "every user" or "every group".
+func isPattern(value string) bool {
+	if value == "*" {
+		return false
+	}
+	if len(value) > 1 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+		return true
+	}
+	return strings.ContainsAny(value, "*?")
+}
+
+// esRoleTemplate is a mustache template in a role mapping that computes role names at authentication time.
+type esRoleTemplate struct {
+	Template struct {
+		Source string `json:"source"`
+	} `json:"template"`
+	Format string `json:"format"`
+}
+
+// templateRoles describes the roles a role template produces.
+type templateRoles struct {
+	// names are roles the template always produces because it contains no mustache tags.
+	names []string
+	// usernameAsRole is set for templates that turn the username into a role of the same name.
+	usernameAsRole bool
+	// groupsAsRoles is set for templates that turn each of the user's groups into a role of the same name.
+	groupsAsRoles bool
+	// unresolved holds the sources of templates whose output depends on anything else.
+	unresolved []string
+}
+
+// evaluateTemplates resolves the role templates of a mapping. Static templates and the common username and
+// groups templates are resolved; anything else is reported as unresolved.
+func evaluateTemplates(raw []json.RawMessage) templateRoles {
+	var rv templateRoles
+	for _, r := range raw {
+		var t esRoleTemplate
+		if err := json.Unmarshal(r, &t); err != nil {
+			rv.unresolved = append(rv.unresolved, string(r))
+			continue
+		}
+
+		source := strings.TrimSpace(t.Template.Source)
+		compact := strings.ReplaceAll(source, " ", "")
+		switch {
+		case !strings.Contains(source, "{{"):
+			if t.Format == "json" {
+				var names []string
+				if err := json.Unmarshal([]byte(source), &names); err == nil {
+					rv.names = append(rv.names, names...)
+					continue
+				}
+				var name string
+				if err := json.Unmarshal([]byte(source), &name); err == nil {
+					rv.names = append(rv.names, name)
+					continue
+				}
+				rv.unresolved = append(rv.unresolved, source)
+				continue
+			}
+			rv.names = append(rv.names, source)
+		case compact == "{{username}}" || compact == "{{user.username}}":
+			rv.usernameAsRole = true
+		case compact == "{{#tojson}}groups{{/tojson}}" && t.Format == "json":
+			rv.groupsAsRoles = true
+		default:
+			rv.unresolved = append(rv.unresolved, source)
+		}
+	}
+
+	return rv
+}
@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// searchGuardFields maps Search Guard field names to the security plugin names used by the models. Search
+// Guard 7 differs only in the user's role field; the rest are the Search Guard 6 spellings.
+var searchGuardFields = map[string]string{
+	"search_guard_roles": "opendistro_security_roles",
+	"roles":              "backend_roles",
+	"backendroles":       "backend_roles",
+	"andbackendroles":    "and_backend_roles",
+	"cluster":            "cluster_permissions",
+}
+
+// searchGuard7PatchPaths maps the patch paths of models to Search Guard 7 field names, per configuration type.
+var searchGuard7PatchPaths = map[string]map[string]string{
+	"internalusers": {"/opendistro_security_roles": "/search_guard_roles"},
+}
+
+// searchGuard6PatchPaths maps the patch paths of models to Search Guard 6 field names, per configuration type.
+// Search Guard 6 users only hold backend roles, in roles, so they have no field for directly assigned roles.
+var searchGuard6PatchPaths = map[string]map[string]string{
+	"internalusers": {"/backend_roles": "/roles", "/opendistro_security_roles": ""},
+	"rolesmapping":  {"/backend_roles": "/backendroles", "/and_backend_roles": "/andbackendroles"},
+}
+
+// searchGuard6 reports whether the cluster runs Search Guard 6, which spells most fields differently. Clusters
+// of unknown version are taken to run Search Guard 7.
+func (c *Client) searchGuard6() bool {
+	return c.flavor == FlavorSearchGuard && !c.version.IsZero() && c.version.Major < 7
+}
+
+// sgPatchPath translates a patch path of a model, such as "/backend_roles/-", to the Search Guard field names
+// of the cluster's version. It returns false when the configuration type has no such field.
+func (c *Client) sgPatchPath(configType, path string) (string, bool) {
+	paths := searchGuard7PatchPaths[configType]
+	if c.searchGuard6() {
+		paths = searchGuard6PatchPaths[configType]
+	}
+
+	name, rest, nested := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if nested {
+		rest = "/" + rest
+	}
+	translated, ok := paths["/"+name]
+	switch {
+	case !ok:
+		return path, true
+	case translated == "":
+		return "", false
+	default:
+		return translated + rest, true
+	}
+}
+
+// sgPatch translates the paths of patch operations on a Search Guard configuration type.
+func (c *Client) sgPatch(configType string, ops []PatchOperation) ([]PatchOperation, error) {
+	translated := make([]PatchOperation, 0, len(ops))
+	for _, op := range ops {
+		path, ok := c.sgPatchPath(configType, op.Path)
+		if !ok {
+			return nil, status.Errorf(codes.Unimplemented, "Search Guard %d %s have no field for %s", c.version.Major, configType, op.Path)
+		}
+		op.Path = path
+		translated = append(translated, op)
+	}
+	return translated, nil
+}
+
+// isSearchGuardMeta reports whether a configuration entry is Search Guard bookkeeping, such as _sg_meta, rather
+// than a user, role or mapping.
+func isSearchGuardMeta(name string) bool {
+	return strings.HasPrefix(name, "_sg_") || name == "_meta"
+}
+
+// translateSearchGuard renames the fields of a Search Guard entity to their security plugin names.
+func translateSearchGuard(entity map[string]json.RawMessage) map[string]json.RawMessage {
+	rv := make(map[string]json.RawMessage, len(entity))
+	for field, value := range entity {
+		if field == "indices" {
+			if perms, ok := translateSearchGuardIndices(value); ok {
+				rv["index_permissions"] = perms
+			}
+			continue
+		}
+		if name, ok := searchGuardFields[field]; ok {
+			field = name
+		}
+		rv[field] = value
+	}
+	return rv
+}
+
+// translateSearchGuardIndices converts Search Guard 6 index permissions, keyed by index pattern and then by
+// document type, to index_permissions entries. Patterns and document types are taken in sorted order so that
+// the entries and their actions do not change from one sync to the next.
+func translateSearchGuardIndices(raw json.RawMessage) (json.RawMessage, bool) {
+	var indices map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &indices); err != nil {
+		return nil, false
+	}
+
+	var perms []IndexPermission
+	for _, pattern := range slices.Sorted(maps.Keys(indices)) {
+		types := indices[pattern]
+		perm := IndexPermission{IndexPatterns: []string{pattern}}
+		for _, docType := range slices.Sorted(maps.Keys(types)) {
+			value := types[docType]
+			if docType == "_dls_" {
+				_ = json.Unmarshal(value, &perm.DLS)
+				continue
+			}
+			var values []string
+			if err := json.Unmarshal(value, &values); err != nil {
+				continue
+			}
+			// Field level settings sit next to the document types.
+			switch docType {
+			case "_fls_":
+				perm.FLS = values
+			case "_masked_fields_":
+				perm.MaskedFields = values
+			default:
+				perm.AllowedActions = append(perm.AllowedActions, values...)
+			}
+		}
+		perms = append(perms, perm)
+	}
+
+	b, err := json.Marshal(perms)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// sgGet reads a Search Guard configuration type such as internalusers, translates every entry and decodes the
+// result into out, which must be a map of the target model keyed by name.
+func (c *Client) sgGet(ctx context.Context, out interface{}, elem ...string) (*v2.RateLimitDescription, error) {
+	raw := map[string]map[string]json.RawMessage{}
+	rl, err := c.securityGet(ctx, &raw, elem...)
+	if err != nil {
+		return rl, err
+	}
+
+	translated := make(map[string]map[string]json.RawMessage, len(raw))
+	for name, entity := range raw {
+		if isSearchGuardMeta(name) {
+			continue
+		}
+		translated[name] = translateSearchGuard(entity)
+	}
+
+	b, err := json.Marshal(translated)
+	if err != nil {
+		return rl, err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return rl, fmt.Errorf("failed to decode Search Guard response: %w", err)
+	}
+
+	return rl, nil
+}
+
+func (c *Client) sgUsers(ctx context.Context) ([]User, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	raw := map[string]User{}
+	rl, err := c.sgGet(ctx, &raw, "internalusers")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	var users []User
+	for userIdentifier, user := range raw {
+		user.UserIdentifier = userIdentifier
+		users = append(users, user)
+	}
+
+	l.Debug("retrieved users", zap.Int("count", len(users)))
+	return users, rl, nil
+}
+
+func (c *Client) sgRoles(ctx context.Context) ([]Role, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	raw := map[string]Role{}
+	rl, err := c.sgGet(ctx, &raw, "roles")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	var roles []Role
+	for roleName, role := range raw {
+		role.Name = roleName
+		roles = append(roles, role)
+	}
+
+	l.Debug("retrieved roles", zap.Int("count", len(roles)))
+	return roles, rl, nil
+}
+
+func (c *Client) sgRole(ctx context.Context, name string) (*Role, *v2.RateLimitDescription, error) {
+	raw := map[string]Role{}
+	rl, err := c.sgGet(ctx, &raw, "roles", name)
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	role, ok := raw[name]
+	if !ok {
+		return nil, rl, status.Errorf(codes.NotFound, "role %s not found", name)
+	}
+
+	role.Name = name
+	return &role, rl, nil
+}
+
+func (c *Client) sgRoleMappings(ctx context.Context) ([]RoleMapping, *v2.RateLimitDescription, error) {
+	l := ctxzap.Extract(ctx)
+
+	raw := map[string]RoleMapping{}
+	rl, err := c.sgGet(ctx, &raw, "rolesmapping")
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get role mappings: %w", err)
+	}
+
+	var roleMappings []RoleMapping
+	for roleName, roleMapping := range raw {
+		roleMapping.Name = roleName
+		roleMappings = append(roleMappings, roleMapping)
+	}
+
+	l.Debug("retrieved role mappings", zap.Int("count", len(roleMappings)))
+	return roleMappings, rl, nil
+}
+
+func (c *Client) sgRoleMapping(ctx context.Context, name string) (*RoleMapping, *v2.RateLimitDescription, error) {
+	raw := map[string]RoleMapping{}
+	rl, err := c.sgGet(ctx, &raw, "rolesmapping", name)
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get role mapping: %w", err)
+	}
+
+	roleMapping, ok := raw[name]
+	if !ok {
+		return nil, rl, status.Errorf(codes.NotFound, "role mapping %s not found", name)
+	}
+
+	roleMapping.Name = name
+	return &roleMapping, rl, nil
+}
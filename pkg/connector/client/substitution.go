@@ -0,0 +1,182 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// variablePattern matches the user variables that index patterns and DLS queries can reference, such as
+// ${user.name} or ${attr.internal.team}.
+var variablePattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Templated reports whether the permission's index patterns or DLS query reference user variables, so that
+// its effect differs per user.
+func (p IndexPermission) Templated() bool {
+	if variablePattern.MatchString(p.DLS) {
+		return true
+	}
+	for _, pattern := range p.IndexPatterns {
+		if variablePattern.MatchString(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserContext holds the values of the user variables for one user.
+type UserContext struct {
+	Name string
+	// BackendRoles are the values of ${user.roles}, SecurityRoles those of ${user.securityRoles}.
+	BackendRoles  []string
+	SecurityRoles []string
+	// Attributes are the internal user attributes referenced as ${attr.internal.<name>}.
+	Attributes map[string]interface{}
+}
+
+// NewUserContext returns the variables of an internal user who holds securityRoles.
+func NewUserContext(user User, securityRoles []string) UserContext {
+	return UserContext{
+		Name:          user.UserIdentifier,
+		BackendRoles:  user.BackendRoles,
+		SecurityRoles: securityRoles,
+		Attributes:    user.Attributes,
+	}
+}
+
+// lookup returns the values of a variable, or false when the variable is unknown or the user has no such
+// attribute. The underscore spellings are the legacy forms.
+func (u UserContext) lookup(variable string) ([]string, bool) {
+	switch variable {
+	case "user.name", "user_name":
+		return []string{u.Name}, true
+	case "user.roles", "user_roles":
+		return u.BackendRoles, true
+	case "user.securityRoles", "user_securityRoles":
+		return u.SecurityRoles, true
+	}
+
+	name, ok := strings.CutPrefix(variable, "attr.internal.")
+	if !ok {
+		return nil, false
+	}
+	value, ok := u.Attributes[name]
+	if !ok {
+		return nil, false
+	}
+	if values, ok := value.([]interface{}); ok {
+		rv := make([]string, 0, len(values))
+		for _, v := range values {
+			rv = append(rv, fmt.Sprint(v))
+		}
+		return rv, true
+	}
+	return []string{fmt.Sprint(value)}, true
+}
+
+// Substitute replaces the user variables in s. Variables with several values, such as ${user.roles}, are
+// replaced by the values joined with commas. Unknown variables are left as they are.
+func (u UserContext) Substitute(s string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		values, ok := u.lookup(match[2 : len(match)-1])
+		if !ok {
+			return match
+		}
+		return strings.Join(values, ",")
+	})
+}
+
+// ExpandPattern replaces the user variables in an index pattern. A variable with several values yields a
+// pattern per value, so ${user.roles}-* becomes one pattern per backend role. A variable without values yields
+// no pattern. Unknown variables are left as they are.
+func (u UserContext) ExpandPattern(pattern string) []string {
+	patterns := []string{""}
+	last := 0
+	for _, loc := range variablePattern.FindAllStringSubmatchIndex(pattern, -1) {
+		literal := pattern[last:loc[0]]
+		values, ok := u.lookup(pattern[loc[2]:loc[3]])
+		if !ok {
+			values = []string{pattern[loc[0]:loc[1]]}
+		}
+
+		expanded := make([]string, 0, len(patterns)*len(values))
+		for _, prefix := range patterns {
+			for _, value := range values {
+				expanded = append(expanded, prefix+literal+value)
+			}
+		}
+		patterns = expanded
+		last = loc[1]
+	}
+
+	for i := range patterns {
+		patterns[i] += pattern[last:]
+	}
+	return patterns
+}
+
+// Apply returns the permission as it applies to the user, with the user variables of its index patterns and
+// DLS query substituted.
+func (u UserContext) Apply(p IndexPermission) IndexPermission {
+	var patterns []string
+	for _, pattern := range p.IndexPatterns {
+		patterns = append(patterns, u.ExpandPattern(pattern)...)
+	}
+	p.IndexPatterns = patterns
+	p.DLS = u.Substitute(p.DLS)
+	return p
+}
+
+// RoleAssignment is a role that a user holds, and the sources it holds it through: "user" for roles assigned
+// on the user, "role_mapping" for mappings that name the user, and "backend_role:<name>" for mappings of the
+// user's backend roles.
+type RoleAssignment struct {
+	Role    string
+	Sources []string
+}
+
+// UserRoles returns the roles an internal user holds, directly or through role mappings, sorted by role.
+// Mapped users and backend roles can be wildcard patterns, and and_backend_roles must all be held.
+func UserRoles(user User, mappings []RoleMapping) []RoleAssignment {
+	sources := map[string][]string{}
+	for _, role := range user.OpendistroSecurityRoles {
+		sources[role] = append(sources[role], "user")
+	}
+
+	for _, mapping := range mappings {
+		for _, pattern := range mapping.Users {
+			if MatchPattern(pattern, user.UserIdentifier) {
+				sources[mapping.Name] = append(sources[mapping.Name], "role_mapping")
+				break
+			}
+		}
+		for _, pattern := range mapping.BackendRoles {
+			for _, backendRole := range user.BackendRoles {
+				if MatchPattern(pattern, backendRole) {
+					sources[mapping.Name] = append(sources[mapping.Name], "backend_role:"+backendRole)
+				}
+			}
+		}
+		if len(mapping.AndBackendRoles) > 0 && holdsAll(user.BackendRoles, mapping.AndBackendRoles) {
+			sources[mapping.Name] = append(sources[mapping.Name], "backend_role:"+strings.Join(mapping.AndBackendRoles, "+"))
+		}
+	}
+
+	assignments := make([]RoleAssignment, 0, len(sources))
+	for role, s := range sources {
+		assignments = append(assignments, RoleAssignment{Role: role, Sources: s})
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].Role < assignments[j].Role })
+	return assignments
+}
+
+// holdsAll reports whether every pattern matches one of the backend roles.
+func holdsAll(backendRoles []string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if !allowsAny([]string{pattern}, backendRoles) {
+			return false
+		}
+	}
+	return true
+}
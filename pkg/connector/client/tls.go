@@ -0,0 +1,121 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// parseTLSVersion maps a configured minimum TLS version such as "1.2" to its crypto/tls constant.
+func parseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls") {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported minimum TLS version %q, expected 1.2 or 1.3", version)
+	}
+}
+
+// parsePinnedKeys decodes base64 SHA-256 SPKI fingerprints. An optional "sha256/" prefix, as printed by
+// common pinning tools, is accepted.
+func parsePinnedKeys(pins []string) ([][]byte, error) {
+	var rv [][]byte
+	for _, pin := range pins {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		if pin == "" {
+			continue
+		}
+
+		digest, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPKI fingerprint %q: %w", pin, err)
+		}
+		if len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid SPKI fingerprint %q: expected a base64 SHA-256 digest", pin)
+		}
+		rv = append(rv, digest)
+	}
+
+	return rv, nil
+}
+
+// spkiFingerprint returns the SHA-256 digest of a certificate's SubjectPublicKeyInfo.
+func spkiFingerprint(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// verifyPinnedKeys returns a connection check that accepts the peer only if a certificate in a verified chain
+// has one of the pinned public keys. The certificates a peer sends are not trusted by themselves, since anyone
+// can append a public CA certificate to their own chain. When verification is skipped there are no verified
+// chains, so only the leaf certificate is compared.
+func verifyPinnedKeys(pins [][]byte, leafOnly bool) func(tls.ConnectionState) error {
+	matches := func(cert *x509.Certificate) bool {
+		fingerprint := spkiFingerprint(cert)
+		for _, pin := range pins {
+			if subtle.ConstantTimeCompare(fingerprint, pin) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(cs tls.ConnectionState) error {
+		if leafOnly {
+			if len(cs.PeerCertificates) > 0 && matches(cs.PeerCertificates[0]) {
+				return nil
+			}
+		} else {
+			for _, chain := range cs.VerifiedChains {
+				if slices.ContainsFunc(chain, matches) {
+					return nil
+				}
+			}
+		}
+
+		return fmt.Errorf("tls: %s: %w", cs.ServerName, errPinnedKeyMismatch)
+	}
+}
+
+// applyTLSOptions layers the server name override, minimum version, client certificate and key pinning on top
+// of a base config.
+func applyTLSOptions(cfg *tls.Config, o *options) error {
+	if o.tlsServerName != "" {
+		cfg.ServerName = o.tlsServerName
+	}
+
+	minVersion, err := parseTLSVersion(o.tlsMinVersion)
+	if err != nil {
+		return err
+	}
+	if minVersion != 0 {
+		cfg.MinVersion = minVersion
+	}
+
+	if len(o.clientCert) > 0 || len(o.clientKey) > 0 {
+		cert, err := tls.X509KeyPair(o.clientCert, o.clientKey)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	pins, err := parsePinnedKeys(o.pinnedKeys)
+	if err != nil {
+		return err
+	}
+	if len(pins) > 0 {
+		cfg.VerifyConnection = verifyPinnedKeys(pins, cfg.InsecureSkipVerify)
+	}
+
+	return nil
+}
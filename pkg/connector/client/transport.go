@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/opensearch-project/opensearch-go/v4/opensearchtransport"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultNodeRetries is the number of additional nodes a request is sent to after a connection error.
+	defaultNodeRetries = 3
+
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 60 * time.Second
+	defaultRequestTimeout = 5 * time.Minute
+)
+
+// newHTTPTransport returns the transport used to talk to a single node. Dialing and the TLS handshake are
+// bounded by connectTimeout, and waiting for response headers by readTimeout, so a hung node fails the
+// request instead of stalling the sync.
+func newHTTPTransport(tlsConfig *tls.Config, connectTimeout, readTimeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   10,
+	}
+}
+
+// NewHTTPClient returns an http.Client for AWS APIs called next to the cluster, such as the OpenSearch Serverless
+// control plane, with the same connect and read timeouts and minimum TLS version as the cluster client. Zero
+// timeouts use the cluster client's defaults.
+func NewHTTPClient(connectTimeout, readTimeout time.Duration, minTLSVersion string) (*http.Client, error) {
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+	if readTimeout <= 0 {
+		readTimeout = defaultReadTimeout
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := applyTLSOptions(tlsConfig, &options{tlsMinVersion: minTLSVersion}); err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: newHTTPTransport(tlsConfig, connectTimeout, readTimeout),
+		Timeout:   connectTimeout + readTimeout,
+	}, nil
+}
+
+// nodeTransport spreads requests over a pool of OpenSearch nodes. It uses the opensearch-go transport for
+// health-aware round-robin selection, so a node that fails with a connection error is marked dead and the
+// request is retried on the next live node.
+type nodeTransport struct {
+	pool *opensearchtransport.Client
+	// basePath is the path of the primary address. Requests are built against the primary address, so this
+	// prefix is stripped before the pool applies the path of whichever node it selects.
+	basePath string
+}
+
+func (t *nodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.basePath != "" {
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, t.basePath)
+		req.URL.RawPath = ""
+	}
+
+	return t.pool.Perform(req)
+}
+
+// Nodes returns the addresses of the nodes currently in the pool.
+func (t *nodeTransport) Nodes() []*url.URL {
+	return t.pool.URLs()
+}
+
+// newNodeTransport creates a transport that routes requests across the given addresses. When discoverNodes is
+// set, the HTTP-enabled nodes of the cluster are read from _nodes/http and replace the seed addresses.
+func newNodeTransport(
+	ctx context.Context,
+	addresses []*url.URL,
+	base http.RoundTripper,
+	username, password string,
+	discoverNodes bool,
+) (*nodeTransport, error) {
+	l := ctxzap.Extract(ctx)
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("at least one address is required")
+	}
+
+	cfg := opensearchtransport.Config{
+		URLs:      addresses,
+		Username:  username,
+		Password:  password,
+		Transport: base,
+		// Only connection errors are retried here. Retrying on response status is handled by the client.
+		RetryOnStatus: []int{},
+		MaxRetries:    defaultNodeRetries,
+	}
+
+	pool, err := opensearchtransport.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create node pool: %w", err)
+	}
+
+	if discoverNodes {
+		if err := pool.DiscoverNodes(); err != nil {
+			l.Warn("failed to discover nodes, using seed addresses", zap.Error(err))
+		}
+
+		// Discovery replaces the pool even when every node is cluster-manager only, so fall back to the seeds.
+		if len(pool.URLs()) == 0 {
+			l.Warn("node discovery returned no HTTP nodes, using seed addresses")
+			pool, err = opensearchtransport.New(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create node pool: %w", err)
+			}
+		}
+	}
+
+	t := &nodeTransport{
+		pool:     pool,
+		basePath: strings.TrimSuffix(addresses[0].Path, "/"),
+	}
+
+	nodes := make([]string, 0, len(t.Nodes()))
+	for _, u := range t.Nodes() {
+		nodes = append(nodes, u.String())
+	}
+	l.Debug("configured node pool", zap.Strings("nodes", nodes))
+
+	return t, nil
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errPinnedKeyMismatch is returned when no certificate of a node matches a pinned public key.
+var errPinnedKeyMismatch = errors.New("no certificate matches a pinned public key")
+
+// healthPaths are the security plugin health endpoints. Elasticsearch has none.
+var healthPaths = map[Flavor]string{
+	FlavorOpenSearch:  "/_plugins/_security/health",
+	FlavorOpenDistro:  "/_opendistro/_security/health",
+	FlavorSearchGuard: "/_searchguard/health",
+}
+
+// restAPISettings name the setting that lists the roles allowed to use each flavor's security REST API.
+var restAPISettings = map[Flavor]string{
+	FlavorOpenSearch:  "plugins.security.restapi.roles_enabled",
+	FlavorOpenDistro:  "opendistro_security.restapi.roles_enabled",
+	FlavorSearchGuard: "searchguard.restapi.roles_enabled",
+}
+
+// securityHealth is the response of the security plugin health endpoint.
+type securityHealth struct {
+	Status  string `json:"status"`
+	Mode    string `json:"mode"`
+	Message string `json:"message"`
+}
+
+// Validate checks that the connector can sync the cluster: the credentials are accepted, the security plugin
+// is installed and healthy, and roles, role mappings and users can be read. The errors say what to fix.
+func (c *Client) Validate(ctx context.Context) error {
+	if c.detectErr != nil {
+		return c.explain(c.detectErr, "failed to find a security API on the cluster, set security-api-flavor to skip detection")
+	}
+
+	var authInfo map[string]interface{}
+	if _, err := c.get(ctx, &authInfo, nil, flavorProbes[c.Flavor()]); err != nil {
+		return c.explain(err, "failed to authenticate")
+	}
+
+	if path, ok := healthPaths[c.Flavor()]; ok {
+		var health securityHealth
+		if _, err := c.get(ctx, &health, nil, path); err != nil {
+			return c.explain(err, "failed to read the security plugin health")
+		}
+		if !strings.EqualFold(health.Status, "UP") {
+			return fmt.Errorf("the security plugin is %s (mode %s): %s", health.Status, health.Mode, health.Message)
+		}
+	}
+
+	if _, _, err := c.GetRoles(ctx); err != nil {
+		return c.explain(err, "failed to read roles")
+	}
+	if _, _, err := c.GetRoleMappings(ctx); err != nil {
+		return c.explain(err, "failed to read role mappings")
+	}
+	if _, _, err := c.GetUsers(ctx); err != nil {
+		return c.explain(err, "failed to read users")
+	}
+	return nil
+}
+
+// user names the identity the sync credential authenticates as.
+func (c *Client) user() string {
+	switch auth := c.readAuth.(type) {
+	case basicAuth:
+		return auth.username
+	case proxyAuth:
+		return auth.user
+	default:
+		return ""
+	}
+}
+
+// explain prefixes err with what failed and adds the likely fix for TLS trust failures, rejected credentials,
+// a missing security plugin and missing REST API access.
+func (c *Client) explain(err error, what string) error {
+	var hint string
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var recordHeader tls.RecordHeaderError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		hint = "the node certificate is not signed by a trusted CA: set ca-cert-path or ca-cert to the cluster's CA certificate"
+	case errors.As(err, &hostname):
+		hint = fmt.Sprintf("the node certificate is not valid for %s: set tls-server-name to a name it lists", hostname.Host)
+	case errors.As(err, &invalid):
+		hint = "the node certificate is invalid or expired"
+	case errors.Is(err, errPinnedKeyMismatch):
+		hint = "no certificate of the node matches tls-pinned-public-keys"
+	case errors.As(err, &recordHeader):
+		hint = "the node does not speak TLS: use an http:// address or enable TLS on the HTTP layer"
+	case errors.Is(err, errUnauthorized), status.Code(err) == codes.Unauthenticated:
+		if _, ok := c.readAuth.(proxyAuth); ok {
+			hint = fmt.Sprintf("the cluster did not accept proxy user %s: check that the connector's address is a trusted internal proxy", c.user())
+		} else {
+			hint = fmt.Sprintf("the cluster rejected the password of user %s", c.user())
+		}
+	case status.Code(err) == codes.NotFound:
+		hint = "the security plugin is not installed or not enabled on the cluster"
+	case status.Code(err) == codes.PermissionDenied:
+		if c.Flavor() == FlavorElasticsearch {
+			hint = fmt.Sprintf("user %s needs the read_security cluster privilege", c.user())
+		} else {
+			hint = fmt.Sprintf("REST API access is not enabled for the roles of user %s: add one of them to %s", c.user(), restAPISettings[c.Flavor()])
+		}
+	}
+
+	if hint == "" {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	return fmt.Errorf("%s, %s: %w", what, hint, err)
+}
@@ -0,0 +1,234 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	batonResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Cluster configures one named cluster of a multi-cluster connector. The fields are the arguments of New.
+type Cluster struct {
+	Name               string
+	Address            string
+	Username           string
+	Password           string
+	UserMatchKey       string
+	InsecureSkipVerify bool
+	Credentials        []byte
+	Options            []client.Option
+}
+
+// namespace prefixes resource IDs with a cluster name, so that same-named roles, users and groups of different
+// clusters do not collide. The empty namespace of a single-cluster connector leaves IDs unchanged.
+type namespace string
+
+// id namespaces a cluster-local ID, e.g. "prod/all_access".
+func (n namespace) id(local string) string {
+	if n == "" {
+		return local
+	}
+	return string(n) + "/" + local
+}
+
+// local strips the namespace from a resource ID. IDs outside the namespace belong to another cluster and are
+// rejected.
+func (n namespace) local(id string) (string, error) {
+	if n == "" {
+		return id, nil
+	}
+	local, ok := strings.CutPrefix(id, string(n)+"/")
+	if !ok {
+		return "", fmt.Errorf("resource ID %q does not belong to cluster %s", id, n)
+	}
+	return local, nil
+}
+
+// principalID returns the cluster-local ID of a principal. IAM roles and users are not namespaced, since the same
+// ARN may be mapped on every cluster.
+func (n namespace) principalID(principal *v2.ResourceId) (string, error) {
+	switch principal.ResourceType {
+	case iamRoleResourceType.Id, iamUserResourceType.Id:
+		return principal.Resource, nil
+	}
+	return n.local(principal.Resource)
+}
+
+// cluster is an OpenSearch cluster synced by the connector.
+type cluster struct {
+	namespace
+	client *client.Client
+}
+
+// clusterSet holds the clusters of a connector: a single unnamed cluster, or named clusters whose resources sit
+// below a cluster resource.
+type clusterSet struct {
+	clusters []*cluster
+	byName   map[string]*cluster
+}
+
+func newClusterSet(clusters ...*cluster) *clusterSet {
+	s := &clusterSet{clusters: clusters, byName: map[string]*cluster{}}
+	for _, c := range clusters {
+		if c.namespace != "" {
+			s.byName[string(c.namespace)] = c
+		}
+	}
+	return s
+}
+
+// named reports whether the clusters are named, and their resources therefore namespaced.
+func (s *clusterSet) named() bool {
+	return len(s.byName) > 0
+}
+
+// forParent returns the cluster whose top-level resources are listed under parent, or nil when there are none.
+// The single unnamed cluster lists its resources without a parent.
+func (s *clusterSet) forParent(parent *v2.ResourceId) *cluster {
+	if !s.named() {
+		if parent == nil {
+			return s.clusters[0]
+		}
+		return nil
+	}
+	if parent == nil || parent.ResourceType != clusterResourceType.Id {
+		return nil
+	}
+	return s.byName[parent.Resource]
+}
+
+// forID returns the cluster a resource ID belongs to and the ID within the cluster.
+func (s *clusterSet) forID(id string) (*cluster, string, error) {
+	if !s.named() {
+		return s.clusters[0], id, nil
+	}
+	name, local, ok := strings.Cut(id, "/")
+	c, found := s.byName[name]
+	if !ok || !found {
+		return nil, "", fmt.Errorf("resource ID %q does not belong to a configured cluster", id)
+	}
+	return c, local, nil
+}
+
+// supports reports whether any cluster supports the capability.
+func (s *clusterSet) supports(capability client.Capability) bool {
+	for _, c := range s.clusters {
+		if c.client.Supports(capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// canProvision reports whether the connector can grant and revoke roles on every cluster. The permission each
+// cluster lacks is logged.
+func (s *clusterSet) canProvision(ctx context.Context) bool {
+	return s.allows(ctx, "role provisioning", "", (*client.Client).CheckProvisioning)
+}
+
+// canInvalidateAPIKeys reports whether the connector can invalidate API keys on every cluster that has them.
+func (s *clusterSet) canInvalidateAPIKeys(ctx context.Context) bool {
+	return s.allows(ctx, "API key invalidation", client.CapabilityAPIKeys, (*client.Client).CheckAPIKeyInvalidation)
+}
+
+// canDeleteServiceTokens reports whether the connector can delete service account tokens on every cluster that
+// has service accounts.
+func (s *clusterSet) canDeleteServiceTokens(ctx context.Context) bool {
+	return s.allows(ctx, "service account token deletion", client.CapabilityServiceAccounts, (*client.Client).CheckServiceTokenDeletion)
+}
+
+// allows reports whether a permission check passes on every cluster that supports the capability, or on every
+// cluster when the capability is empty. The reason each failing cluster gives is logged.
+func (s *clusterSet) allows(ctx context.Context, action string, capability client.Capability, check func(*client.Client, context.Context) error) bool {
+	l := ctxzap.Extract(ctx)
+	ok := true
+	for _, c := range s.clusters {
+		if capability != "" && !c.client.Supports(capability) {
+			continue
+		}
+		if err := check(c.client, ctx); err != nil {
+			l.Warn(action+" is not available", zap.String("cluster", string(c.namespace)), zap.Error(err))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// parentOptions places a top-level resource of a named cluster below its cluster resource.
+func (c *cluster) parentOptions() []batonResource.ResourceOption {
+	if c.namespace == "" {
+		return nil
+	}
+	return []batonResource.ResourceOption{
+		batonResource.WithParentResourceID(&v2.ResourceId{ResourceType: clusterResourceType.Id, Resource: string(c.namespace)}),
+	}
+}
+
+type clusterBuilder struct {
+	clusters     *clusterSet
+	resourceType *v2.ResourceType
+}
+
+func (o *clusterBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *clusterBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID != nil {
+		return nil, "", nil, nil
+	}
+
+	var resources []*v2.Resource
+	for _, c := range o.clusters.clusters {
+		description := string(c.client.Flavor())
+		if version := c.client.Version(); !version.IsZero() {
+			description += " " + version.String()
+		}
+		opts := []batonResource.ResourceOption{
+			batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: roleResourceType.Id}),
+			batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: indexResourceType.Id}),
+			batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: aliasResourceType.Id}),
+			batonResource.WithDescription(description),
+		}
+		if c.client.Supports(client.CapabilityDataStreams) {
+			opts = append(opts, batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: dataStreamResourceType.Id}))
+		}
+		if c.client.Supports(client.CapabilityAPIKeys) {
+			opts = append(opts, batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: apiKeyResourceType.Id}))
+		}
+		if c.client.Supports(client.CapabilityServiceAccounts) {
+			opts = append(opts, batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: serviceAccountResourceType.Id}))
+		}
+
+		clusterResource, err := batonResource.NewResource(string(c.namespace), o.resourceType, string(c.namespace), opts...)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to create cluster resource: %w", err)
+		}
+
+		resources = append(resources, clusterResource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *clusterBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *clusterBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newClusterBuilder(clusters *clusterSet) *clusterBuilder {
+	return &clusterBuilder{
+		clusters:     clusters,
+		resourceType: clusterResourceType,
+	}
+}
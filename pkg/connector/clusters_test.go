@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespace(t *testing.T) {
+	assert.Equal(t, "alice", namespace("").id("alice"))
+	assert.Equal(t, "prod/alice", namespace("prod").id("alice"))
+
+	for _, tc := range []struct {
+		ns      namespace
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{ns: "", id: "alice", want: "alice"},
+		{ns: "", id: "staging/alice", want: "staging/alice"},
+		{ns: "prod", id: "prod/alice", want: "alice"},
+		{ns: "prod", id: "prod/team/alice", want: "team/alice"},
+		{ns: "prod", id: "staging/alice", wantErr: true},
+		{ns: "prod", id: "alice", wantErr: true},
+		{ns: "prod", id: "production/alice", wantErr: true},
+	} {
+		got, err := tc.ns.local(tc.id)
+		if tc.wantErr {
+			assert.Error(t, err, "%s in %q", tc.id, tc.ns)
+			continue
+		}
+		assert.NoError(t, err, "%s in %q", tc.id, tc.ns)
+		assert.Equal(t, tc.want, got, "%s in %q", tc.id, tc.ns)
+	}
+
+	arn := "arn:aws:iam::123456789012:role/admin"
+	got, err := namespace("prod").principalID(&v2.ResourceId{ResourceType: iamRoleResourceType.Id, Resource: arn})
+	assert.NoError(t, err)
+	assert.Equal(t, arn, got)
+	_, err = namespace("prod").principalID(&v2.ResourceId{ResourceType: userResourceType.Id, Resource: "staging/alice"})
+	assert.Error(t, err)
+}
+
+func TestClusterSetLookup(t *testing.T) {
+	single := newClusterSet(&cluster{})
+	assert.Same(t, single.clusters[0], single.forParent(nil))
+	assert.Nil(t, single.forParent(&v2.ResourceId{ResourceType: clusterResourceType.Id, Resource: "prod"}))
+	cl, id, err := single.forID("prod/all_access")
+	assert.NoError(t, err)
+	assert.Same(t, single.clusters[0], cl)
+	assert.Equal(t, "prod/all_access", id)
+
+	prod, staging := &cluster{namespace: "prod"}, &cluster{namespace: "staging"}
+	named := newClusterSet(prod, staging)
+	assert.Nil(t, named.forParent(nil))
+	assert.Nil(t, named.forParent(&v2.ResourceId{ResourceType: roleResourceType.Id, Resource: "prod"}))
+	assert.Nil(t, named.forParent(&v2.ResourceId{ResourceType: clusterResourceType.Id, Resource: "dev"}))
+	assert.Same(t, staging, named.forParent(&v2.ResourceId{ResourceType: clusterResourceType.Id, Resource: "staging"}))
+
+	cl, id, err = named.forID("prod/team/all_access")
+	assert.NoError(t, err)
+	assert.Same(t, prod, cl)
+	assert.Equal(t, "team/all_access", id)
+	for _, id := range []string{"all_access", "dev/all_access"} {
+		_, _, err = named.forID(id)
+		assert.Error(t, err, id)
+	}
+}
+
+func TestRoleGrantRevokeNamespaced(t *testing.T) {
+	ctx := context.Background()
+	prodAPI, stagingAPI := newFakeSecurityAPI(), newFakeSecurityAPI()
+	prodAPI.mappings["all_access"] = map[string][]string{"users": {}, "backend_roles": {}}
+	stagingAPI.mappings["all_access"] = map[string][]string{"users": {"alice"}, "backend_roles": {}}
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "prod", prodAPI), newTestCluster(t, "staging", stagingAPI)), nil)
+	ent := roleEntitlement(t, "prod/all_access")
+
+	_, err := builder.Grant(ctx, principal(userResourceType, "prod/alice"), ent)
+	assert.NoError(t, err)
+	_, err = builder.Grant(ctx, principal(groupResourceType, "prod/admins"), ent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, prodAPI.mappings["all_access"]["users"])
+	assert.Equal(t, []string{"admins"}, prodAPI.mappings["all_access"]["backend_roles"])
+
+	// Principals of another cluster are rejected rather than mapped under their namespaced ID.
+	_, err = builder.Grant(ctx, principal(userResourceType, "staging/bob"), ent)
+	assert.Error(t, err)
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "staging/alice")})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"alice"}, prodAPI.mappings["all_access"]["users"])
+	assert.Equal(t, []string{"alice"}, stagingAPI.mappings["all_access"]["users"])
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "prod/alice")})
+	assert.NoError(t, err)
+	assert.Empty(t, prodAPI.mappings["all_access"]["users"])
+	assert.Equal(t, []string{"alice"}, stagingAPI.mappings["all_access"]["users"])
+}
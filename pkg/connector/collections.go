@@ -0,0 +1,320 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/conductorone/baton-opensearch/pkg/connector/aoss"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	batonResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// policySet loads the data access policies once per sync and shares them between the collection and collection
+// index builders. Loading them costs a call per policy, so reading them for every collection and index pattern
+// would invite throttling. Listing collections starts a sync, so it drops the policies of the previous one.
+type policySet struct {
+	client *aoss.Client
+
+	mu       sync.Mutex
+	policies []aoss.AccessPolicy
+	loaded   bool
+}
+
+func newPolicySet(client *aoss.Client) *policySet {
+	return &policySet{client: client}
+}
+
+// get returns the data access policies, loading them on first use.
+func (p *policySet) get(ctx context.Context) ([]aoss.AccessPolicy, *v2.RateLimitDescription, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.loaded {
+		return p.policies, nil, nil
+	}
+	policies, rl, err := p.client.GetDataAccessPolicies(ctx)
+	if err != nil {
+		return nil, rl, fmt.Errorf("failed to get data access policies: %w", err)
+	}
+	p.policies, p.loaded = policies, true
+	return policies, rl, nil
+}
+
+// reset drops the loaded policies, so the next sync reads them again.
+func (p *policySet) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.policies, p.loaded = nil, false
+}
+
+type collectionBuilder struct {
+	client       *aoss.Client
+	policies     *policySet
+	userMatchKey string
+	resourceType *v2.ResourceType
+}
+
+func (o *collectionBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *collectionBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	o.policies.reset()
+
+	var resources []*v2.Resource
+	var annos annotations.Annotations
+	collections, rl, err := o.client.ListCollections(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("failed to get collections: %w", err)
+	}
+
+	for _, collection := range collections {
+		collectionResource, err := batonResource.NewResource(
+			collection.Name,
+			o.resourceType,
+			collection.Name,
+			batonResource.WithDescription(fmt.Sprintf("%s (%s)", collection.ARN, collection.Status)),
+			batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: collectionIndexResourceType.Id}),
+		)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("failed to create collection resource: %w", err)
+		}
+
+		resources = append(resources, collectionResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+func (o *collectionBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return permissionEntitlements(resource, aoss.CollectionPermissions), "", nil, nil
+}
+
+func (o *collectionBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var annos annotations.Annotations
+	policies, rl, err := o.policies.get(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	name := resource.Id.Resource
+	grants, err := policyGrants(ctx, resource, policies, aoss.CollectionPermissions, o.userMatchKey, func(rule aoss.PolicyRule) bool {
+		return rule.MatchesCollection(name)
+	})
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	return grants, "", annos, nil
+}
+
+func newCollectionBuilder(client *aoss.Client, policies *policySet, userMatchKey string) *collectionBuilder {
+	return &collectionBuilder{
+		client:       client,
+		policies:     policies,
+		userMatchKey: userMatchKey,
+		resourceType: collectionResourceType,
+	}
+}
+
+// collectionIndexBuilder lists the index patterns that data access policies name within a collection.
+type collectionIndexBuilder struct {
+	policies     *policySet
+	userMatchKey string
+	resourceType *v2.ResourceType
+}
+
+func (o *collectionIndexBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *collectionIndexBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	var annos annotations.Annotations
+	policies, rl, err := o.policies.get(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	collection := parentResourceID.Resource
+	var patterns []string
+	for _, policy := range policies {
+		for _, statement := range policy.Statements {
+			for _, rule := range statement.Rules {
+				for _, pattern := range rule.IndexPatterns(collection) {
+					if !slices.Contains(patterns, pattern) {
+						patterns = append(patterns, pattern)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(patterns)
+
+	var resources []*v2.Resource
+	for _, pattern := range patterns {
+		indexResource, err := batonResource.NewResource(
+			pattern,
+			o.resourceType,
+			collection+"/"+pattern,
+			batonResource.WithParentResourceID(parentResourceID),
+			batonResource.WithDescription(fmt.Sprintf("Indexes matching %s in collection %s", pattern, collection)),
+		)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("failed to create collection index resource: %w", err)
+		}
+
+		resources = append(resources, indexResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+func (o *collectionIndexBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return permissionEntitlements(resource, aoss.IndexPermissions), "", nil, nil
+}
+
+func (o *collectionIndexBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	collection, pattern, ok := strings.Cut(resource.Id.Resource, "/")
+	if !ok {
+		return nil, "", nil, fmt.Errorf("invalid collection index ID %q", resource.Id.Resource)
+	}
+
+	var annos annotations.Annotations
+	policies, rl, err := o.policies.get(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	grants, err := policyGrants(ctx, resource, policies, aoss.IndexPermissions, o.userMatchKey, func(rule aoss.PolicyRule) bool {
+		return slices.Contains(rule.IndexPatterns(collection), pattern)
+	})
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	return grants, "", annos, nil
+}
+
+func newCollectionIndexBuilder(policies *policySet, userMatchKey string) *collectionIndexBuilder {
+	return &collectionIndexBuilder{
+		policies:     policies,
+		userMatchKey: userMatchKey,
+		resourceType: collectionIndexResourceType,
+	}
+}
+
+// permissionEntitlements returns an entitlement for each data access permission.
+func permissionEntitlements(resource *v2.Resource, permissions []string) []*v2.Entitlement {
+	entitlements := make([]*v2.Entitlement, 0, len(permissions))
+	for _, permission := range permissions {
+		entitlements = append(entitlements, entitlement.NewPermissionEntitlement(
+			resource,
+			permission,
+			entitlement.WithGrantableTo(userResourceType, groupResourceType, iamRoleResourceType, iamUserResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, permission)),
+			entitlement.WithDescription(fmt.Sprintf("aoss:%s on %s", permission, resource.DisplayName)),
+		))
+	}
+	return entitlements
+}
+
+// policyGrant identifies a grant while the policies that contribute to it are collected.
+type policyGrant struct {
+	permission string
+	principal  string
+}
+
+// policyGrants derives grants on resource from the data access policy rules that match it. A principal granted
+// the same permission by several policies gets one grant listing every policy.
+func policyGrants(
+	ctx context.Context,
+	resource *v2.Resource,
+	policies []aoss.AccessPolicy,
+	permissions []string,
+	userMatchKey string,
+	matches func(aoss.PolicyRule) bool,
+) ([]*v2.Grant, error) {
+	l := ctxzap.Extract(ctx)
+
+	sources := map[policyGrant][]string{}
+	var order []policyGrant
+	for _, policy := range policies {
+		for _, statement := range policy.Statements {
+			for _, rule := range statement.Rules {
+				if !matches(rule) {
+					continue
+				}
+				for _, permission := range permissions {
+					if !rule.Allows(permission) {
+						continue
+					}
+					for _, principal := range statement.Principal {
+						key := policyGrant{permission: permission, principal: principal}
+						if _, ok := sources[key]; !ok {
+							order = append(order, key)
+						}
+						if !slices.Contains(sources[key], policy.Name) {
+							sources[key] = append(sources[key], policy.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var grants []*v2.Grant
+	for _, key := range order {
+		principal, ok := aoss.ParsePrincipal(key.principal)
+		if !ok {
+			l.Debug("skipping unsupported data access policy principal", zap.String("principal", key.principal))
+			continue
+		}
+
+		policyNames := make([]interface{}, 0, len(sources[key]))
+		for _, name := range sources[key] {
+			policyNames = append(policyNames, name)
+		}
+		opt := grant.WithGrantMetadata(map[string]interface{}{"policies": policyNames})
+
+		var g *v2.Grant
+		var err error
+		switch principal.Kind {
+		case aoss.PrincipalIAM:
+			principalType := iamPrincipalType(principal.Name)
+			if principalType == nil {
+				l.Debug("skipping unsupported IAM principal", zap.String("principal", principal.Name))
+				continue
+			}
+			g, err = newIAMGrant(resource, key.permission, principalType, principal.Name, opt)
+		case aoss.PrincipalGroup:
+			g, err = newGroupGrant(resource, key.permission, "", principal.Name, opt)
+		default:
+			g, err = newUserGrant(resource, key.permission, "", principal.Name, userMatchKey, opt)
+		}
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+
+	return grants, nil
+}
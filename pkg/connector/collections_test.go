@@ -0,0 +1,93 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/conductorone/baton-opensearch/pkg/connector/aoss"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicySetLoadsPoliciesOncePerSync(t *testing.T) {
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "OpenSearchServerless.")
+		calls[operation]++
+
+		var input map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&input)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch operation {
+		case "ListCollections":
+			_, _ = w.Write([]byte(`{"collectionSummaries": [{"name": "logs"}, {"name": "metrics"}]}`))
+		case "ListAccessPolicies":
+			_, _ = w.Write([]byte(`{"accessPolicySummaries": [{"name": "readers"}, {"name": "admins"}]}`))
+		case "GetAccessPolicy":
+			_, _ = w.Write([]byte(`{"accessPolicyDetail": {"name": "` + input["name"] + `", "policy": [{
+				"Rules": [{"ResourceType": "index", "Resource": ["index/*/*"], "Permission": ["aoss:ReadDocument"]}],
+				"Principal": ["saml/123456789012/okta/user/alice"]}]}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := aoss.NewClient(context.Background(), "us-east-1",
+		aoss.WithEndpoint(server.URL),
+		aoss.WithCredentials(credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")),
+	)
+	assert.NoError(t, err)
+
+	policies := newPolicySet(client)
+	collections := newCollectionBuilder(client, policies, "username")
+	indices := newCollectionIndexBuilder(policies, "username")
+
+	runSync := func() {
+		resources, _, _, err := collections.List(context.Background(), nil, nil)
+		assert.NoError(t, err)
+		for _, collection := range resources {
+			_, _, _, err := collections.Grants(context.Background(), collection, nil)
+			assert.NoError(t, err)
+			children, _, _, err := indices.List(context.Background(), collection.Id, nil)
+			assert.NoError(t, err)
+			for _, index := range children {
+				grants, _, _, err := indices.Grants(context.Background(), index, nil)
+				assert.NoError(t, err)
+				assert.NotEmpty(t, grants)
+			}
+		}
+	}
+
+	runSync()
+	assert.Equal(t, 1, calls["ListAccessPolicies"])
+	assert.Equal(t, 2, calls["GetAccessPolicy"])
+
+	// The next sync reads the policies again.
+	runSync()
+	assert.Equal(t, 2, calls["ListAccessPolicies"])
+	assert.Equal(t, 4, calls["GetAccessPolicy"])
+}
+
+func TestPolicySetReturnsLoadErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"__type": "AccessDeniedException", "message": "denied"}`))
+	}))
+	defer server.Close()
+
+	client, err := aoss.NewClient(context.Background(), "us-east-1",
+		aoss.WithEndpoint(server.URL),
+		aoss.WithCredentials(credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")),
+	)
+	assert.NoError(t, err)
+
+	builder := newCollectionBuilder(client, newPolicySet(client), "username")
+	collection := &v2.Resource{Id: &v2.ResourceId{ResourceType: collectionResourceType.Id, Resource: "logs"}, DisplayName: "logs"}
+	_, _, _, err = builder.Grants(context.Background(), collection, nil)
+	assert.ErrorContains(t, err, "failed to get data access policies")
+}
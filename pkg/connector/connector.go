@@ -2,8 +2,11 @@ package connector
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strings"
 
+	"github.com/conductorone/baton-opensearch/pkg/connector/aoss"
 	"github.com/conductorone/baton-opensearch/pkg/connector/client"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -11,14 +14,73 @@ import (
 )
 
 type Connector struct {
-	client *client.Client
+	clusters *clusterSet
+	// aoss is set instead of clusters in serverless mode.
+	aoss         *aoss.Client
+	userMatchKey string
+	// classifications rate roles by the data classification of the indices they reach, when set.
+	classifications *client.Classifications
+}
+
+// SetClassifications sets the data classifications of index patterns that roles and their holders are rated
+// against. It must be called before the connector is served.
+func (d *Connector) SetClassifications(classifications *client.Classifications) {
+	d.classifications = classifications
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
 func (d *Connector) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
-		newRoleBuilder(d.client),
+	if d.aoss != nil {
+		policies := newPolicySet(d.aoss)
+		return []connectorbuilder.ResourceSyncer{
+			newCollectionBuilder(d.aoss, policies, d.userMatchKey),
+			newCollectionIndexBuilder(policies, d.userMatchKey),
+		}
+	}
+
+	var syncers []connectorbuilder.ResourceSyncer
+	if d.clusters.named() {
+		syncers = append(syncers, newClusterBuilder(d.clusters))
+	}
+	// Provisioning and deletion are only advertised when every cluster lets the connector make those writes.
+	var roles connectorbuilder.ResourceSyncer = newRoleBuilder(d.clusters, d.classifications)
+	if !d.clusters.canProvision(ctx) {
+		roles = syncOnly{roles}
+	}
+	syncers = append(syncers,
+		roles,
+		newIndexBuilder(d.clusters, indexResourceType),
+		newIndexBuilder(d.clusters, aliasResourceType),
+	)
+	if d.clusters.supports(client.CapabilityDataStreams) {
+		syncers = append(syncers, newIndexBuilder(d.clusters, dataStreamResourceType))
+	}
+
+	if d.clusters.supports(client.CapabilityAPIKeys) {
+		var apiKeys connectorbuilder.ResourceSyncer = newAPIKeyBuilder(d.clusters)
+		if !d.clusters.canInvalidateAPIKeys(ctx) {
+			apiKeys = syncOnly{apiKeys}
+		}
+		syncers = append(syncers, apiKeys)
 	}
+	if d.clusters.supports(client.CapabilityServiceAccounts) {
+		var tokens connectorbuilder.ResourceSyncer = newServiceAccountTokenBuilder(d.clusters)
+		if !d.clusters.canDeleteServiceTokens(ctx) {
+			tokens = syncOnly{tokens}
+		}
+		syncers = append(syncers,
+			newServiceAccountBuilder(d.clusters),
+			tokens,
+		)
+	}
+
+	return syncers
+}
+
+// syncOnly hides the provisioning and deletion methods of a syncer, so the connector does not advertise them.
+// Capabilities are derived from the interfaces that syncers implement.
+type syncOnly struct {
+	connectorbuilder.ResourceSyncer
 }
 
 // Asset takes an input AssetRef and attempts to fetch it using the connector's authenticated http client
@@ -38,17 +100,77 @@ func (d *Connector) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error)
 // Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
 // to be sure that they are valid.
 func (d *Connector) Validate(ctx context.Context) (annotations.Annotations, error) {
+	if d.aoss != nil {
+		if _, _, err := d.aoss.ListCollections(ctx); err != nil {
+			return nil, fmt.Errorf("failed to list OpenSearch Serverless collections, check the AWS credentials and region: %w", err)
+		}
+		return nil, nil
+	}
+
+	for _, c := range d.clusters.clusters {
+		if err := c.client.Validate(ctx); err != nil {
+			if c.namespace != "" {
+				return nil, fmt.Errorf("cluster %s: %w", c.namespace, err)
+			}
+			return nil, err
+		}
+	}
+
 	return nil, nil
 }
 
 // New returns a new instance of the connector.
-func New(ctx context.Context, address, username, password, userMatchKey string, insecureSkipVerify bool, credentials []byte) (*Connector, error) {
-	client, err := client.NewClient(ctx, address, username, password, userMatchKey, insecureSkipVerify, credentials)
+func New(
+	ctx context.Context,
+	address, username, password, userMatchKey string,
+	insecureSkipVerify bool,
+	credentials []byte,
+	opts ...client.Option,
+) (*Connector, error) {
+	client, err := client.NewClient(ctx, address, username, password, userMatchKey, insecureSkipVerify, credentials, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Connector{
+		clusters: newClusterSet(&cluster{client: client}),
+	}, nil
+}
+
+// NewMultiCluster returns a connector that syncs several named clusters. Each cluster's resources sit below a
+// cluster resource and their IDs are prefixed with the cluster name.
+func NewMultiCluster(ctx context.Context, clusters []Cluster) (*Connector, error) {
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("at least one cluster is required")
+	}
+
+	synced := make([]*cluster, 0, len(clusters))
+	for _, c := range clusters {
+		if c.Name == "" || strings.Contains(c.Name, "/") {
+			return nil, fmt.Errorf("invalid cluster name %q", c.Name)
+		}
+		clusterClient, err := client.NewClient(ctx, c.Address, c.Username, c.Password, c.UserMatchKey, c.InsecureSkipVerify, c.Credentials, c.Options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client for cluster %s: %w", c.Name, err)
+		}
+		synced = append(synced, &cluster{namespace: namespace(c.Name), client: clusterClient})
+	}
+
+	return &Connector{
+		clusters: newClusterSet(synced...),
+	}, nil
+}
+
+// NewServerless returns a connector that syncs the data access policies of OpenSearch Serverless collections
+// in region.
+func NewServerless(ctx context.Context, region, userMatchKey string, opts ...aoss.Option) (*Connector, error) {
+	aossClient, err := aoss.NewClient(ctx, region, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Connector{
-		client: client,
+		aoss:         aossClient,
+		userMatchKey: userMatchKey,
 	}, nil
 }
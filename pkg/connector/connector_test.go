@@ -0,0 +1,40 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceSyncersAdvertiseProvisioningOnlyWhenAllowed(t *testing.T) {
+	tests := []struct {
+		name            string
+		permissionsInfo string
+		want            bool
+	}{
+		{name: "allowed", permissionsInfo: `{"user_name": "baton", "has_api_access": true, "disabled_endpoints": {}}`, want: true},
+		{name: "no API access", permissionsInfo: `{"user_name": "baton", "has_api_access": false}`, want: false},
+		{name: "role mappings read-only", permissionsInfo: `{"user_name": "baton", "has_api_access": true, "disabled_endpoints": {"ROLESMAPPING": ["PUT", "PATCH"]}}`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeSecurityAPI()
+			api.permissionsInfo = tt.permissionsInfo
+			d := &Connector{clusters: newClusterSet(newTestCluster(t, "", api))}
+
+			var found bool
+			for _, syncer := range d.ResourceSyncers(context.Background()) {
+				if syncer.ResourceType(context.Background()).Id != roleResourceType.Id {
+					continue
+				}
+				found = true
+				_, provisions := syncer.(connectorbuilder.ResourceProvisioner)
+				assert.Equal(t, tt.want, provisions)
+			}
+			assert.True(t, found)
+		})
+	}
+}
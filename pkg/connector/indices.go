@@ -0,0 +1,311 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	batonResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// indexBuilder syncs indices, aliases or data streams, depending on its resource type. Roles are granted an
+// access level on them when one of their index patterns matches the name and the allowed actions include the
+// level's actions. Permissions that reference user variables are granted to the users they apply to.
+type indexBuilder struct {
+	clusters     *clusterSet
+	resourceType *v2.ResourceType
+}
+
+func (o *indexBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *indexBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	cl := o.clusters.forParent(parentResourceID)
+	if cl == nil {
+		return nil, "", nil, nil
+	}
+
+	var annos annotations.Annotations
+	var names, descriptions []string
+	switch o.resourceType.Id {
+	case aliasResourceType.Id:
+		aliases, rl, err := cl.client.GetAliases(ctx)
+		annos.WithRateLimiting(rl)
+		if err != nil {
+			return nil, "", annos, err
+		}
+		for _, alias := range aliases {
+			names = append(names, alias.Name)
+			descriptions = append(descriptions, "Alias of "+strings.Join(alias.Indices, ", "))
+		}
+	case dataStreamResourceType.Id:
+		if !cl.client.Supports(client.CapabilityDataStreams) {
+			return nil, "", nil, nil
+		}
+		streams, rl, err := cl.client.GetDataStreams(ctx)
+		annos.WithRateLimiting(rl)
+		if err != nil {
+			return nil, "", annos, err
+		}
+		for _, stream := range streams {
+			names = append(names, stream.Name)
+			descriptions = append(descriptions, fmt.Sprintf("Data stream with %d backing indices", len(stream.Indices)))
+		}
+	default:
+		indices, rl, err := cl.client.GetIndices(ctx)
+		annos.WithRateLimiting(rl)
+		if err != nil {
+			return nil, "", annos, err
+		}
+		for _, index := range indices {
+			names = append(names, index.Name)
+			descriptions = append(descriptions, fmt.Sprintf("%s index (%s), %s documents", index.Status, index.Health, index.DocsCount))
+		}
+	}
+
+	resources := make([]*v2.Resource, 0, len(names))
+	for i, name := range names {
+		opts := append([]batonResource.ResourceOption{batonResource.WithDescription(descriptions[i])}, cl.parentOptions()...)
+		indexResource, err := batonResource.NewResource(name, o.resourceType, cl.id(name), opts...)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("failed to create %s resource: %w", o.resourceType.Id, err)
+		}
+		resources = append(resources, indexResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+func (o *indexBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	entitlements := make([]*v2.Entitlement, 0, len(client.AccessLevels))
+	for _, level := range client.AccessLevels {
+		entitlements = append(entitlements, entitlement.NewPermissionEntitlement(
+			resource,
+			level,
+			entitlement.WithGrantableTo(roleResourceType, userResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, level)),
+			entitlement.WithDescription(fmt.Sprintf("%s access to %s %s", level, o.resourceType.DisplayName, resource.DisplayName)),
+		))
+	}
+	return entitlements, "", nil, nil
+}
+
+func (o *indexBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	cl, name, err := o.clusters.forID(resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var annos annotations.Annotations
+	roles, rl, err := cl.client.GetRoles(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	actionGroups, rl, err := cl.client.IndexActionGroups(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	now := time.Now()
+	var grants []*v2.Grant
+	// Permissions whose index patterns or DLS reference user variables differ per user. They are evaluated for
+	// each user that holds the role instead of being granted to the role.
+	templated := map[string][]client.IndexPermission{}
+	for _, role := range roles {
+		// How the role has each access level: the matching index patterns and their restrictions.
+		access := map[string]*indexAccess{}
+		for _, perm := range role.IndexPermissions {
+			if perm.Templated() {
+				templated[role.Name] = append(templated[role.Name], perm)
+				continue
+			}
+			addIndexAccess(access, actionGroups, perm, name, now)
+		}
+
+		for _, level := range client.AccessLevels {
+			if access[level] == nil {
+				continue
+			}
+			g, err := newRoleGrant(resource, level, cl.id(role.Name), grant.WithGrantMetadata(access[level].metadata()))
+			if err != nil {
+				return nil, "", annos, err
+			}
+			grants = append(grants, g)
+		}
+	}
+
+	if len(templated) > 0 {
+		userGrants, err := o.userGrants(ctx, &annos, cl, resource, name, templated, actionGroups, now)
+		if err != nil {
+			return nil, "", annos, err
+		}
+		grants = append(grants, userGrants...)
+	}
+
+	return grants, "", annos, nil
+}
+
+// userGrants grants access levels on the index named name to the internal users whose roles have templated
+// permissions, with the user's name, roles and attributes substituted into the permissions.
+func (o *indexBuilder) userGrants(
+	ctx context.Context,
+	annos *annotations.Annotations,
+	cl *cluster,
+	resource *v2.Resource,
+	name string,
+	templated map[string][]client.IndexPermission,
+	actionGroups client.ActionGroups,
+	now time.Time,
+) ([]*v2.Grant, error) {
+	users, rl, err := cl.client.GetUsers(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	mappings, rl, err := cl.client.GetRoleMappings(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role mappings: %w", err)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].UserIdentifier < users[j].UserIdentifier })
+	userMatchKey := cl.client.GetUserMatchKey()
+	var grants []*v2.Grant
+	for _, user := range users {
+		if user.Enabled != nil && !*user.Enabled {
+			continue
+		}
+
+		assignments := client.UserRoles(user, mappings)
+		securityRoles := make([]string, 0, len(assignments))
+		for _, assignment := range assignments {
+			securityRoles = append(securityRoles, assignment.Role)
+		}
+		userContext := client.NewUserContext(user, securityRoles)
+
+		access := map[string]*indexAccess{}
+		for _, assignment := range assignments {
+			for _, perm := range templated[assignment.Role] {
+				for _, level := range addIndexAccess(access, actionGroups, userContext.Apply(perm), name, now) {
+					access[level].roles = appendUnique(access[level].roles, assignment.Role)
+				}
+			}
+		}
+
+		for _, level := range client.AccessLevels {
+			if access[level] == nil {
+				continue
+			}
+			g, err := newUserGrant(resource, level, cl.namespace, user.UserIdentifier, userMatchKey, grant.WithGrantMetadata(access[level].metadata()))
+			if err != nil {
+				return nil, err
+			}
+			grants = append(grants, g)
+		}
+	}
+
+	return grants, nil
+}
+
+// addIndexAccess records the access levels that perm gives on the index named name, and returns them.
+func addIndexAccess(access map[string]*indexAccess, actionGroups client.ActionGroups, perm client.IndexPermission, name string, now time.Time) []string {
+	var matched []string
+	for _, pattern := range perm.IndexPatterns {
+		if client.MatchIndexPattern(pattern, name, now) {
+			matched = append(matched, pattern)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	levels := client.ActionAccessLevels(actionGroups.Expand(perm.AllowedActions))
+	for _, level := range levels {
+		if access[level] == nil {
+			access[level] = &indexAccess{}
+		}
+		access[level].add(matched, perm)
+	}
+	return levels
+}
+
+// indexAccess collects the index permissions of a role that give it one access level on an index, along with
+// their document and field level security.
+type indexAccess struct {
+	patterns      []string
+	dls           []string
+	fieldIncludes []string
+	fieldExcludes []string
+	maskedFields  []string
+	// roles are the roles of a user grant that contribute the access.
+	roles []string
+	// unrestricted is set when one of the permissions has no document or field level security.
+	unrestricted bool
+}
+
+func (a *indexAccess) add(patterns []string, perm client.IndexPermission) {
+	a.patterns = appendUnique(a.patterns, patterns...)
+	if !perm.Restricted() {
+		a.unrestricted = true
+		return
+	}
+	if perm.DLS != "" {
+		a.dls = appendUnique(a.dls, perm.DLS)
+	}
+	a.fieldIncludes = appendUnique(a.fieldIncludes, perm.FieldIncludes()...)
+	a.fieldExcludes = appendUnique(a.fieldExcludes, perm.FieldExcludes()...)
+	a.maskedFields = appendUnique(a.maskedFields, perm.MaskedFields...)
+}
+
+// metadata describes the access as grant metadata. The restrictions are listed whenever a permission has them,
+// and restricted tells whether they apply to all of the role's access.
+func (a *indexAccess) metadata() map[string]interface{} {
+	metadata := map[string]interface{}{
+		"index_patterns": toInterfaces(a.patterns),
+		"restricted":     !a.unrestricted,
+	}
+	if len(a.roles) > 0 {
+		metadata["roles"] = toInterfaces(a.roles)
+	}
+	for key, values := range map[string][]string{
+		"dls":           a.dls,
+		"fls_include":   a.fieldIncludes,
+		"fls_exclude":   a.fieldExcludes,
+		"masked_fields": a.maskedFields,
+	} {
+		if len(values) > 0 {
+			metadata[key] = toInterfaces(values)
+		}
+	}
+	return metadata
+}
+
+// appendUnique appends the values that values does not contain yet.
+func appendUnique(values []string, add ...string) []string {
+	for _, v := range add {
+		if !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func newIndexBuilder(clusters *clusterSet, resourceType *v2.ResourceType) *indexBuilder {
+	return &indexBuilder{
+		clusters:     clusters,
+		resourceType: resourceType,
+	}
+}
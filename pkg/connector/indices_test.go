@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+)
+
+// indexGrants returns the grants of the index, alias or data stream named name as principal ID to access levels,
+// and the metadata of each grant keyed by principal ID and level.
+func indexGrants(t *testing.T, builder *indexBuilder, name string) (map[string][]string, map[string]map[string]interface{}) {
+	grants, _, _, err := builder.Grants(context.Background(), principal(builder.resourceType, name), nil)
+	assert.NoError(t, err)
+
+	levels := map[string][]string{}
+	metadata := map[string]map[string]interface{}{}
+	for _, g := range grants {
+		level := g.Entitlement.Id[strings.LastIndex(g.Entitlement.Id, ":")+1:]
+		levels[g.Principal.Id.Resource] = append(levels[g.Principal.Id.Resource], level)
+
+		md := &v2.GrantMetadata{}
+		annos := annotations.Annotations(g.Annotations)
+		ok, err := annos.Pick(md)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		metadata[g.Principal.Id.Resource+"/"+level] = md.Metadata.AsMap()
+	}
+	return levels, metadata
+}
+
+func TestIndexGrantsMatchPatternsAndLevels(t *testing.T) {
+	api := newFakeSecurityAPI()
+	api.roles["logs_reader"] = json.RawMessage(`{"index_permissions": [{"index_patterns": ["logs-*"], "allowed_actions": ["read"]}]}`)
+	api.roles["logs_writer"] = json.RawMessage(`{"index_permissions": [{"index_patterns": ["logs-2024*"], "allowed_actions": ["crud"]}]}`)
+	api.roles["admin"] = json.RawMessage(`{"index_permissions": [{"index_patterns": ["*"], "allowed_actions": ["indices_all"]}]}`)
+	api.roles["metrics_reader"] = json.RawMessage(`{"index_permissions": [{"index_patterns": ["metrics-*"], "allowed_actions": ["read"]}]}`)
+	api.roles["monitor"] = json.RawMessage(`{"index_permissions": [{"index_patterns": ["logs-*"], "allowed_actions": ["indices:monitor/*"]}]}`)
+	cl := newTestCluster(t, "", api)
+
+	// Indices, aliases and data streams are granted alike by name.
+	for _, resourceType := range []*v2.ResourceType{indexResourceType, aliasResourceType, dataStreamResourceType} {
+		builder := newIndexBuilder(newClusterSet(cl), resourceType)
+
+		levels, metadata := indexGrants(t, builder, "logs-2024.01")
+		assert.Equal(t, map[string][]string{
+			"logs_reader": {"read"},
+			"logs_writer": {"read", "write"},
+			"admin":       {"read", "write", "admin"},
+		}, levels, resourceType.Id)
+		assert.Equal(t, []interface{}{"logs-2024*"}, metadata["logs_writer/write"]["index_patterns"])
+		assert.Equal(t, false, metadata["logs_writer/write"]["restricted"])
+
+		levels, _ = indexGrants(t, builder, "metrics-cpu")
+		assert.Equal(t, map[string][]string{
+			"metrics_reader": {"read"},
+			"admin":          {"read", "write", "admin"},
+		}, levels, resourceType.Id)
+	}
+}
+
+func TestIndexGrantsDescribeRestrictions(t *testing.T) {
+	api := newFakeSecurityAPI()
+	api.roles["analyst"] = json.RawMessage(`{"index_permissions": [
+		{"index_patterns": ["logs-*"], "allowed_actions": ["read"], "dls": "{\"term\": {\"team\": \"analysts\"}}",
+		 "fls": ["~secret"], "masked_fields": ["email"]}
+	]}`)
+	api.roles["auditor"] = json.RawMessage(`{"index_permissions": [
+		{"index_patterns": ["logs-*"], "allowed_actions": ["read"], "fls": ["message", "timestamp"]},
+		{"index_patterns": ["logs-eu"], "allowed_actions": ["read"]}
+	]}`)
+	builder := newIndexBuilder(newClusterSet(newTestCluster(t, "", api)), indexResourceType)
+
+	_, metadata := indexGrants(t, builder, "logs-eu")
+	analyst := metadata["analyst/read"]
+	assert.Equal(t, true, analyst["restricted"])
+	assert.Equal(t, []interface{}{`{"term": {"team": "analysts"}}`}, analyst["dls"])
+	assert.Equal(t, []interface{}{"secret"}, analyst["fls_exclude"])
+	assert.Equal(t, []interface{}{"email"}, analyst["masked_fields"])
+	assert.NotContains(t, analyst, "fls_include")
+
+	// The restriction is listed, but an unrestricted permission on the same index lifts it.
+	auditor := metadata["auditor/read"]
+	assert.Equal(t, false, auditor["restricted"])
+	assert.Equal(t, []interface{}{"message", "timestamp"}, auditor["fls_include"])
+	assert.Equal(t, []interface{}{"logs-*", "logs-eu"}, auditor["index_patterns"])
+}
+
+func TestIndexGrantsTemplatedPermissionsPerUser(t *testing.T) {
+	api := newFakeSecurityAPI()
+	api.roles["own_logs"] = json.RawMessage(`{"index_permissions": [
+		{"index_patterns": ["logs-${user.name}"], "allowed_actions": ["crud"]},
+		{"index_patterns": ["logs-*"], "allowed_actions": ["read"], "dls": "{\"term\": {\"owner\": \"${user.name}\"}}"}
+	]}`)
+	api.mappings["own_logs"] = map[string][]string{"users": {"alice", "bob"}}
+	api.users["alice"] = map[string][]string{}
+	api.users["bob"] = map[string][]string{}
+	api.users["carol"] = map[string][]string{}
+	builder := newIndexBuilder(newClusterSet(newTestCluster(t, "", api)), indexResourceType)
+
+	// Templated permissions are granted to the users they apply to rather than to the role.
+	levels, metadata := indexGrants(t, builder, "logs-alice")
+	assert.Equal(t, map[string][]string{
+		"alice": {"read", "write"},
+		"bob":   {"read"},
+	}, levels)
+	assert.Equal(t, []interface{}{"own_logs"}, metadata["alice/write"]["roles"])
+	assert.Equal(t, false, metadata["alice/read"]["restricted"])
+	assert.Equal(t, true, metadata["bob/read"]["restricted"])
+	assert.Equal(t, []interface{}{`{"term": {"owner": "bob"}}`}, metadata["bob/read"]["dls"])
+}
@@ -0,0 +1,145 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/bid"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	batonResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// newGroupGrant grants the entitlement to a group, such as a backend role, and expands it to the group's members.
+// Groups are resolved against an external group source by name. The group's ID is namespaced by ns.
+func newGroupGrant(resource *v2.Resource, entitlementName string, ns namespace, groupName string, opts ...grant.GrantOption) (*v2.Grant, error) {
+	groupResourceId, err := batonResource.NewResourceID(groupResourceType, ns.id(groupName))
+	if err != nil {
+		return nil, fmt.Errorf("error creating group resource ID: %w", err)
+	}
+
+	grantOpts := append([]grant.GrantOption{}, opts...)
+
+	// Handle wildcard case where "*" means all groups
+	if groupName == "*" {
+		externalMatch := &v2.ExternalResourceMatchAll{
+			ResourceType: v2.ResourceType_TRAIT_GROUP,
+		}
+		grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+	}
+
+	// Add external resource matching annotation to match by group membership
+	externalMatch := &v2.ExternalResourceMatch{
+		ResourceType: v2.ResourceType_TRAIT_GROUP,
+		Key:          "name",
+		Value:        groupName,
+	}
+	grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+
+	groupResource := &v2.Resource{Id: groupResourceId}
+	groupEntitlement := entitlement.NewAssignmentEntitlement(groupResource, "member")
+	bidEnt, err := bid.MakeBid(groupEntitlement)
+	if err != nil {
+		return nil, fmt.Errorf("error generating bid for group member entitlement: %w", err)
+	}
+
+	expandable := &v2.GrantExpandable{
+		EntitlementIds: []string{bidEnt},
+		Shallow:        true,
+	}
+	grantOpts = append(grantOpts, grant.WithAnnotation(expandable))
+
+	return grant.NewGrant(resource, entitlementName, groupResourceId, grantOpts...), nil
+}
+
+// newUserGrant grants the entitlement to a user, resolved against an external user source by userMatchKey. The
+// user's ID is namespaced by ns.
+func newUserGrant(resource *v2.Resource, entitlementName string, ns namespace, userIdentifier, userMatchKey string, opts ...grant.GrantOption) (*v2.Grant, error) {
+	// Create a reference to the user resource by ID
+	userResourceId, err := batonResource.NewResourceID(userResourceType, ns.id(userIdentifier))
+	if err != nil {
+		return nil, fmt.Errorf("error creating user resource ID: %w", err)
+	}
+
+	grantOpts := append([]grant.GrantOption{}, opts...)
+
+	// Handle wildcard case where "*" means all users
+	if userIdentifier == "*" {
+		externalMatch := &v2.ExternalResourceMatchAll{
+			ResourceType: v2.ResourceType_TRAIT_USER,
+		}
+		grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+	}
+
+	// Add external resource matching annotation to match by userIdentifier
+	if userMatchKey == "id" {
+		externalMatch := &v2.ExternalResourceMatchID{
+			Id: userIdentifier,
+		}
+		grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+	} else {
+		externalMatch := &v2.ExternalResourceMatch{
+			ResourceType: v2.ResourceType_TRAIT_USER,
+			Key:          userMatchKey,
+			Value:        userIdentifier,
+		}
+		grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+	}
+
+	return grant.NewGrant(resource, entitlementName, userResourceId, grantOpts...), nil
+}
+
+// iamPrincipalType returns the resource type of an IAM role or user ARN, such as the backend roles that Amazon
+// OpenSearch Service maps for IAM and Cognito identities, or nil when principal is not one.
+func iamPrincipalType(principal string) *v2.ResourceType {
+	parsed, err := arn.Parse(principal)
+	if err != nil || parsed.Service != "iam" {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(parsed.Resource, "role/"):
+		return iamRoleResourceType
+	case strings.HasPrefix(parsed.Resource, "user/"):
+		return iamUserResourceType
+	default:
+		return nil
+	}
+}
+
+// newIAMGrant grants the entitlement to an IAM role or user. AWS connectors use ARNs as resource IDs, so the
+// principal is matched by ID.
+func newIAMGrant(resource *v2.Resource, entitlementName string, principalType *v2.ResourceType, principalARN string, opts ...grant.GrantOption) (*v2.Grant, error) {
+	principalId, err := batonResource.NewResourceID(principalType, principalARN)
+	if err != nil {
+		return nil, fmt.Errorf("error creating IAM principal resource ID: %w", err)
+	}
+
+	grantOpts := append([]grant.GrantOption{}, opts...)
+	grantOpts = append(grantOpts, grant.WithAnnotation(&v2.ExternalResourceMatchID{Id: principalARN}))
+
+	return grant.NewGrant(resource, entitlementName, principalId, grantOpts...), nil
+}
+
+// newRoleGrant grants the entitlement to a role and expands it to everyone who holds the role, including members
+// of groups the role is assigned to. roleID is the role's resource ID, namespaced like the role.
+func newRoleGrant(resource *v2.Resource, entitlementName string, roleID string, opts ...grant.GrantOption) (*v2.Grant, error) {
+	roleResourceId, err := batonResource.NewResourceID(roleResourceType, roleID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating role resource ID: %w", err)
+	}
+
+	roleEntitlement := entitlement.NewAssignmentEntitlement(&v2.Resource{Id: roleResourceId}, "assigned")
+	bidEnt, err := bid.MakeBid(roleEntitlement)
+	if err != nil {
+		return nil, fmt.Errorf("error generating bid for role assigned entitlement: %w", err)
+	}
+
+	grantOpts := append([]grant.GrantOption{}, opts...)
+	grantOpts = append(grantOpts, grant.WithAnnotation(&v2.GrantExpandable{
+		EntitlementIds: []string{bidEnt},
+	}))
+
+	return grant.NewGrant(resource, entitlementName, roleResourceId, grantOpts...), nil
+}
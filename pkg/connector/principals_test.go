@@ -0,0 +1,81 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIAMPrincipalType(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal string
+		want      *v2.ResourceType
+	}{
+		{"iam role", "arn:aws:iam::123456789012:role/analyst", iamRoleResourceType},
+		{"iam role with path", "arn:aws:iam::123456789012:role/service-role/ingest", iamRoleResourceType},
+		{"iam user", "arn:aws:iam::123456789012:user/alice", iamUserResourceType},
+		{"govcloud partition", "arn:aws-us-gov:iam::123456789012:role/analyst", iamRoleResourceType},
+		{"iam group", "arn:aws:iam::123456789012:group/admins", nil},
+		{"assumed role session", "arn:aws:sts::123456789012:assumed-role/analyst/session", nil},
+		{"other service", "arn:aws:s3:::bucket/role/analyst", nil},
+		{"missing resource", "arn:aws:iam::123456789012", nil},
+		{"not an arn", "analysts", nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, iamPrincipalType(tt.principal))
+		})
+	}
+}
+
+func TestNewIAMGrant(t *testing.T) {
+	role := roleEntitlement(t, "readall").Resource
+	principalARN := "arn:aws:iam::123456789012:role/analyst"
+
+	g, err := newIAMGrant(role, "assigned", iamRoleResourceType, principalARN)
+	assert.NoError(t, err)
+	assert.Equal(t, iamRoleResourceType.Id, g.Principal.Id.ResourceType)
+	assert.Equal(t, principalARN, g.Principal.Id.Resource)
+
+	match := &v2.ExternalResourceMatchID{}
+	annos := annotations.Annotations(g.Annotations)
+	ok, err := annos.Pick(match)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, principalARN, match.Id)
+}
+
+func TestMappingMembers(t *testing.T) {
+	mapping := &client.RoleMapping{Users: []string{"alice"}, BackendRoles: []string{"arn:aws:iam::123456789012:role/analyst"}}
+	tests := []struct {
+		resourceType *v2.ResourceType
+		wantPath     string
+		wantMembers  []string
+		wantErr      bool
+	}{
+		{userResourceType, "/users", mapping.Users, false},
+		{iamUserResourceType, "/users", mapping.Users, false},
+		{groupResourceType, "/backend_roles", mapping.BackendRoles, false},
+		{iamRoleResourceType, "/backend_roles", mapping.BackendRoles, false},
+		{roleResourceType, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resourceType.Id, func(t *testing.T) {
+			path, members, err := mappingMembers(mapping, tt.resourceType.Id)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPath, path)
+			assert.Equal(t, tt.wantMembers, members)
+		})
+	}
+}
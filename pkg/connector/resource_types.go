@@ -13,6 +13,14 @@ var userResourceType = &v2.ResourceType{
 	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
 }
 
+// The cluster resource type is the parent of each cluster's resources when several clusters are synced.
+var clusterResourceType = &v2.ResourceType{
+	Id:          "cluster",
+	DisplayName: "Cluster",
+	Description: "OpenSearch cluster",
+	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
+}
+
 var roleResourceType = &v2.ResourceType{
 	Id:          "role",
 	DisplayName: "Role",
@@ -25,3 +33,74 @@ var groupResourceType = &v2.ResourceType{
 	DisplayName: "Group",
 	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
 }
+
+// IAM roles and users appear in Amazon OpenSearch Service role mappings and are resolved by an AWS connector.
+var iamRoleResourceType = &v2.ResourceType{
+	Id:          "iam_role",
+	DisplayName: "IAM Role",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_ROLE},
+	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
+}
+
+var iamUserResourceType = &v2.ResourceType{
+	Id:          "iam_user",
+	DisplayName: "IAM User",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_USER},
+	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
+}
+
+var apiKeyResourceType = &v2.ResourceType{
+	Id:          "api_key",
+	DisplayName: "API Key",
+	Description: "Elasticsearch API key",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_SECRET},
+	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
+}
+
+var serviceAccountResourceType = &v2.ResourceType{
+	Id:          "service_account",
+	DisplayName: "Service Account",
+	Description: "Elasticsearch service account",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_USER},
+	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
+}
+
+var serviceAccountTokenResourceType = &v2.ResourceType{
+	Id:          "service_account_token",
+	DisplayName: "Service Account Token",
+	Description: "Elasticsearch service account token",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_SECRET},
+	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
+}
+
+var collectionResourceType = &v2.ResourceType{
+	Id:          "collection",
+	DisplayName: "Collection",
+	Description: "OpenSearch Serverless collection",
+}
+
+var collectionIndexResourceType = &v2.ResourceType{
+	Id:          "collection_index",
+	DisplayName: "Collection Index",
+	Description: "Index pattern named by an OpenSearch Serverless data access policy",
+}
+
+// Indices, aliases and data streams carry read, write and admin entitlements granted to the roles whose index
+// permissions cover them.
+var indexResourceType = &v2.ResourceType{
+	Id:          "index",
+	DisplayName: "Index",
+	Description: "OpenSearch index",
+}
+
+var aliasResourceType = &v2.ResourceType{
+	Id:          "alias",
+	DisplayName: "Alias",
+	Description: "OpenSearch index alias",
+}
+
+var dataStreamResourceType = &v2.ResourceType{
+	Id:          "data_stream",
+	DisplayName: "Data Stream",
+	Description: "OpenSearch data stream",
+}
@@ -3,11 +3,14 @@ package connector
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/conductorone/baton-opensearch/pkg/connector/client"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
-	"github.com/conductorone/baton-sdk/pkg/bid"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	"github.com/conductorone/baton-sdk/pkg/types/grant"
@@ -19,8 +22,16 @@ import (
 )
 
 type roleBuilder struct {
-	client       *client.Client
-	resourceType *v2.ResourceType
+	clusters        *clusterSet
+	classifications *client.Classifications
+	resourceType    *v2.ResourceType
+
+	// users and models are the internal users and the risk model of each cluster, read once per sync for the
+	// grants of all roles. Listing a cluster's roles starts its sync and drops them. A nil model means it could
+	// not be loaded during the sync.
+	mu     sync.Mutex
+	users  map[*cluster][]client.User
+	models map[*cluster]*client.AccessModel
 }
 
 func (o *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -28,24 +39,66 @@ func (o *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 }
 
 func (o *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	cl := o.clusters.forParent(parentResourceID)
+	if cl == nil {
+		return nil, "", nil, nil
+	}
+	o.resetSync(cl)
+
 	var resources []*v2.Resource
-	roles, err := o.client.GetRoles(ctx)
+	var annos annotations.Annotations
+	roles, rl, err := cl.client.GetRoles(ctx)
+	annos.WithRateLimiting(rl)
 	if err != nil {
-		return nil, "", nil, fmt.Errorf("failed to get roles: %w", err)
+		return nil, "", annos, fmt.Errorf("failed to get roles: %w", err)
 	}
 
+	// Elasticsearch role mappings are rule based. Rules that cannot be resolved to users or groups are listed on
+	// the roles they grant so they can still be reviewed.
+	unresolved := map[string][]string{}
+	if cl.client.Flavor() == client.FlavorElasticsearch {
+		roleMappings, rl, err := cl.client.GetRoleMappings(ctx)
+		annos.WithRateLimiting(rl)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("failed to get role mappings: %w", err)
+		}
+		for _, roleMapping := range roleMappings {
+			unresolved[roleMapping.Name] = roleMapping.Unresolved
+		}
+	}
+
+	// Roles grant action groups such as crud. They are expanded to the actions they allow so the profile shows
+	// effective access and risk.
+	clusterGroups, indexGroups := roleActionGroups(ctx, &annos, cl)
+
 	for _, role := range roles {
+		profile := map[string]interface{}{
+			"description": role.Description,
+			"static":      role.Static,
+		}
+		if rules := unresolved[role.Name]; len(rules) > 0 {
+			profile["unresolved_role_mappings"] = strings.Join(rules, "; ")
+		}
+		if cl.client.Supports(client.CapabilityActionGroups) {
+			addEffectiveActions(profile, indexGroups, role)
+		}
+		addIndexRestrictions(profile, role)
+		if risk := client.ClassifyRole(role, clusterGroups, indexGroups); risk.Level != "" {
+			profile["risk"] = risk.Level
+			profile["risk_reasons"] = strings.Join(risk.Reasons, "; ")
+		}
+		if level := o.classifications.PermissionsLevel(role.IndexPermissions); level != "" {
+			profile["classification"] = level
+		}
 		traitOpts := []batonResource.RoleTraitOption{
-			batonResource.WithRoleProfile(map[string]interface{}{
-				"description": role.Description,
-				"static":      role.Static,
-			}),
+			batonResource.WithRoleProfile(profile),
 		}
 		roleResource, err := batonResource.NewRoleResource(
 			role.Name,
 			o.resourceType,
-			role.Name,
+			cl.id(role.Name),
 			traitOpts,
+			cl.parentOptions()...,
 		)
 		if err != nil {
 			return nil, "", nil, fmt.Errorf("failed to create role resource: %w", err)
@@ -54,133 +107,545 @@ func (o *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 		resources = append(resources, roleResource)
 	}
 
-	return resources, "", nil, nil
+	return resources, "", annos, nil
+}
+
+// addEffectiveActions adds the concrete actions a role allows to its profile: cluster_actions as a list, and
+// index_actions as the actions per index pattern, e.g. "logs-*: indices:data/read*, indices:data/write*".
+func addEffectiveActions(profile map[string]interface{}, actionGroups client.ActionGroups, role client.Role) {
+	if actions := actionGroups.Expand(role.ClusterPermissions); len(actions) > 0 {
+		profile["cluster_actions"] = strings.Join(actions, ", ")
+	}
+
+	var indexActions []string
+	for _, perm := range role.IndexPermissions {
+		actions := actionGroups.Expand(perm.AllowedActions)
+		if len(actions) == 0 {
+			continue
+		}
+		indexActions = append(indexActions, fmt.Sprintf("%s: %s", strings.Join(perm.IndexPatterns, ","), strings.Join(actions, ", ")))
+	}
+	if len(indexActions) > 0 {
+		profile["index_actions"] = strings.Join(indexActions, "; ")
+	}
+}
+
+// addIndexRestrictions adds the document and field level security of a role's index permissions to its profile
+// as index_restrictions, e.g. "customers-*: dls {"term":{"region":"eu"}}, fls ~ssn, masked email".
+func addIndexRestrictions(profile map[string]interface{}, role client.Role) {
+	var restrictions []string
+	for _, perm := range role.IndexPermissions {
+		if !perm.Restricted() {
+			continue
+		}
+		restrictions = append(restrictions, fmt.Sprintf("%s: %s", strings.Join(perm.IndexPatterns, ","), perm.DescribeRestrictions()))
+	}
+	if len(restrictions) > 0 {
+		profile["index_restrictions"] = strings.Join(restrictions, "; ")
+	}
+}
+
+// roleActionGroups returns the action groups that resolve the cluster and index permissions of roles. When the
+// cluster's action groups cannot be read, the built-in ones are used, so that roles still sync with the
+// permissions those resolve.
+func roleActionGroups(ctx context.Context, annos *annotations.Annotations, cl *cluster) (client.ActionGroups, client.ActionGroups) {
+	clusterGroups, indexGroups, rl, err := cl.client.RoleActionGroups(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		ctxzap.Extract(ctx).Warn("failed to get action groups, using the built-in ones", zap.String("cluster", string(cl.namespace)), zap.Error(err))
+	}
+	return clusterGroups, indexGroups
+}
+
+// resetSync drops what was read from a cluster during the previous sync.
+func (o *roleBuilder) resetSync(cl *cluster) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.users, cl)
+	delete(o.models, cl)
+}
+
+// syncUsers returns the internal users of a cluster, reading them once per sync.
+func (o *roleBuilder) syncUsers(ctx context.Context, annos *annotations.Annotations, cl *cluster) ([]client.User, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.loadUsers(ctx, annos, cl)
+}
+
+// loadUsers is syncUsers for callers that hold o.mu.
+func (o *roleBuilder) loadUsers(ctx context.Context, annos *annotations.Annotations, cl *cluster) ([]client.User, error) {
+	if users, ok := o.users[cl]; ok {
+		return users, nil
+	}
+	users, rl, err := cl.client.GetUsers(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	o.users[cl] = users
+	return users, nil
+}
+
+// syncModel returns the model that classifies the risk of a cluster's roles and of the principals that hold
+// them, loading it once per sync. It returns nil when the model cannot be loaded, in which case grants are
+// synced without risk and classification.
+func (o *roleBuilder) syncModel(ctx context.Context, annos *annotations.Annotations, cl *cluster) *client.AccessModel {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if model, ok := o.models[cl]; ok {
+		return model
+	}
+	model, err := o.loadModel(ctx, annos, cl)
+	if err != nil {
+		ctxzap.Extract(ctx).Warn("failed to load the risk model, syncing grants without risk",
+			zap.String("cluster", string(cl.namespace)), zap.Error(err))
+	}
+	o.models[cl] = model
+	return model
+}
+
+// loadModel loads the roles, role mappings and users of a cluster to classify the risk of roles and of the
+// principals that hold them.
+func (o *roleBuilder) loadModel(ctx context.Context, annos *annotations.Annotations, cl *cluster) (*client.AccessModel, error) {
+	roles, rl, err := cl.client.GetRoles(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+	mappings, rl, err := cl.client.GetRoleMappings(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role mappings: %w", err)
+	}
+	users, err := o.loadUsers(ctx, annos, cl)
+	if err != nil {
+		return nil, err
+	}
+	clusterGroups, indexGroups := roleActionGroups(ctx, annos, cl)
+
+	return &client.AccessModel{
+		Roles:         roles,
+		Mappings:      mappings,
+		Users:         users,
+		ClusterGroups: clusterGroups,
+		IndexGroups:   indexGroups,
+		DirectRoles:   cl.client.Flavor() != client.FlavorElasticsearch,
+	}, nil
 }
 
 func (o *roleBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	ent := entitlement.NewAssignmentEntitlement(
 		resource,
 		"assigned",
-		entitlement.WithGrantableTo(userResourceType, groupResourceType),
+		entitlement.WithGrantableTo(userResourceType, groupResourceType, iamRoleResourceType, iamUserResourceType),
 	)
 
 	return []*v2.Entitlement{ent}, "", nil, nil
 }
 
 func (o *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	cl, roleName, err := o.clusters.forID(resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
 	// Get the role mapping from the client
-	roleMapping, err := o.client.GetRoleMapping(ctx, resource.DisplayName)
+	var annos annotations.Annotations
+	roleMapping, rl, err := cl.client.GetRoleMapping(ctx, roleName)
+	annos.WithRateLimiting(rl)
 	if err != nil {
-		l := ctxzap.Extract(ctx)
 		// Check if this is a NotFound error (404) - not all roles may have mappings
-		if status.Code(err) == codes.NotFound {
-			l.Debug("role mapping not found (normal for unmapped roles)", zap.String("role", resource.DisplayName))
-			return []*v2.Grant{}, "", nil, nil
+		if status.Code(err) != codes.NotFound {
+			l.Error("error getting role mapping", zap.String("role", roleName), zap.Error(err))
+			return nil, "", annos, fmt.Errorf("failed to get role mapping: %w", err)
+		}
+		l.Debug("role mapping not found (normal for unmapped roles)", zap.String("role", roleName))
+		roleMapping = &client.RoleMapping{Name: roleName}
+	}
+
+	// Internal users can also hold the role directly in opendistro_security_roles. Elasticsearch native users'
+	// roles are already part of the synthesized role mappings.
+	directUsers := map[string]bool{}
+	if cl.client.Flavor() != client.FlavorElasticsearch {
+		users, err := o.syncUsers(ctx, &annos, cl)
+		if err != nil {
+			return nil, "", annos, err
+		}
+		for _, user := range users {
+			if slices.Contains(user.OpendistroSecurityRoles, roleName) {
+				directUsers[user.UserIdentifier] = true
+			}
 		}
-		l.Error("error getting role mapping", zap.String("role", resource.DisplayName), zap.Error(err))
-		return nil, "", nil, fmt.Errorf("failed to get role mapping: %w", err)
+	}
+
+	// Grants carry the role's risk and classification and the highest of all roles the principal holds, so
+	// privileged principals stand out on each of their grants.
+	model := o.syncModel(ctx, &annos, cl)
+	var roleRisk, roleClassification string
+	if model != nil {
+		roleRisk = model.RoleRisk(roleName).Level
+		roleClassification = model.RoleClassification(o.classifications, roleName)
 	}
 
 	var grants []*v2.Grant
 
 	// Create grants for backend roles (treating them as groups)
 	for _, backendRole := range roleMapping.BackendRoles {
-		groupResourceId, err := batonResource.NewResourceID(groupResourceType, backendRole)
+		metadata := assignmentMetadata([]string{assignmentRoleMapping}, roleMapping.GroupConditions[backendRole])
+		if model != nil {
+			addRisk(metadata, roleRisk, model.BackendRoleRisk(backendRole))
+			addClassification(metadata, roleClassification, model.BackendRoleClassification(o.classifications, backendRole))
+		}
+
+		var g *v2.Grant
+		var err error
+		if principalType := iamPrincipalType(backendRole); principalType != nil {
+			g, err = newIAMGrant(resource, "assigned", principalType, backendRole, grant.WithGrantMetadata(metadata))
+		} else {
+			g, err = newGroupGrant(resource, "assigned", cl.namespace, backendRole, grant.WithGrantMetadata(metadata))
+		}
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("error creating group resource ID: %w", err)
+			return nil, "", nil, err
 		}
+		grants = append(grants, g)
+	}
 
-		grantOpts := []grant.GrantOption{}
+	// Create grants for users named in the role mapping
+	userMatchKey := cl.client.GetUserMatchKey()
+	for _, userIdentifier := range roleMapping.Users {
+		sources := []string{assignmentRoleMapping}
+		if directUsers[userIdentifier] {
+			sources = append(sources, assignmentUser)
+			delete(directUsers, userIdentifier)
+		}
+		metadata := assignmentMetadata(sources, roleMapping.UserConditions[userIdentifier])
+		if model != nil {
+			addRisk(metadata, roleRisk, model.UserRisk(userIdentifier))
+			addClassification(metadata, roleClassification, model.UserClassification(o.classifications, userIdentifier))
+		}
 
-		// Handle wildcard case where "*" means all groups
-		if backendRole == "*" {
-			externalMatch := &v2.ExternalResourceMatchAll{
-				ResourceType: v2.ResourceType_TRAIT_GROUP,
-			}
-			grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+		var g *v2.Grant
+		var err error
+		if principalType := iamPrincipalType(userIdentifier); principalType != nil {
+			g, err = newIAMGrant(resource, "assigned", principalType, userIdentifier, grant.WithGrantMetadata(metadata))
+		} else {
+			g, err = newUserGrant(resource, "assigned", cl.namespace, userIdentifier, userMatchKey, grant.WithGrantMetadata(metadata))
+		}
+		if err != nil {
+			return nil, "", nil, err
 		}
+		grants = append(grants, g)
+	}
 
-		// Add external resource matching annotation to match by group membership
-		externalMatch := &v2.ExternalResourceMatch{
-			ResourceType: v2.ResourceType_TRAIT_GROUP,
-			Key:          "name",
-			Value:        backendRole,
+	// Create grants for users that hold the role directly and are not also mapped to it
+	direct := make([]string, 0, len(directUsers))
+	for userIdentifier := range directUsers {
+		direct = append(direct, userIdentifier)
+	}
+	sort.Strings(direct)
+	for _, userIdentifier := range direct {
+		metadata := assignmentMetadata([]string{assignmentUser}, nil)
+		if model != nil {
+			addRisk(metadata, roleRisk, model.UserRisk(userIdentifier))
+			addClassification(metadata, roleClassification, model.UserClassification(o.classifications, userIdentifier))
 		}
-		grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+		g, err := newUserGrant(resource, "assigned", cl.namespace, userIdentifier, userMatchKey, grant.WithGrantMetadata(metadata))
+		if err != nil {
+			return nil, "", nil, err
+		}
+		grants = append(grants, g)
+	}
 
-		groupResource := &v2.Resource{Id: groupResourceId}
-		groupEntitlement := entitlement.NewAssignmentEntitlement(groupResource, "member")
-		bidEnt, err := bid.MakeBid(groupEntitlement)
+	return grants, "", annos, nil
+}
 
-		if err != nil {
-			return nil, "", nil, fmt.Errorf("error generating bid for role assignment entitlement: %w", err)
+// Grant adds a user or group (backend role) to the role's mapping, creating the mapping if the role has none.
+func (o *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, ent *v2.Entitlement) (annotations.Annotations, error) {
+	cl, roleName, err := o.clusters.forID(ent.Resource.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+	principalID, err := cl.principalID(principal.Id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot grant role %s: %w", roleName, err)
+	}
+
+	// The mapping is patched from what is read here, so it must not come from the response cache: a grant or
+	// revoke made since would not be in it. The permissions are read fresh for the same reason.
+	ctx = client.WithFreshReads(ctx)
+	if err := cl.client.CheckGrant(ctx); err != nil {
+		return nil, fmt.Errorf("cannot grant role %s: %w", roleName, err)
+	}
+
+	var annos annotations.Annotations
+	err = retryConflicts(ctx, func() error {
+		return o.grantMapping(ctx, &annos, cl, roleName, principal.Id.ResourceType, principalID)
+	})
+	return annos, err
+}
+
+// grantMapping adds the principal to the role's mapping, or creates the mapping with the principal when the role
+// has none. A principal that is already mapped is reported with GrantAlreadyExists.
+func (o *roleBuilder) grantMapping(ctx context.Context, annos *annotations.Annotations, cl *cluster, roleName, resourceTypeID, principalID string) error {
+	l := ctxzap.Extract(ctx)
+	roleMapping, rl, err := cl.client.GetRoleMapping(ctx, roleName)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to get role mapping: %w", err)
+		}
+		roleMapping = &client.RoleMapping{Name: roleName}
+		switch resourceTypeID {
+		case userResourceType.Id, iamUserResourceType.Id:
+			roleMapping.Users = []string{principalID}
+		case groupResourceType.Id, iamRoleResourceType.Id:
+			roleMapping.BackendRoles = []string{principalID}
+		default:
+			return fmt.Errorf("cannot grant role %s to resource type %s", roleName, resourceTypeID)
 		}
 
-		expandable := &v2.GrantExpandable{
-			EntitlementIds: []string{bidEnt},
-			Shallow:        true,
+		rl, err = cl.client.CreateRoleMapping(ctx, roleMapping)
+		annos.WithRateLimiting(rl)
+		if err != nil {
+			return fmt.Errorf("failed to create role mapping: %w", err)
 		}
-		grantOpts = append(grantOpts, grant.WithAnnotation(expandable))
+		return nil
+	}
 
-		grant := grant.NewGrant(
-			resource,
-			"assigned",
-			groupResourceId,
-			grantOpts...,
-		)
-		grants = append(grants, grant)
+	path, members, err := mappingMembers(roleMapping, resourceTypeID)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(members, principalID) {
+		l.Debug("principal already mapped to role", zap.String("role", roleName), zap.String("principal", principalID))
+		annos.Append(&v2.GrantAlreadyExists{})
+		return nil
 	}
 
-	// Create grants for direct user assignments
-	for _, userIdentifier := range roleMapping.Users {
-		// Create a reference to the user resource by ID
-		userResourceId, err := batonResource.NewResourceID(userResourceType, userIdentifier)
+	rl, err = cl.client.PatchRoleMapping(ctx, roleName, []client.PatchOperation{appendOp(path, members, principalID)})
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return fmt.Errorf("failed to grant role %s: %w", roleName, err)
+	}
+
+	return nil
+}
+
+// Revoke removes a user or group (backend role) from the role's mapping. Users that hold the role directly also
+// have it removed from their opendistro_security_roles.
+func (o *roleBuilder) Revoke(ctx context.Context, g *v2.Grant) (annotations.Annotations, error) {
+	cl, roleName, err := o.clusters.forID(g.Entitlement.Resource.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+	principalID, err := cl.principalID(g.Principal.Id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot revoke role %s: %w", roleName, err)
+	}
+
+	// The mapping and user are patched from what is read, so neither may come from the response cache, and
+	// neither may the permissions.
+	ctx = client.WithFreshReads(ctx)
+	if err := cl.client.CheckRevoke(ctx); err != nil {
+		return nil, fmt.Errorf("cannot revoke role %s: %w", roleName, err)
+	}
+
+	var annos annotations.Annotations
+	var revokedMapping, revokedDirect bool
+	err = retryConflicts(ctx, func() error {
+		revokedMapping, err = o.revokeMapping(ctx, &annos, cl, roleName, g.Principal.Id.ResourceType, principalID)
+		return err
+	})
+	if err != nil {
+		return annos, err
+	}
+
+	if g.Principal.Id.ResourceType == userResourceType.Id && cl.client.Flavor() != client.FlavorElasticsearch {
+		err = retryConflicts(ctx, func() error {
+			revokedDirect, err = o.revokeDirect(ctx, &annos, cl, roleName, principalID)
+			return err
+		})
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("error creating user resource ID: %w", err)
+			return annos, err
 		}
+	}
 
-		grantOpts := []grant.GrantOption{}
+	if !revokedMapping && !revokedDirect {
+		annos.Append(&v2.GrantAlreadyRevoked{})
+	}
 
-		// Handle wildcard case where "*" means all users
-		if userIdentifier == "*" {
-			externalMatch := &v2.ExternalResourceMatchAll{
-				ResourceType: v2.ResourceType_TRAIT_USER,
-			}
-			grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+	return annos, nil
+}
+
+// revokeMapping removes the principal from the role's mapping and reports whether it was mapped.
+func (o *roleBuilder) revokeMapping(ctx context.Context, annos *annotations.Annotations, cl *cluster, roleName, resourceTypeID, principalID string) (bool, error) {
+	roleMapping, rl, err := cl.client.GetRoleMapping(ctx, roleName)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return false, nil
 		}
+		return false, fmt.Errorf("failed to get role mapping: %w", err)
+	}
 
-		// Add external resource matching annotation to match by userIdentifier
-		userMatchKey := o.client.GetUserMatchKey()
-		if userMatchKey == "id" {
-			externalMatch := &v2.ExternalResourceMatchID{
-				Id: userIdentifier,
-			}
-			grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
-		} else {
-			externalMatch := &v2.ExternalResourceMatch{
-				ResourceType: v2.ResourceType_TRAIT_USER,
-				Key:          userMatchKey,
-				Value:        userIdentifier,
-			}
-			grantOpts = append(grantOpts, grant.WithAnnotation(externalMatch))
+	path, members, err := mappingMembers(roleMapping, resourceTypeID)
+	if err != nil {
+		return false, err
+	}
+	if !slices.Contains(members, principalID) {
+		return false, nil
+	}
+
+	rl, err = cl.client.PatchRoleMapping(ctx, roleName, removeOps(path, members, principalID))
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke role %s: %w", roleName, err)
+	}
+
+	return true, nil
+}
+
+// revokeDirect removes the role from an internal user's opendistro_security_roles and reports whether the user
+// held it. Only the role's entries are removed, so roles granted to the user since it was read are kept.
+func (o *roleBuilder) revokeDirect(ctx context.Context, annos *annotations.Annotations, cl *cluster, roleName, userIdentifier string) (bool, error) {
+	users, rl, err := cl.client.GetUsers(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return false, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	idx := slices.IndexFunc(users, func(u client.User) bool { return u.UserIdentifier == userIdentifier })
+	if idx < 0 || !slices.Contains(users[idx].OpendistroSecurityRoles, roleName) {
+		return false, nil
+	}
+
+	rl, err = cl.client.PatchUser(ctx, userIdentifier, removeOps("/opendistro_security_roles", users[idx].OpendistroSecurityRoles, roleName))
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke role %s from user %s: %w", roleName, userIdentifier, err)
+	}
+
+	return true, nil
+}
+
+// Sources of a role assignment, recorded in grant metadata.
+const (
+	// assignmentRoleMapping is a grant through the role's mapping.
+	assignmentRoleMapping = "role_mapping"
+	// assignmentUser is a role held directly in an internal user's opendistro_security_roles.
+	assignmentUser = "user"
+)
+
+// assignmentMetadata records where a role assignment comes from and, for conditional role mapping grants, the
+// alternative rule conditions.
+func assignmentMetadata(sources []string, conditions []string) map[string]interface{} {
+	metadata := map[string]interface{}{"sources": toInterfaces(sources)}
+	if len(conditions) > 0 {
+		metadata["conditions"] = toInterfaces(conditions)
+	}
+	return metadata
+}
+
+// addRisk records the risk level of the role and the highest risk level of the principal's roles in grant
+// metadata, when they are set.
+func addRisk(metadata map[string]interface{}, roleRisk, principalRisk string) {
+	if roleRisk != "" {
+		metadata["risk"] = roleRisk
+	}
+	if principalRisk != "" {
+		metadata["principal_risk"] = principalRisk
+	}
+}
+
+// addClassification records the data classification of the role and the highest classification the
+// principal's roles reach in grant metadata, when they are set.
+func addClassification(metadata map[string]interface{}, roleClassification, principalClassification string) {
+	if roleClassification != "" {
+		metadata["classification"] = roleClassification
+	}
+	if principalClassification != "" {
+		metadata["principal_classification"] = principalClassification
+	}
+}
+
+// toInterfaces converts strings to the list type that grant metadata accepts.
+func toInterfaces(values []string) []interface{} {
+	rv := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		rv = append(rv, v)
+	}
+	return rv
+}
+
+// mappingMembers returns the JSON patch path and current members of the role mapping list that holds
+// principals of the given resource type. IAM users are mapped as users and IAM roles as backend roles.
+func mappingMembers(roleMapping *client.RoleMapping, resourceTypeID string) (string, []string, error) {
+	switch resourceTypeID {
+	case userResourceType.Id, iamUserResourceType.Id:
+		return "/users", roleMapping.Users, nil
+	case groupResourceType.Id, iamRoleResourceType.Id:
+		return "/backend_roles", roleMapping.BackendRoles, nil
+	default:
+		return "", nil, fmt.Errorf("role mappings cannot hold resources of type %s", resourceTypeID)
+	}
+}
+
+// maxPatchAttempts bounds how often a grant or revoke reads and patches an entity that other writers keep
+// changing in between.
+const maxPatchAttempts = 3
+
+// retryConflicts runs a step that reads an entity and patches it, again while the patch is aborted because the
+// entity changed since it was read.
+func retryConflicts(ctx context.Context, step func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxPatchAttempts; attempt++ {
+		err = step()
+		if status.Code(err) != codes.Aborted {
+			return err
 		}
+		ctxzap.Extract(ctx).Debug("entity changed while it was patched", zap.Int("attempt", attempt), zap.Error(err))
+	}
+	return err
+}
 
-		// Create the grant
-		grant := grant.NewGrant(
-			resource,
-			"assigned",
-			userResourceId,
-			grantOpts...,
-		)
-		grants = append(grants, grant)
+// appendOp returns the JSON patch operation that appends value to the list at path. Only the element is sent,
+// so members added since list was read are kept. A list missing from the entity, which decodes as nil, cannot
+// be appended to and is set instead.
+func appendOp(path string, list []string, value string) client.PatchOperation {
+	if list == nil {
+		return client.PatchOperation{Op: "add", Path: path, Value: []string{value}}
 	}
+	return client.PatchOperation{Op: "add", Path: path + "/-", Value: value}
+}
 
-	return grants, "", nil, nil
+// removeOps returns the JSON patch operations that remove each occurrence of value from the list at path by
+// index. They run from the last occurrence so that the earlier indices stay valid, and each removal is preceded
+// by a test that the index still holds value, so that the patch fails instead of removing another member when
+// the list changed since it was read.
+func removeOps(path string, list []string, value string) []client.PatchOperation {
+	var ops []client.PatchOperation
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i] == value {
+			elem := fmt.Sprintf("%s/%d", path, i)
+			ops = append(ops,
+				client.PatchOperation{Op: "test", Path: elem, Value: value},
+				client.PatchOperation{Op: "remove", Path: elem},
+			)
+		}
+	}
+	return ops
 }
 
-func newRoleBuilder(client *client.Client) *roleBuilder {
+func newRoleBuilder(clusters *clusterSet, classifications *client.Classifications) *roleBuilder {
 	return &roleBuilder{
-		client:       client,
-		resourceType: roleResourceType,
+		clusters:        clusters,
+		classifications: classifications,
+		resourceType:    roleResourceType,
+		users:           map[*cluster][]client.User{},
+		models:          map[*cluster]*client.AccessModel{},
 	}
 }
@@ -0,0 +1,482 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	batonResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSecurityAPI is an OpenSearch security REST API that keeps role mappings and internal users in memory and
+// applies the JSON patch operations the connector sends.
+type fakeSecurityAPI struct {
+	mu sync.Mutex
+	// roles, mappings and users hold each entity's list fields, e.g. mappings["readall"]["users"].
+	roles    map[string]json.RawMessage
+	mappings map[string]map[string][]string
+	users    map[string]map[string][]string
+	// forbidden holds the configuration types, e.g. "actiongroups", that the connector may not read.
+	forbidden map[string]bool
+	// permissionsInfo is the permissionsinfo response, which allows every write by default.
+	permissionsInfo string
+	// beforeWrite, when set, runs before each PUT or PATCH to simulate another writer changing the entities
+	// between the connector's read and its write.
+	beforeWrite func(f *fakeSecurityAPI)
+}
+
+func newFakeSecurityAPI() *fakeSecurityAPI {
+	return &fakeSecurityAPI{
+		roles:           map[string]json.RawMessage{},
+		mappings:        map[string]map[string][]string{},
+		users:           map[string]map[string][]string{},
+		forbidden:       map[string]bool{},
+		permissionsInfo: `{"user_name": "admin", "has_api_access": true, "disabled_endpoints": {}}`,
+	}
+}
+
+func (f *fakeSecurityAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/" {
+		_, _ = w.Write([]byte(`{"version": {"distribution": "opensearch", "number": "2.11.0"}}`))
+		return
+	}
+
+	kind, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/_plugins/_security/api/"), "/")
+	if f.forbidden[kind] {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var entities map[string]map[string][]string
+	switch kind {
+	case "permissionsinfo":
+		_, _ = w.Write([]byte(f.permissionsInfo))
+		return
+	case "account":
+		_, _ = w.Write([]byte(`{"user_name": "admin", "roles": ["all_access"]}`))
+		return
+	case "roles":
+		_ = json.NewEncoder(w).Encode(f.roles)
+		return
+	case "actiongroups":
+		_, _ = w.Write([]byte(`{}`))
+		return
+	case "rolesmapping":
+		entities = f.mappings
+	case "internalusers":
+		entities = f.users
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		_ = json.NewEncoder(w).Encode(entities)
+	case r.Method == http.MethodGet:
+		entity, ok := entities[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]map[string][]string{name: entity})
+	case r.Method == http.MethodPut:
+		if f.beforeWrite != nil {
+			f.beforeWrite(f)
+		}
+		var entity map[string][]string
+		_ = json.NewDecoder(r.Body).Decode(&entity)
+		_, replaced := entities[name]
+		entities[name] = entity
+		if replaced {
+			_, _ = w.Write([]byte(`{"status": "OK"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status": "CREATED"}`))
+	case r.Method == http.MethodPatch:
+		if f.beforeWrite != nil {
+			f.beforeWrite(f)
+		}
+		entity, ok := entities[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var ops []client.PatchOperation
+		_ = json.NewDecoder(r.Body).Decode(&ops)
+		// The patch applies to a copy so that a failing operation leaves the entity unchanged.
+		patched := make(map[string][]string, len(entity))
+		for field, list := range entity {
+			patched[field] = slices.Clone(list)
+		}
+		for _, op := range ops {
+			if !applyPatch(patched, op) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		entities[name] = patched
+		_, _ = w.Write([]byte(`{"status": "OK"}`))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// applyPatch applies a JSON patch operation to a list field, either to the whole list ("/users") or to one
+// element ("/users/-", "/users/2"). A "test" operation succeeds when the element equals the value.
+func applyPatch(entity map[string][]string, op client.PatchOperation) bool {
+	field, index, element := strings.Cut(strings.TrimPrefix(op.Path, "/"), "/")
+	if !element {
+		values, ok := op.Value.([]interface{})
+		if !ok || (op.Op != "add" && op.Op != "replace") {
+			return false
+		}
+		entity[field] = nil
+		for _, v := range values {
+			entity[field] = append(entity[field], v.(string))
+		}
+		return true
+	}
+
+	list := entity[field]
+	switch op.Op {
+	case "test":
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || i >= len(list) {
+			return false
+		}
+		return list[i] == op.Value
+	case "add":
+		if index != "-" {
+			return false
+		}
+		entity[field] = append(list, op.Value.(string))
+	case "remove":
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || i >= len(list) {
+			return false
+		}
+		entity[field] = append(list[:i:i], list[i+1:]...)
+	default:
+		return false
+	}
+	return true
+}
+
+// newTestCluster returns a cluster in the namespace backed by the fake security API.
+func newTestCluster(t *testing.T, ns namespace, api *fakeSecurityAPI) *cluster {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	c, err := client.NewClient(context.Background(), server.URL, "admin", "admin", "username", true, nil, client.WithSecurityFlavor("opensearch"))
+	assert.NoError(t, err)
+	return &cluster{namespace: ns, client: c}
+}
+
+// roleEntitlement returns the assigned entitlement of a role resource ID.
+func roleEntitlement(t *testing.T, id string) *v2.Entitlement {
+	role, err := batonResource.NewRoleResource(id, roleResourceType, id, nil)
+	assert.NoError(t, err)
+	return entitlement.NewAssignmentEntitlement(role, "assigned")
+}
+
+// principal returns a resource of the given type and ID.
+func principal(resourceType *v2.ResourceType, id string) *v2.Resource {
+	return &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceType.Id, Resource: id}}
+}
+
+func TestRoleGrantRevokeKeepConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.mappings["readall"] = map[string][]string{"users": {"carol"}, "backend_roles": {}}
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+	ent := roleEntitlement(t, "readall")
+
+	// Reads are cached, so each grant would patch from the mapping as the first read saw it.
+	_, err := builder.Grant(ctx, principal(userResourceType, "alice"), ent)
+	assert.NoError(t, err)
+	_, err = builder.Grant(ctx, principal(userResourceType, "bob"), ent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"carol", "alice", "bob"}, api.mappings["readall"]["users"])
+
+	// A change made outside the connector since the last read is kept as well.
+	api.mappings["readall"]["users"] = append(api.mappings["readall"]["users"], "dave")
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "alice")})
+	assert.NoError(t, err)
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "carol")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob", "dave"}, api.mappings["readall"]["users"])
+
+	_, err = builder.Grant(ctx, principal(groupResourceType, "analysts"), ent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"analysts"}, api.mappings["readall"]["backend_roles"])
+}
+
+func TestRoleGrantCreatesMissingMapping(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+
+	_, err := builder.Grant(ctx, principal(groupResourceType, "analysts"), roleEntitlement(t, "readall"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"analysts"}, api.mappings["readall"]["backend_roles"])
+	assert.Empty(t, api.mappings["readall"]["users"])
+}
+
+func TestRoleRevokeRetriesWhenTheMappingChanges(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.mappings["readall"] = map[string][]string{"users": {"carol", "alice"}}
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+	ent := roleEntitlement(t, "readall")
+
+	// Another writer inserts a member before the first patch, so alice is no longer at the index that was read.
+	api.beforeWrite = func(f *fakeSecurityAPI) {
+		f.mappings["readall"]["users"] = append([]string{"dave"}, f.mappings["readall"]["users"]...)
+		f.beforeWrite = nil
+	}
+	_, err := builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "alice")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dave", "carol"}, api.mappings["readall"]["users"])
+
+	// A mapping that keeps changing fails instead of removing the wrong member.
+	api.mappings["readall"]["users"] = []string{"carol", "alice"}
+	api.beforeWrite = func(f *fakeSecurityAPI) {
+		f.mappings["readall"]["users"] = append([]string{"dave"}, f.mappings["readall"]["users"]...)
+	}
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "alice")})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Contains(t, api.mappings["readall"]["users"], "alice")
+}
+
+func TestRoleGrantKeepsMembersAddedToAnEmptyList(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.mappings["readall"] = map[string][]string{"users": {}}
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+
+	api.beforeWrite = func(f *fakeSecurityAPI) {
+		f.mappings["readall"]["users"] = append(f.mappings["readall"]["users"], "dave")
+	}
+	_, err := builder.Grant(ctx, principal(userResourceType, "alice"), roleEntitlement(t, "readall"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dave", "alice"}, api.mappings["readall"]["users"])
+}
+
+func TestRoleGrantFailsWhenTheCreatedMappingReplacedAnother(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+
+	// Another writer creates the mapping between the read that found none and the create.
+	api.beforeWrite = func(f *fakeSecurityAPI) {
+		f.mappings["readall"] = map[string][]string{"users": {"dave"}}
+	}
+	_, err := builder.Grant(ctx, principal(userResourceType, "alice"), roleEntitlement(t, "readall"))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestRoleIAMPrincipals(t *testing.T) {
+	ctx := context.Background()
+	const (
+		analystRole = "arn:aws:iam::123456789012:role/analyst"
+		ingestRole  = "arn:aws:iam::123456789012:role/ingest"
+		aliceUser   = "arn:aws:iam::123456789012:user/alice"
+	)
+	api := newFakeSecurityAPI()
+	api.mappings["readall"] = map[string][]string{"backend_roles": {analystRole, "analysts"}, "users": {aliceUser, "bob"}}
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+	ent := roleEntitlement(t, "readall")
+
+	grants, _, _, err := builder.Grants(ctx, ent.Resource, nil)
+	assert.NoError(t, err)
+	principals := map[string]string{}
+	for _, g := range grants {
+		principals[g.Principal.Id.Resource] = g.Principal.Id.ResourceType
+	}
+	assert.Equal(t, map[string]string{
+		analystRole: iamRoleResourceType.Id,
+		"analysts":  groupResourceType.Id,
+		aliceUser:   iamUserResourceType.Id,
+		"bob":       userResourceType.Id,
+	}, principals)
+
+	// IAM roles are mapped as backend roles and IAM users as users.
+	_, err = builder.Grant(ctx, principal(iamRoleResourceType, ingestRole), ent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{analystRole, "analysts", ingestRole}, api.mappings["readall"]["backend_roles"])
+
+	annos, err := builder.Grant(ctx, principal(iamUserResourceType, aliceUser), ent)
+	assert.NoError(t, err)
+	assert.True(t, annos.Contains(&v2.GrantAlreadyExists{}))
+	assert.Equal(t, []string{aliceUser, "bob"}, api.mappings["readall"]["users"])
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(iamRoleResourceType, analystRole)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"analysts", ingestRole}, api.mappings["readall"]["backend_roles"])
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(iamUserResourceType, aliceUser)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, api.mappings["readall"]["users"])
+}
+
+func TestRoleRevokeDirectKeepsOtherRoles(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.users["alice"] = map[string][]string{"opendistro_security_roles": {"readall", "kibana_user", "readall"}}
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+	ent := roleEntitlement(t, "readall")
+
+	// A role granted after the connector last read the user is kept.
+	_, _, _, err := builder.Grants(ctx, ent.Resource, nil)
+	assert.NoError(t, err)
+	api.users["alice"]["opendistro_security_roles"] = append(api.users["alice"]["opendistro_security_roles"], "alerting_ack")
+
+	annos, err := builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "alice")})
+	assert.NoError(t, err)
+	assert.False(t, annos.Contains(&v2.GrantAlreadyRevoked{}))
+	assert.Equal(t, []string{"kibana_user", "alerting_ack"}, api.users["alice"]["opendistro_security_roles"])
+
+	annos, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "alice")})
+	assert.NoError(t, err)
+	assert.True(t, annos.Contains(&v2.GrantAlreadyRevoked{}))
+}
+
+func TestRoleGrantsReadUsersOncePerSync(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.roles["readall"] = json.RawMessage(`{}`)
+	api.roles["kibana_user"] = json.RawMessage(`{}`)
+	api.users["alice"] = map[string][]string{"opendistro_security_roles": {"readall"}}
+	cl := newTestCluster(t, "", api)
+	builder := newRoleBuilder(newClusterSet(cl), nil)
+
+	directHolders := func(role string) []string {
+		grants, _, _, err := builder.Grants(ctx, roleEntitlement(t, role).Resource, nil)
+		assert.NoError(t, err)
+		var holders []string
+		for _, g := range grants {
+			holders = append(holders, g.Principal.Id.Resource)
+		}
+		return holders
+	}
+
+	_, _, _, err := builder.List(ctx, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, directHolders("readall"))
+
+	// Users are not read again for the next role of the same sync, even when the response cache is dropped.
+	api.users["alice"]["opendistro_security_roles"] = []string{"readall", "kibana_user"}
+	assert.NoError(t, uhttp.ClearCaches(ctx))
+	assert.Empty(t, directHolders("kibana_user"))
+
+	// Listing the roles starts the next sync, which reads them again.
+	assert.NoError(t, uhttp.ClearCaches(ctx))
+	_, _, _, err = builder.List(ctx, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, directHolders("kibana_user"))
+}
+
+func TestRoleListFallsBackToBuiltinActionGroups(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.roles["logs_writer"] = json.RawMessage(`{"index_permissions": [{"index_patterns": ["logs-*"], "allowed_actions": ["crud"]}]}`)
+	api.forbidden["actiongroups"] = true
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+
+	roles, _, _, err := builder.List(ctx, nil, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, roles, 1) {
+		trait, err := batonResource.GetRoleTrait(roles[0])
+		assert.NoError(t, err)
+		actions, _ := batonResource.GetProfileStringValue(trait.Profile, "index_actions")
+		assert.Contains(t, actions, "indices:data/read*")
+		assert.Contains(t, actions, "indices:data/write/delete*")
+	}
+}
+
+func TestRoleGrantsWithoutRiskModel(t *testing.T) {
+	ctx := context.Background()
+	grantMetadata := func(g *v2.Grant) map[string]interface{} {
+		md := &v2.GrantMetadata{}
+		annos := annotations.Annotations(g.Annotations)
+		ok, err := annos.Pick(md)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		return md.Metadata.AsMap()
+	}
+
+	for _, forbidden := range []bool{false, true} {
+		api := newFakeSecurityAPI()
+		api.roles["admin"] = json.RawMessage(`{"cluster_permissions": ["*"]}`)
+		api.mappings["admin"] = map[string][]string{"users": {"alice"}}
+		api.forbidden["roles"] = forbidden
+		builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+
+		// Grants are synced either way; only their risk depends on the model.
+		grants, _, _, err := builder.Grants(ctx, roleEntitlement(t, "admin").Resource, nil)
+		assert.NoError(t, err)
+		if assert.Len(t, grants, 1) {
+			_, hasRisk := grantMetadata(grants[0])["risk"]
+			assert.Equal(t, !forbidden, hasRisk)
+		}
+	}
+}
+
+func TestRoleGrantRevokeCheckPermissions(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.mappings["readall"] = map[string][]string{"users": {"carol"}}
+	api.permissionsInfo = `{"user_name": "baton", "has_api_access": true, "disabled_endpoints": {"ROLESMAPPING": ["PATCH"]}}`
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+	ent := roleEntitlement(t, "readall")
+
+	_, err := builder.Grant(ctx, principal(userResourceType, "alice"), ent)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.ErrorContains(t, err, "cannot call PATCH rolesmapping")
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "carol")})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, []string{"carol"}, api.mappings["readall"]["users"])
+
+	// Permissions are checked on every write, so a fixed credential works without a restart.
+	api.permissionsInfo = `{"user_name": "baton", "has_api_access": true, "disabled_endpoints": {}}`
+	_, err = builder.Grant(ctx, principal(userResourceType, "alice"), ent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"carol", "alice"}, api.mappings["readall"]["users"])
+}
+
+func TestRoleGrantNeedsOnlyRoleMappingPermissions(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeSecurityAPI()
+	api.mappings["readall"] = map[string][]string{"users": {"carol"}}
+	api.permissionsInfo = `{"user_name": "baton", "has_api_access": true, "disabled_endpoints": {"INTERNALUSERS": ["PUT", "PATCH"]}}`
+	builder := newRoleBuilder(newClusterSet(newTestCluster(t, "", api)), nil)
+	ent := roleEntitlement(t, "readall")
+
+	_, err := builder.Grant(ctx, principal(userResourceType, "alice"), ent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"carol", "alice"}, api.mappings["readall"]["users"])
+
+	_, err = builder.Revoke(ctx, &v2.Grant{Entitlement: ent, Principal: principal(userResourceType, "carol")})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.ErrorContains(t, err, "cannot call PATCH internalusers")
+}
@@ -0,0 +1,179 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-opensearch/pkg/connector/client"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	batonResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type serviceAccountBuilder struct {
+	clusters     *clusterSet
+	resourceType *v2.ResourceType
+}
+
+func (o *serviceAccountBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *serviceAccountBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	cl := o.clusters.forParent(parentResourceID)
+	if cl == nil || !cl.client.Supports(client.CapabilityServiceAccounts) {
+		return nil, "", nil, nil
+	}
+
+	var resources []*v2.Resource
+	var annos annotations.Annotations
+	accounts, rl, err := cl.client.GetServiceAccounts(ctx)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("failed to get service accounts: %w", err)
+	}
+
+	for _, account := range accounts {
+		traitOpts := []batonResource.UserTraitOption{
+			batonResource.WithUserLogin(account.Principal),
+			batonResource.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE),
+			batonResource.WithStatus(v2.UserTrait_Status_STATUS_ENABLED),
+			batonResource.WithUserProfile(map[string]interface{}{
+				"role_descriptor": describeRoles([]client.Role{account.RoleDescriptor}),
+			}),
+		}
+		accountResource, err := batonResource.NewUserResource(
+			account.Principal,
+			o.resourceType,
+			cl.id(account.Principal),
+			traitOpts,
+			append(cl.parentOptions(), batonResource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: serviceAccountTokenResourceType.Id}))...,
+		)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("failed to create service account resource: %w", err)
+		}
+
+		resources = append(resources, accountResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+func (o *serviceAccountBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *serviceAccountBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func newServiceAccountBuilder(clusters *clusterSet) *serviceAccountBuilder {
+	return &serviceAccountBuilder{
+		clusters:     clusters,
+		resourceType: serviceAccountResourceType,
+	}
+}
+
+type serviceAccountTokenBuilder struct {
+	clusters     *clusterSet
+	resourceType *v2.ResourceType
+}
+
+func (o *serviceAccountTokenBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *serviceAccountTokenBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+	cl, principal, err := o.clusters.forID(parentResourceID.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var resources []*v2.Resource
+	var annos annotations.Annotations
+	tokens, rl, err := cl.client.GetServiceAccountTokens(ctx, principal)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("failed to get service account tokens: %w", err)
+	}
+
+	for _, token := range tokens {
+		tokenResource, err := batonResource.NewSecretResource(
+			token.Name,
+			o.resourceType,
+			cl.id(token.ServiceAccount+"/"+token.Name),
+			[]batonResource.SecretTraitOption{batonResource.WithSecretIdentityID(parentResourceID)},
+			batonResource.WithParentResourceID(parentResourceID),
+			batonResource.WithDescription(fmt.Sprintf("%s token of %s", token.Source, token.ServiceAccount)),
+		)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("failed to create service account token resource: %w", err)
+		}
+
+		resources = append(resources, tokenResource)
+	}
+
+	return resources, "", annos, nil
+}
+
+func (o *serviceAccountTokenBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *serviceAccountTokenBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Delete revokes a service account token. Tokens from service_tokens files can only be removed on the nodes.
+func (o *serviceAccountTokenBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	cl, id, err := o.clusters.forID(resourceId.Resource)
+	if err != nil {
+		return nil, err
+	}
+	idx := strings.LastIndex(id, "/")
+	if idx < 0 {
+		return nil, fmt.Errorf("invalid service account token ID %q", resourceId.Resource)
+	}
+	principal, name := id[:idx], id[idx+1:]
+	if err := cl.client.CheckServiceTokenDeletion(ctx); err != nil {
+		return nil, fmt.Errorf("cannot delete service account token %s: %w", id, err)
+	}
+
+	var annos annotations.Annotations
+	rl, err := cl.client.DeleteServiceAccountToken(ctx, principal, name)
+	annos.WithRateLimiting(rl)
+	if err == nil {
+		return annos, nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return annos, fmt.Errorf("failed to delete service account token: %w", err)
+	}
+
+	tokens, rl, err := cl.client.GetServiceAccountTokens(ctx, principal)
+	annos.WithRateLimiting(rl)
+	if err != nil {
+		return annos, fmt.Errorf("failed to get service account tokens: %w", err)
+	}
+	for _, token := range tokens {
+		if token.Name == name && token.Source == client.TokenSourceFile {
+			return annos, status.Errorf(codes.FailedPrecondition,
+				"token %s of service account %s is a file token and must be removed from service_tokens on every node", name, principal)
+		}
+	}
+
+	return annos, nil
+}
+
+func newServiceAccountTokenBuilder(clusters *clusterSet) *serviceAccountTokenBuilder {
+	return &serviceAccountTokenBuilder{
+		clusters:     clusters,
+		resourceType: serviceAccountTokenResourceType,
+	}
+}